@@ -3,8 +3,6 @@ package agent
 import (
 	"context"
 	"fmt"
-	"net/http"
-	"os"
 	"sync"
 
 	"github.com/cloudwego/eino-ext/components/model/ark"
@@ -13,6 +11,7 @@ import (
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
 
+	"illustration2/internal/config"
 	"illustration2/internal/model"
 	"illustration2/internal/volc"
 )
@@ -40,13 +39,13 @@ type ChildIllustrationAgent struct {
 }
 
 // NewChildIllustrationAgent 创建新的儿童插画视频生成助手实例
-func NewChildIllustrationAgent(arkClient *volc.ArkClient, storyTool, imageTool, videoTool tool.InvokableTool) *ChildIllustrationAgent {
-	apiKey := os.Getenv("ARK_API_KEY")
+func NewChildIllustrationAgent(cfg *config.Config, arkClient *volc.ArkClient, storyTool, imageTool, videoTool tool.InvokableTool) *ChildIllustrationAgent {
 	chatModel, _ := ark.NewChatModel(context.Background(), &ark.ChatModelConfig{
-		APIKey:     apiKey,
-		Region:     "cn-beijing",
-		HTTPClient: &http.Client{},
-		Model:      "ep-20250220181854-c8s82",
+		APIKey:     cfg.Ark.APIKey,
+		BaseURL:    cfg.Ark.BaseURL + "/api/v3",
+		Region:     cfg.Ark.Region,
+		HTTPClient: arkClient.ChatHTTPClient(),
+		Model:      cfg.Models.Endpoint(cfg.Models.Chat),
 	})
 
 	return &ChildIllustrationAgent{
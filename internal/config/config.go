@@ -0,0 +1,504 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 服务配置，由配置文件加载后再用环境变量覆盖
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Log      LogConfig      `yaml:"log"`
+	Ark      ArkConfig      `yaml:"ark"`
+	Models   ModelsConfig   `yaml:"models"`
+	Image    ImageConfig    `yaml:"image"`
+	Video    VideoConfig    `yaml:"video"`
+	Session  SessionConfig  `yaml:"session"`
+	Jobs     JobsConfig     `yaml:"jobs"`
+	Assets   AssetsConfig   `yaml:"assets"`
+	Download DownloadConfig `yaml:"download"`
+	Export   ExportConfig   `yaml:"export"`
+
+	registry *ModelRegistry
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"` // 监听地址，如:8080
+}
+
+type LogConfig struct {
+	File string `yaml:"file"` // 日志文件路径
+}
+
+type ArkConfig struct {
+	BaseURL string        `yaml:"base_url"` // Ark接口地址
+	Region  string        `yaml:"region"`   // Ark地域，如cn-beijing
+	APIKey  string        `yaml:"-"`        // 只从环境变量ARK_API_KEY读取，不写入配置文件
+	Mock    bool          `yaml:"mock"`     // 使用mock数据，不实际调用Ark
+	Timeout time.Duration `yaml:"timeout"`  // 普通请求（对话、提示词生成）的超时时间
+	Retry   RetryConfig   `yaml:"retry"`
+}
+
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"` // 最大尝试次数（含首次）
+	BaseDelay   time.Duration `yaml:"base_delay"`   // 首次重试前的等待时间
+	MaxDelay    time.Duration `yaml:"max_delay"`    // 单次等待的上限
+}
+
+// ModelsConfig 模型别名及各环节使用的模型，各环节的取值必须是Aliases中的别名
+// Specs默认为内置模型的能力描述，配置文件中的同名项整体替换内置描述，新增的别名需同时设置Aliases和Specs
+type ModelsConfig struct {
+	Aliases      map[string]string    `yaml:"aliases"`       // 模型别名 -> 推理接入点ID
+	Specs        map[string]ModelSpec `yaml:"specs"`         // 模型别名 -> 能力描述
+	Chat         string               `yaml:"chat"`          // 故事、提示词生成
+	Image        string               `yaml:"image"`         // 章节插图生成
+	Video        string               `yaml:"video"`         // 整体视频生成
+	ChapterVideo string               `yaml:"chapter_video"` // 章节视频生成
+	ToolVideo    string               `yaml:"tool_video"`    // 视频生成工具
+}
+
+type ImageConfig struct {
+	Size        string        `yaml:"size"`        // 插图分辨率，如2304x1728
+	MaxImages   int           `yaml:"max_images"`  // 每章生成的图片数
+	Timeout     time.Duration `yaml:"timeout"`     // 单次图片生成请求超时时间
+	Concurrency int           `yaml:"concurrency"` // 同时生成图片的章节数
+}
+
+type VideoConfig struct {
+	ChapterDuration int           `yaml:"chapter_duration"` // 章节视频时长（秒）
+	StoryDuration   int           `yaml:"story_duration"`   // 整体视频时长（秒）
+	Timeout         time.Duration `yaml:"timeout"`          // 视频接口请求超时时间
+	PollInterval    time.Duration `yaml:"poll_interval"`    // 视频任务轮询间隔
+	TaskTimeout     time.Duration `yaml:"task_timeout"`     // 等待单个视频任务结束的超时时间
+	Concurrency     int           `yaml:"concurrency"`      // 同时生成视频的章节数
+	Compose         ComposeConfig `yaml:"compose"`          // 章节视频合成为故事视频的参数
+}
+
+// 字幕方式
+const (
+	SubtitlesBurn = "burn" // 烧录到画面
+	SubtitlesMux  = "mux"  // 作为独立字幕轨
+	SubtitlesNone = "none" // 不生成字幕
+)
+
+// ComposeConfig 章节视频合成配置，章节视频统一转码后加转场、字幕、背景音乐和标题卡
+type ComposeConfig struct {
+	Width         int           `yaml:"width"`          // 输出宽度
+	Height        int           `yaml:"height"`         // 输出高度，比例不同的章节视频补黑边
+	FPS           int           `yaml:"fps"`            // 输出帧率
+	CRF           int           `yaml:"crf"`            // x264质量参数，越小质量越高
+	Preset        string        `yaml:"preset"`         // x264编码速度预设
+	Transition    time.Duration `yaml:"transition"`     // 章节间交叉淡化时长，0为直接切换
+	Subtitles     string        `yaml:"subtitles"`      // 字幕方式：burn、mux、none
+	FontFile      string        `yaml:"font_file"`      // 标题卡和烧录字幕使用的字体文件，需包含中文字形
+	TitleDuration time.Duration `yaml:"title_duration"` // 故事主题标题卡时长，0为不加标题卡
+	BGM           string        `yaml:"bgm"`            // 背景音乐文件，为空时不加
+	BGMVolume     float64       `yaml:"bgm_volume"`     // 背景音乐音量，1为原始音量
+	Ducking       bool          `yaml:"ducking"`        // 章节视频有声音时自动压低背景音乐
+}
+
+type SessionConfig struct {
+	StoreDir      string        `yaml:"store_dir"`      // 会话持久化目录
+	TTL           time.Duration `yaml:"ttl"`            // 空闲会话保留时间
+	EvictInterval time.Duration `yaml:"evict_interval"` // 空闲会话清理间隔
+	EventLogSize  int           `yaml:"event_log_size"` // 每个会话保留的最近事件数，用于断线后按Last-Event-ID重放
+}
+
+// JobsConfig 异步视频生成任务配置
+type JobsConfig struct {
+	StoreDir         string        `yaml:"store_dir"`         // 任务记录持久化目录
+	PollInterval     time.Duration `yaml:"poll_interval"`     // 首次轮询间隔，之后按退避逐步增大
+	MaxPollInterval  time.Duration `yaml:"max_poll_interval"` // 轮询间隔上限
+	Timeout          time.Duration `yaml:"timeout"`           // 任务超过该时长仍未结束则标记为失败
+	CallbackSecret   string        `yaml:"-"`                 // 回调签名密钥，只从环境变量JOB_CALLBACK_SECRET读取
+	CallbackTimeout  time.Duration `yaml:"callback_timeout"`  // 单次回调请求超时时间
+	CallbackAttempts int           `yaml:"callback_attempts"` // 回调最大尝试次数
+	Retention        time.Duration `yaml:"retention"`         // 已结束任务的保留时间，超过后删除任务记录
+	PruneInterval    time.Duration `yaml:"prune_interval"`    // 过期任务清理间隔
+}
+
+// 生成资源的存储方式
+const (
+	AssetDriverLocal = "local"
+	AssetDriverS3    = "s3"
+)
+
+// AssetsConfig 生成的图片、视频的持久化存储配置
+type AssetsConfig struct {
+	Driver string            `yaml:"driver"` // 存储方式：local或s3
+	Local  LocalAssetsConfig `yaml:"local"`
+	S3     S3AssetsConfig    `yaml:"s3"`
+}
+
+type LocalAssetsConfig struct {
+	Dir     string `yaml:"dir"`      // 资源保存目录
+	BaseURL string `yaml:"base_url"` // 资源访问地址前缀，由/api/assets接口提供
+}
+
+// RoutePath 资源下载接口的路由前缀，取自BaseURL的路径部分，不合法时返回空
+func (c LocalAssetsConfig) RoutePath() string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	p := strings.TrimRight(u.Path, "/")
+	if !strings.HasPrefix(p, "/") {
+		return ""
+	}
+	return p
+}
+
+// S3AssetsConfig S3兼容存储配置，使用path-style地址访问bucket
+type S3AssetsConfig struct {
+	Endpoint  string `yaml:"endpoint"`   // 服务地址，如http://127.0.0.1:9000
+	Region    string `yaml:"region"`     // 签名使用的区域
+	Bucket    string `yaml:"bucket"`     // 存储桶
+	AccessKey string `yaml:"-"`          // 只从环境变量S3_ACCESS_KEY读取
+	SecretKey string `yaml:"-"`          // 只从环境变量S3_SECRET_KEY读取
+	PublicURL string `yaml:"public_url"` // 资源对外访问地址前缀，默认为<endpoint>/<bucket>
+}
+
+// DownloadConfig 下载生成资源（模型返回的图片、视频及合成用的章节视频）的配置
+type DownloadConfig struct {
+	Timeout     time.Duration `yaml:"timeout"`     // 单次下载请求的超时时间
+	MaxBytes    int64         `yaml:"max_bytes"`   // 单个资源的大小上限，0为不限制
+	Attempts    int           `yaml:"attempts"`    // 最大尝试次数，重试时用Range从已下载的位置继续
+	RetryDelay  time.Duration `yaml:"retry_delay"` // 首次重试间隔，之后逐次翻倍
+	Concurrency int           `yaml:"concurrency"` // 同时下载的资源数
+	CacheDir    string        `yaml:"cache_dir"`   // 按URL缓存下载结果的目录，为空时不缓存
+	CacheTTL    time.Duration `yaml:"cache_ttl"`   // 缓存保留时间
+}
+
+// ExportConfig 导出绘本PDF、EPUB的配置
+type ExportConfig struct {
+	FontFile string `yaml:"font_file"` // 嵌入EPUB、PDF的中文字体文件（ttf/otf/woff2），PDF只能嵌入TrueType轮廓，否则使用阅读器内置字体
+}
+
+// Default 默认配置
+func Default() *Config {
+	cfg := &Config{
+		Server: ServerConfig{Addr: ":8080"},
+		Log:    LogConfig{File: "app.log"},
+		Ark: ArkConfig{
+			BaseURL: "https://ark.cn-beijing.volces.com",
+			Region:  "cn-beijing",
+			Timeout: 30 * time.Second,
+			Retry: RetryConfig{
+				MaxAttempts: 4,
+				BaseDelay:   500 * time.Millisecond,
+				MaxDelay:    20 * time.Second,
+			},
+		},
+		Models: ModelsConfig{
+			Aliases: map[string]string{
+				"doubao-chat":   "ep-20250220181854-c8s82",
+				"seedream":      "ep-20251124201143-rwjnq",
+				"seedance1.0":   "ep-20260107003549-kcrmk",
+				"seedance2.0":   "ep-20260305130909-qnwqm",
+				"seedance-tool": "ep-20251124201423-clr5b",
+			},
+			Specs:        builtinModelSpecs(),
+			Chat:         "doubao-chat",
+			Image:        "seedream",
+			Video:        "seedance1.0",
+			ChapterVideo: "seedance2.0",
+			ToolVideo:    "seedance-tool",
+		},
+		Image: ImageConfig{
+			Size:        "2304x1728",
+			MaxImages:   1,
+			Timeout:     180 * time.Second,
+			Concurrency: 3,
+		},
+		Video: VideoConfig{
+			ChapterDuration: 10,
+			StoryDuration:   12,
+			Timeout:         300 * time.Second,
+			PollInterval:    5 * time.Second,
+			TaskTimeout:     10 * time.Minute,
+			Concurrency:     4,
+			Compose: ComposeConfig{
+				Width:         1280,
+				Height:        720,
+				FPS:           24,
+				CRF:           20,
+				Preset:        "medium",
+				Transition:    500 * time.Millisecond,
+				Subtitles:     SubtitlesMux,
+				TitleDuration: 3 * time.Second,
+				BGMVolume:     0.3,
+				Ducking:       true,
+			},
+		},
+		Session: SessionConfig{
+			StoreDir:      "data/sessions",
+			TTL:           24 * time.Hour,
+			EvictInterval: 10 * time.Minute,
+			EventLogSize:  1000,
+		},
+		Jobs: JobsConfig{
+			StoreDir:         "data/jobs",
+			PollInterval:     5 * time.Second,
+			MaxPollInterval:  time.Minute,
+			Timeout:          30 * time.Minute,
+			CallbackTimeout:  10 * time.Second,
+			CallbackAttempts: 3,
+			Retention:        7 * 24 * time.Hour,
+			PruneInterval:    time.Hour,
+		},
+		Assets: AssetsConfig{
+			Driver: AssetDriverLocal,
+			Local: LocalAssetsConfig{
+				Dir:     "data/assets",
+				BaseURL: "/api/assets",
+			},
+			S3: S3AssetsConfig{
+				Region: "us-east-1",
+			},
+		},
+		Download: DownloadConfig{
+			Timeout:     5 * time.Minute,
+			MaxBytes:    512 << 20,
+			Attempts:    3,
+			RetryDelay:  time.Second,
+			Concurrency: 4,
+			CacheDir:    "data/cache/downloads",
+			CacheTTL:    24 * time.Hour,
+		},
+	}
+	registry, err := NewModelRegistry(cfg.Models)
+	if err != nil {
+		panic(fmt.Sprintf("invalid builtin models: %v", err))
+	}
+	cfg.registry = registry
+	return cfg
+}
+
+// Load 加载配置：默认值 <- 配置文件（path为空时跳过） <- 环境变量，并校验
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	registry, err := NewModelRegistry(cfg.Models)
+	if err != nil {
+		return nil, err
+	}
+	cfg.registry = registry
+	return cfg, nil
+}
+
+// Registry 返回由models.aliases和models.specs构建的模型注册表
+func (c *Config) Registry() *ModelRegistry {
+	return c.registry
+}
+
+// applyEnv 环境变量覆盖配置文件
+func (c *Config) applyEnv() error {
+	var errs []error
+	setString := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	setInt := func(key string, dst *int) {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid integer %q", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	setDuration := func(key string, dst *time.Duration) {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid duration %q", key, v))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	setString("SERVER_ADDR", &c.Server.Addr)
+	setString("LOG_FILE", &c.Log.File)
+	setString("ARK_API_KEY", &c.Ark.APIKey)
+	setString("ARK_BASE_URL", &c.Ark.BaseURL)
+	setString("ARK_REGION", &c.Ark.Region)
+	if v := strings.ToLower(os.Getenv("ARK_MOCK")); v != "" {
+		c.Ark.Mock = v == "1" || v == "true"
+	}
+	setDuration("ARK_TIMEOUT", &c.Ark.Timeout)
+	setString("IMAGE_SIZE", &c.Image.Size)
+	setInt("IMAGE_GEN_CONCURRENCY", &c.Image.Concurrency)
+	setInt("VIDEO_CHAPTER_DURATION", &c.Video.ChapterDuration)
+	setInt("VIDEO_GEN_CONCURRENCY", &c.Video.Concurrency)
+	setString("VIDEO_SUBTITLES", &c.Video.Compose.Subtitles)
+	setString("VIDEO_FONT_FILE", &c.Video.Compose.FontFile)
+	setString("VIDEO_BGM", &c.Video.Compose.BGM)
+	setString("SESSION_STORE_DIR", &c.Session.StoreDir)
+	setDuration("SESSION_TTL", &c.Session.TTL)
+	setString("JOB_STORE_DIR", &c.Jobs.StoreDir)
+	setString("JOB_CALLBACK_SECRET", &c.Jobs.CallbackSecret)
+	setString("ASSET_DRIVER", &c.Assets.Driver)
+	setString("ASSET_DIR", &c.Assets.Local.Dir)
+	setString("S3_ENDPOINT", &c.Assets.S3.Endpoint)
+	setString("S3_REGION", &c.Assets.S3.Region)
+	setString("S3_BUCKET", &c.Assets.S3.Bucket)
+	setString("S3_ACCESS_KEY", &c.Assets.S3.AccessKey)
+	setString("S3_SECRET_KEY", &c.Assets.S3.SecretKey)
+	setString("S3_PUBLIC_URL", &c.Assets.S3.PublicURL)
+	setString("DOWNLOAD_CACHE_DIR", &c.Download.CacheDir)
+	setString("EXPORT_FONT_FILE", &c.Export.FontFile)
+	return errors.Join(errs...)
+}
+
+// Validate 校验配置，返回所有不合法的配置项
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Log.File != "", "log.file is required")
+	check(strings.HasPrefix(c.Ark.BaseURL, "http://") || strings.HasPrefix(c.Ark.BaseURL, "https://"),
+		"ark.base_url must be an http(s) url, got %q", c.Ark.BaseURL)
+	check(c.Ark.Region != "", "ark.region is required")
+	check(c.Ark.APIKey != "" || c.Ark.Mock, "ARK_API_KEY is required unless ark.mock is enabled")
+	check(c.Ark.Timeout > 0, "ark.timeout must be positive")
+	check(c.Ark.Retry.MaxAttempts >= 1, "ark.retry.max_attempts must be >= 1")
+	check(c.Ark.Retry.BaseDelay >= 0 && c.Ark.Retry.MaxDelay >= c.Ark.Retry.BaseDelay,
+		"ark.retry.max_delay must be >= ark.retry.base_delay >= 0")
+
+	for alias, endpoint := range c.Models.Aliases {
+		check(endpoint != "", "models.aliases.%s: endpoint id is required", alias)
+	}
+	registry, err := NewModelRegistry(c.Models)
+	if err != nil {
+		errs = append(errs, err)
+		registry = &ModelRegistry{}
+	}
+	roleSpec := func(role, alias string, kind ModelKind) *ModelSpec {
+		spec, ok := registry.Get(alias)
+		if !ok {
+			check(false, "models.%s: unknown model alias %q", role, alias)
+			return nil
+		}
+		check(spec.Kind == kind, "models.%s: %q is a %s model, want %s", role, alias, spec.Kind, kind)
+		return spec
+	}
+	roleSpec("chat", c.Models.Chat, ModelKindChat)
+	roleSpec("tool_video", c.Models.ToolVideo, ModelKindVideo)
+	if spec := roleSpec("image", c.Models.Image, ModelKindImage); spec != nil {
+		check(spec.SupportsSize(c.Image.Size), "image.size: %q is not supported by %s", c.Image.Size, spec.Alias)
+		check(c.Image.MaxImages <= spec.MaxImages, "image.max_images: %s generates at most %d images", spec.Alias, spec.MaxImages)
+	}
+	if spec := roleSpec("video", c.Models.Video, ModelKindVideo); spec != nil {
+		check(c.Video.StoryDuration >= spec.MinDuration && c.Video.StoryDuration <= spec.MaxDuration,
+			"video.story_duration: %s supports %d-%d seconds", spec.Alias, spec.MinDuration, spec.MaxDuration)
+	}
+	if spec := roleSpec("chapter_video", c.Models.ChapterVideo, ModelKindVideo); spec != nil {
+		check(spec.SupportsRelyType(RelyTypeFirstFrame), "models.chapter_video: %s does not support %s", spec.Alias, RelyTypeFirstFrame)
+		check(c.Video.ChapterDuration >= spec.MinDuration && c.Video.ChapterDuration <= spec.MaxDuration,
+			"video.chapter_duration: %s supports %d-%d seconds", spec.Alias, spec.MinDuration, spec.MaxDuration)
+	}
+
+	check(c.Image.Size != "", "image.size is required")
+	check(c.Image.MaxImages >= 1, "image.max_images must be >= 1")
+	check(c.Image.Timeout > 0, "image.timeout must be positive")
+	check(c.Image.Concurrency >= 1, "image.concurrency must be >= 1")
+
+	check(c.Video.ChapterDuration > 0, "video.chapter_duration must be positive")
+	check(c.Video.StoryDuration > 0, "video.story_duration must be positive")
+	check(c.Video.Timeout > 0, "video.timeout must be positive")
+	check(c.Video.PollInterval > 0, "video.poll_interval must be positive")
+	check(c.Video.TaskTimeout > 0, "video.task_timeout must be positive")
+	check(c.Video.Concurrency >= 1, "video.concurrency must be >= 1")
+	compose := c.Video.Compose
+	check(compose.Width > 0 && compose.Height > 0 && compose.Width%2 == 0 && compose.Height%2 == 0,
+		"video.compose.width and height must be positive even numbers, got %dx%d", compose.Width, compose.Height)
+	check(compose.FPS > 0, "video.compose.fps must be positive")
+	check(compose.CRF >= 0 && compose.CRF <= 51, "video.compose.crf must be within 0-51")
+	check(compose.Preset != "", "video.compose.preset is required")
+	check(compose.Transition >= 0, "video.compose.transition must be >= 0")
+	check(compose.TitleDuration >= 0, "video.compose.title_duration must be >= 0")
+	check(compose.Subtitles == SubtitlesBurn || compose.Subtitles == SubtitlesMux || compose.Subtitles == SubtitlesNone,
+		"video.compose.subtitles must be one of burn, mux, none, got %q", compose.Subtitles)
+	check(compose.BGMVolume >= 0, "video.compose.bgm_volume must be >= 0")
+
+	check(c.Session.StoreDir != "", "session.store_dir is required")
+	check(c.Session.TTL > 0, "session.ttl must be positive")
+	check(c.Session.EvictInterval > 0, "session.evict_interval must be positive")
+	check(c.Session.EventLogSize > 0, "session.event_log_size must be positive")
+
+	check(c.Jobs.StoreDir != "", "jobs.store_dir is required")
+	check(c.Jobs.PollInterval > 0 && c.Jobs.MaxPollInterval >= c.Jobs.PollInterval,
+		"jobs.max_poll_interval must be >= jobs.poll_interval > 0")
+	check(c.Jobs.Timeout > 0, "jobs.timeout must be positive")
+	check(c.Jobs.CallbackTimeout > 0, "jobs.callback_timeout must be positive")
+	check(c.Jobs.CallbackAttempts >= 1, "jobs.callback_attempts must be >= 1")
+	check(c.Jobs.Retention > 0, "jobs.retention must be positive")
+	check(c.Jobs.PruneInterval > 0, "jobs.prune_interval must be positive")
+
+	switch c.Assets.Driver {
+	case AssetDriverLocal:
+		check(c.Assets.Local.Dir != "", "assets.local.dir is required")
+		check(c.Assets.Local.RoutePath() != "", "assets.local.base_url must be a path such as /api/assets or a url with such a path, got %q", c.Assets.Local.BaseURL)
+	case AssetDriverS3:
+		s3 := c.Assets.S3
+		check(strings.HasPrefix(s3.Endpoint, "http://") || strings.HasPrefix(s3.Endpoint, "https://"),
+			"assets.s3.endpoint must be an http(s) url, got %q", s3.Endpoint)
+		check(s3.Region != "", "assets.s3.region is required")
+		check(s3.Bucket != "", "assets.s3.bucket is required")
+		check(s3.AccessKey != "" && s3.SecretKey != "", "S3_ACCESS_KEY and S3_SECRET_KEY are required for the s3 asset driver")
+	default:
+		check(false, "assets.driver: unsupported driver %q, use %s or %s", c.Assets.Driver, AssetDriverLocal, AssetDriverS3)
+	}
+
+	check(c.Download.Timeout > 0, "download.timeout must be positive")
+	check(c.Download.MaxBytes >= 0, "download.max_bytes must be >= 0")
+	check(c.Download.Attempts >= 1, "download.attempts must be >= 1")
+	check(c.Download.RetryDelay >= 0, "download.retry_delay must be >= 0")
+	check(c.Download.Concurrency >= 1, "download.concurrency must be >= 1")
+	check(c.Download.CacheDir == "" || c.Download.CacheTTL > 0, "download.cache_ttl must be positive when download.cache_dir is set")
+
+	if c.Export.FontFile != "" {
+		ext := strings.ToLower(filepath.Ext(c.Export.FontFile))
+		check(ext == ".ttf" || ext == ".otf" || ext == ".woff2", "export.font_file must be a ttf, otf or woff2 font, got %q", c.Export.FontFile)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Endpoint 返回模型别名对应的推理接入点ID
+func (m ModelsConfig) Endpoint(alias string) string {
+	return m.Aliases[alias]
+}
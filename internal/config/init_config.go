@@ -1,17 +1,32 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 )
 
-func InitConfig() {
-	logPath := filepath.Join(".", "app.log")
-	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+const defaultConfigFile = "config.yaml"
+
+// InitConfig 加载配置并初始化日志
+// 配置文件路径由环境变量CONFIG_FILE指定，未指定时若当前目录存在config.yaml则加载，否则使用默认配置
+func InitConfig() (*Config, error) {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			path = defaultConfigFile
+		}
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.OpenFile(cfg.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
-		log.Fatalf("failed to open log file: %v", err)
+		return nil, fmt.Errorf("failed to open log file: %w", err)
 	}
 	log.SetOutput(logFile)
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	return cfg, nil
 }
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ModelKind 模型类型
+type ModelKind string
+
+const (
+	ModelKindChat  ModelKind = "chat"
+	ModelKindImage ModelKind = "image"
+	ModelKindVideo ModelKind = "video"
+)
+
+// 视频生成的图片依赖方式
+const (
+	RelyTypeFirstFrame     = "首帧"
+	RelyTypeFirstLastFrame = "首尾帧"
+	RelyTypeReference      = "参考图"
+)
+
+// ModelSpec 模型能力描述，可在配置文件的models.specs中按别名设置
+type ModelSpec struct {
+	Alias              string    `json:"alias" yaml:"-"`                                             // 模型别名
+	Kind               ModelKind `json:"kind" yaml:"kind"`                                           // 模型类型
+	Endpoint           string    `json:"endpoint" yaml:"-"`                                          // 推理接入点ID
+	Sizes              []string  `json:"sizes,omitempty" yaml:"sizes"`                               // 支持的图片尺寸预设，如2K
+	CustomSize         bool      `json:"custom_size,omitempty" yaml:"custom_size"`                   // 是否支持WxH形式的自定义尺寸
+	MinPixels          int       `json:"min_pixels,omitempty" yaml:"min_pixels"`                     // 自定义尺寸的最小像素数
+	MaxPixels          int       `json:"max_pixels,omitempty" yaml:"max_pixels"`                     // 自定义尺寸的最大像素数
+	MaxImages          int       `json:"max_images,omitempty" yaml:"max_images"`                     // 单次最多生成的图片数
+	RelyTypes          []string  `json:"rely_types,omitempty" yaml:"rely_types"`                     // 支持的图片依赖方式：首帧、首尾帧、参考图
+	MaxReferenceImages int       `json:"max_reference_images,omitempty" yaml:"max_reference_images"` // 最多输入的参考图数量
+	Resolutions        []string  `json:"resolutions,omitempty" yaml:"resolutions"`                   // 支持的视频分辨率
+	Ratios             []string  `json:"ratios,omitempty" yaml:"ratios"`                             // 支持的视频宽高比
+	MinDuration        int       `json:"min_duration,omitempty" yaml:"min_duration"`                 // 最短视频时长（秒）
+	MaxDuration        int       `json:"max_duration,omitempty" yaml:"max_duration"`                 // 最长视频时长（秒）
+	Audio              bool      `json:"audio" yaml:"audio"`                                         // 是否支持生成音频
+}
+
+// SupportsSize 判断图片尺寸是否受支持
+func (m *ModelSpec) SupportsSize(size string) bool {
+	if slices.Contains(m.Sizes, size) {
+		return true
+	}
+	if !m.CustomSize {
+		return false
+	}
+	w, h, ok := ParseSize(size)
+	if !ok {
+		return false
+	}
+	return w*h >= m.MinPixels && (m.MaxPixels == 0 || w*h <= m.MaxPixels)
+}
+
+// SupportsRelyType 判断图片依赖方式是否受支持
+func (m *ModelSpec) SupportsRelyType(relyType string) bool {
+	return slices.Contains(m.RelyTypes, relyType)
+}
+
+// ParseSize 解析WxH形式的尺寸
+func ParseSize(size string) (w, h int, ok bool) {
+	ws, hs, found := strings.Cut(strings.ToLower(size), "x")
+	if !found {
+		return 0, 0, false
+	}
+	w, err1 := strconv.Atoi(ws)
+	h, err2 := strconv.Atoi(hs)
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return 0, 0, false
+	}
+	return w, h, true
+}
+
+// builtinModelSpecs 内置的模型能力描述，作为models.specs的默认值，key为模型别名
+func builtinModelSpecs() map[string]ModelSpec {
+	seedance := func(maxDuration int, audio bool, relyTypes ...string) ModelSpec {
+		return ModelSpec{
+			Kind:               ModelKindVideo,
+			RelyTypes:          relyTypes,
+			MaxReferenceImages: 4,
+			Resolutions:        []string{"480p", "720p", "1080p"},
+			Ratios:             []string{"16:9", "4:3", "1:1", "3:4", "9:16", "21:9", "adaptive"},
+			MinDuration:        2,
+			MaxDuration:        maxDuration,
+			Audio:              audio,
+		}
+	}
+	seedance2 := seedance(15, true, RelyTypeFirstFrame, RelyTypeFirstLastFrame, RelyTypeReference)
+	seedance2.MaxReferenceImages = 9
+	seedance2.MinDuration = 4
+	seedance2.Resolutions = []string{"480p", "720p"}
+
+	return map[string]ModelSpec{
+		"doubao-chat": {Kind: ModelKindChat},
+		"seedream": {
+			Kind:               ModelKindImage,
+			Sizes:              []string{"1K", "2K", "4K"},
+			CustomSize:         true,
+			MinPixels:          1280 * 720,
+			MaxPixels:          4096 * 4096,
+			MaxImages:          15,
+			MaxReferenceImages: 10,
+		},
+		"seedance1.0":   seedance(12, false, RelyTypeFirstFrame, RelyTypeFirstLastFrame, RelyTypeReference),
+		"seedance2.0":   seedance2,
+		"seedance-tool": seedance(12, false, RelyTypeFirstFrame, RelyTypeFirstLastFrame, RelyTypeReference),
+	}
+}
+
+// ModelRegistry 模型注册表，直接生成接口和agent共用
+type ModelRegistry struct {
+	specs map[string]*ModelSpec
+}
+
+// NewModelRegistry 根据models.aliases和models.specs创建注册表，每个别名都需要能力描述
+func NewModelRegistry(models ModelsConfig) (*ModelRegistry, error) {
+	var errs []error
+	r := &ModelRegistry{specs: make(map[string]*ModelSpec, len(models.Aliases))}
+	for _, alias := range slices.Sorted(maps.Keys(models.Aliases)) {
+		spec, ok := models.Specs[alias]
+		if !ok {
+			errs = append(errs, fmt.Errorf("models.aliases.%s: no capability description, add models.specs.%s", alias, alias))
+			continue
+		}
+		if err := spec.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("models.specs.%s: %w", alias, err))
+			continue
+		}
+		spec.Alias = alias
+		spec.Endpoint = models.Aliases[alias]
+		r.specs[alias] = &spec
+	}
+	for _, alias := range slices.Sorted(maps.Keys(models.Specs)) {
+		if _, ok := models.Aliases[alias]; !ok {
+			errs = append(errs, fmt.Errorf("models.specs.%s: no endpoint in models.aliases", alias))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return r, nil
+}
+
+// validate 校验能力描述本身是否合理
+func (m *ModelSpec) validate() error {
+	switch m.Kind {
+	case ModelKindChat:
+	case ModelKindImage:
+		if m.MaxImages < 1 {
+			return errors.New("max_images must be >= 1")
+		}
+		if len(m.Sizes) == 0 && !m.CustomSize {
+			return errors.New("sizes or custom_size is required")
+		}
+		if m.MaxPixels != 0 && m.MaxPixels < m.MinPixels {
+			return errors.New("max_pixels must be >= min_pixels")
+		}
+	case ModelKindVideo:
+		if m.MinDuration < 1 || m.MaxDuration < m.MinDuration {
+			return fmt.Errorf("duration range %d-%d is invalid", m.MinDuration, m.MaxDuration)
+		}
+		for _, relyType := range m.RelyTypes {
+			if relyType != RelyTypeFirstFrame && relyType != RelyTypeFirstLastFrame && relyType != RelyTypeReference {
+				return fmt.Errorf("unknown rely type %q, use %s, %s or %s", relyType, RelyTypeFirstFrame, RelyTypeFirstLastFrame, RelyTypeReference)
+			}
+		}
+		if m.SupportsRelyType(RelyTypeReference) && m.MaxReferenceImages < 1 {
+			return errors.New("max_reference_images must be >= 1 when 参考图 is supported")
+		}
+	default:
+		return fmt.Errorf("kind must be one of %s, %s, %s, got %q", ModelKindChat, ModelKindImage, ModelKindVideo, m.Kind)
+	}
+	return nil
+}
+
+// Get 按别名获取模型
+func (r *ModelRegistry) Get(alias string) (*ModelSpec, bool) {
+	spec, ok := r.specs[alias]
+	return spec, ok
+}
+
+// Resolve 按别名或推理接入点ID获取模型
+func (r *ModelRegistry) Resolve(name string) (*ModelSpec, bool) {
+	if spec, ok := r.specs[name]; ok {
+		return spec, true
+	}
+	for _, spec := range r.specs {
+		if spec.Endpoint == name {
+			return spec, true
+		}
+	}
+	return nil, false
+}
+
+// List 按类型、别名排序返回所有模型
+func (r *ModelRegistry) List() []*ModelSpec {
+	list := make([]*ModelSpec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		list = append(list, spec)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind < list[j].Kind
+		}
+		return list[i].Alias < list[j].Alias
+	})
+	return list
+}
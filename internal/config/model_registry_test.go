@@ -0,0 +1,212 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultRegistry(t *testing.T) {
+	r := Default().Registry()
+	if r == nil {
+		t.Fatal("Default().Registry() is nil")
+	}
+	spec, ok := r.Get("seedance2.0")
+	if !ok || spec.Alias != "seedance2.0" || spec.Endpoint != "ep-20260305130909-qnwqm" || spec.MaxReferenceImages != 9 {
+		t.Errorf("Get(seedance2.0) = %+v, %v", spec, ok)
+	}
+	if _, ok := r.Get("ep-20260305130909-qnwqm"); ok {
+		t.Error("Get resolves endpoint ids")
+	}
+
+	for name, want := range map[string]string{
+		"seedream":                "seedream",
+		"ep-20251124201143-rwjnq": "seedream",
+		"seedance1.0":             "seedance1.0",
+		"ep-20260107003549-kcrmk": "seedance1.0",
+		"unknown":                 "",
+	} {
+		spec, ok := r.Resolve(name)
+		if ok != (want != "") || (ok && spec.Alias != want) {
+			t.Errorf("Resolve(%s) = %+v, %v, want %q", name, spec, ok, want)
+		}
+	}
+
+	var got []string
+	for _, spec := range r.List() {
+		got = append(got, string(spec.Kind)+"/"+spec.Alias)
+	}
+	want := "chat/doubao-chat image/seedream video/seedance-tool video/seedance1.0 video/seedance2.0"
+	if strings.Join(got, " ") != want {
+		t.Errorf("List = %v, want %s", got, want)
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadModelSpecs(t *testing.T) {
+	t.Setenv("ARK_API_KEY", "test")
+	cfg, err := Load(writeConfig(t, `
+models:
+  aliases:
+    seedance-lite: ep-lite
+  specs:
+    seedance-lite:
+      kind: video
+      rely_types: [首帧, 首尾帧]
+      resolutions: [480p, 720p]
+      ratios: ["16:9"]
+      min_duration: 3
+      max_duration: 10
+    seedream:
+      kind: image
+      sizes: [2K]
+      max_images: 2
+  chapter_video: seedance-lite
+image:
+  size: 2K
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := cfg.Registry()
+	lite, ok := r.Resolve("ep-lite")
+	if !ok || lite.Alias != "seedance-lite" || lite.Kind != ModelKindVideo || lite.MinDuration != 3 || lite.MaxDuration != 10 ||
+		!lite.SupportsRelyType(RelyTypeFirstLastFrame) || lite.SupportsRelyType(RelyTypeReference) {
+		t.Errorf("seedance-lite = %+v, %v", lite, ok)
+	}
+	// 配置的同名项整体替换内置描述
+	seedream, _ := r.Get("seedream")
+	if seedream.MaxImages != 2 || seedream.CustomSize || seedream.SupportsSize("2304x1728") || seedream.Endpoint != "ep-20251124201143-rwjnq" {
+		t.Errorf("seedream = %+v", seedream)
+	}
+	// 未配置的内置模型保持默认
+	if spec, ok := r.Get("seedance2.0"); !ok || spec.MaxDuration != 15 {
+		t.Errorf("seedance2.0 = %+v, %v", spec, ok)
+	}
+}
+
+func TestLoadModelSpecsErrors(t *testing.T) {
+	t.Setenv("ARK_API_KEY", "test")
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{"alias without spec", `
+models:
+  aliases:
+    new-model: ep-new
+`, []string{"models.aliases.new-model: no capability description, add models.specs.new-model"}},
+		{"spec without alias", `
+models:
+  specs:
+    orphan:
+      kind: chat
+`, []string{"models.specs.orphan: no endpoint in models.aliases"}},
+		{"invalid specs", `
+models:
+  aliases:
+    a: ep-a
+    b: ep-b
+    c: ep-c
+  specs:
+    a:
+      kind: audio
+    b:
+      kind: video
+      min_duration: 10
+      max_duration: 5
+    c:
+      kind: video
+      rely_types: [尾帧]
+      min_duration: 2
+      max_duration: 5
+`, []string{"models.specs.a: kind must be one of", "models.specs.b: duration range 10-5", `models.specs.c: unknown rely type "尾帧"`}},
+		{"capability checks", `
+models:
+  chat: seedream
+  image: seedream
+  chapter_video: seedance1.0
+image:
+  size: 100x100
+  max_images: 20
+video:
+  chapter_duration: 13
+`, []string{
+			`models.chat: "seedream" is a image model, want chat`,
+			`image.size: "100x100" is not supported by seedream`,
+			"image.max_images: seedream generates at most 15 images",
+			"video.chapter_duration: seedance1.0 supports 2-12 seconds",
+		}},
+		{"unknown role alias", `
+models:
+  video: missing
+`, []string{`models.video: unknown model alias "missing"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.yaml))
+			if err == nil {
+				t.Fatal("Load: got nil error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not contain %q:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDefault(t *testing.T) {
+	cfg := Default()
+	cfg.Ark.APIKey = "test"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default config invalid: %v", err)
+	}
+	cfg.Ark.APIKey = ""
+	cfg.Video.Compose.Width = 1279
+	cfg.Download.Attempts = 0
+	err := cfg.Validate()
+	for _, want := range []string{"ARK_API_KEY is required", "video.compose.width and height must be positive even numbers", "download.attempts must be >= 1"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q: %v", want, err)
+		}
+	}
+}
+
+func TestSupportsSize(t *testing.T) {
+	spec := &ModelSpec{Kind: ModelKindImage, Sizes: []string{"2K"}, CustomSize: true, MinPixels: 1280 * 720, MaxPixels: 4096 * 4096}
+	fixed := &ModelSpec{Kind: ModelKindImage, Sizes: []string{"2K"}}
+	tests := []struct {
+		spec *ModelSpec
+		size string
+		want bool
+	}{
+		{spec, "2K", true},
+		{spec, "1280x720", true},
+		{spec, "2304X1728", true},
+		{spec, "4096x4096", true},
+		{spec, "1279x720", false},
+		{spec, "4097x4096", false},
+		{spec, "4K", false},
+		{spec, "x720", false},
+		{spec, "-1280x-720", false},
+		{fixed, "2K", true},
+		{fixed, "1280x720", false},
+	}
+	for _, tt := range tests {
+		if got := tt.spec.SupportsSize(tt.size); got != tt.want {
+			t.Errorf("SupportsSize(%s) with custom=%v = %v, want %v", tt.size, tt.spec.CustomSize, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package export
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 导出格式
+const (
+	FormatPDF  = "pdf"
+	FormatEPUB = "epub"
+)
+
+// Book 导出的绘本
+type Book struct {
+	ID       string    // 绘本标识，用于生成EPUB的唯一标识
+	Title    string    // 书名，即故事主题
+	Chapters []Chapter // 章节，每章导出为一个跨页
+}
+
+// Chapter 绘本的一章
+type Chapter struct {
+	Title   string
+	Content string
+	Image   *Image // 章节插图，为空时插图页只显示章节序号
+}
+
+// Image 插图的原始数据
+type Image struct {
+	Data []byte
+}
+
+// ContentType 按内容识别的图片类型
+func (img *Image) ContentType() string {
+	return http.DetectContentType(img.Data)
+}
+
+// Cover 封面图，使用第一张章节插图
+func (b *Book) Cover() *Image {
+	for _, c := range b.Chapters {
+		if c.Image != nil {
+			return c.Image
+		}
+	}
+	return nil
+}
+
+// ContentType 导出格式对应的Content-Type，格式不支持时返回false
+func ContentType(format string) (string, bool) {
+	switch format {
+	case FormatPDF:
+		return "application/pdf", true
+	case FormatEPUB:
+		return "application/epub+zip", true
+	default:
+		return "", false
+	}
+}
+
+// chapterLabel 章节序号，如第1章
+func chapterLabel(idx int) string {
+	return fmt.Sprintf("第%d章", idx+1)
+}
+
+// paragraphs 按换行拆分段落，去掉空段
+func paragraphs(content string) []string {
+	var list []string
+	for _, p := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
@@ -0,0 +1,248 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// epubFontStack 未嵌入字体时依次尝试阅读器和系统中常见的中文衬线字体
+const epubFontStack = `"Noto Serif CJK SC", "Source Han Serif SC", "Songti SC", "SimSun", serif`
+
+// epubFontTypes 可嵌入的字体格式
+var epubFontTypes = map[string]string{
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".woff2": "font/woff2",
+}
+
+// epubImageExts 插图类型对应的扩展名
+var epubImageExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// epubItem manifest中的一项
+type epubItem struct {
+	id         string
+	href       string
+	mediaType  string
+	properties string
+	spread     string // 在spine中的跨页位置，为空时不在spine中
+	data       []byte
+}
+
+// WriteEPUB 将绘本渲染为EPUB3：封面之后每章一个跨页，左页插图、右页标题和正文
+// fontFile非空时嵌入该字体（ttf/otf/woff2），否则使用阅读器自带的中文字体
+func WriteEPUB(w io.Writer, book *Book, fontFile string) error {
+	zw := zip.NewWriter(w)
+
+	// mimetype必须是第一个文件，不压缩且本地文件头中直接带有长度和校验和
+	mimetype := []byte("application/epub+zip")
+	mw, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(mimetype); err != nil {
+		return err
+	}
+
+	var items []epubItem
+	add := func(item epubItem, data []byte) {
+		item.data = data
+		items = append(items, item)
+	}
+
+	css := "body { font-family: " + epubFontStack + "; margin: 0 5%; line-height: 1.75; color: #333; }\n"
+	if fontFile != "" {
+		ext := strings.ToLower(filepath.Ext(fontFile))
+		mediaType, ok := epubFontTypes[ext]
+		if !ok {
+			return fmt.Errorf("unsupported font file %s", fontFile)
+		}
+		data, err := os.ReadFile(fontFile)
+		if err != nil {
+			return fmt.Errorf("read font file: %w", err)
+		}
+		add(epubItem{id: "font", href: "fonts/book" + ext, mediaType: mediaType}, data)
+		css = "@font-face { font-family: \"BookFont\"; src: url(\"fonts/book" + ext + "\"); }\n" +
+			strings.Replace(css, "font-family: ", "font-family: \"BookFont\", ", 1)
+	}
+	css += `h1 { font-size: 1.4em; text-align: center; margin: 1.5em 0 1em; }
+p { text-indent: 2em; margin: 0 0 0.5em; }
+.cover { margin: 0; text-align: center; }
+.cover h1 { margin: 1em 0; font-size: 2em; }
+.illustration { margin: 0; text-align: center; }
+.illustration img { max-width: 100%; max-height: 100vh; }
+.placeholder { font-size: 2em; text-align: center; margin-top: 40vh; }
+`
+	add(epubItem{id: "css", href: "style.css", mediaType: "text/css"}, []byte(css))
+
+	title := strings.TrimSpace(book.Title)
+	images := make(map[*Image]string)
+	addImage := func(img *Image, name, properties string) string {
+		if img == nil {
+			return ""
+		}
+		if href, ok := images[img]; ok {
+			return href
+		}
+		contentType := img.ContentType()
+		ext, ok := epubImageExts[contentType]
+		if !ok {
+			return ""
+		}
+		href := "images/" + name + ext
+		add(epubItem{id: name, href: href, mediaType: contentType, properties: properties}, img.Data)
+		images[img] = href
+		return href
+	}
+
+	// 封面
+	var cover strings.Builder
+	if href := addImage(book.Cover(), "cover", "cover-image"); href != "" {
+		fmt.Fprintf(&cover, "<div class=\"illustration\"><img src=\"%s\" alt=\"%s\"/></div>\n", href, xmlEscape(title))
+	}
+	fmt.Fprintf(&cover, "<h1>%s</h1>\n", xmlEscape(title))
+	add(epubItem{id: "cover-page", href: "cover.xhtml", mediaType: "application/xhtml+xml", spread: "right"},
+		epubPage(title, "cover", cover.String()))
+
+	var nav strings.Builder
+	for idx, chapter := range book.Chapters {
+		heading := strings.TrimSpace(chapter.Title)
+		if heading == "" {
+			heading = chapterLabel(idx)
+		}
+		name := fmt.Sprintf("chapter-%d", idx+1)
+
+		var left string
+		if href := addImage(chapter.Image, name+"-image", ""); href != "" {
+			left = fmt.Sprintf("<div class=\"illustration\"><img src=\"%s\" alt=\"%s\"/></div>\n", href, xmlEscape(heading))
+		} else {
+			left = fmt.Sprintf("<div class=\"placeholder\">%s</div>\n", xmlEscape(chapterLabel(idx)))
+		}
+		add(epubItem{id: name + "-illustration", href: name + "-image.xhtml", mediaType: "application/xhtml+xml", spread: "left"},
+			epubPage(heading, "", left))
+
+		var text strings.Builder
+		fmt.Fprintf(&text, "<h1>%s</h1>\n", xmlEscape(heading))
+		for _, p := range paragraphs(chapter.Content) {
+			fmt.Fprintf(&text, "<p>%s</p>\n", xmlEscape(p))
+		}
+		add(epubItem{id: name, href: name + ".xhtml", mediaType: "application/xhtml+xml", spread: "right"},
+			epubPage(heading, "", text.String()))
+		fmt.Fprintf(&nav, "      <li><a href=\"%s.xhtml\">%s</a></li>\n", name, xmlEscape(heading))
+	}
+
+	add(epubItem{id: "nav", href: "nav.xhtml", mediaType: "application/xhtml+xml", properties: "nav"}, []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="zh-CN" lang="zh-CN">
+<head>
+  <meta charset="UTF-8"/>
+  <title>%s</title>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>目录</h1>
+    <ol>
+      <li><a href="cover.xhtml">%s</a></li>
+%s    </ol>
+  </nav>
+</body>
+</html>
+`, xmlEscape(title), xmlEscape(title), nav.String())))
+
+	var manifest, spine strings.Builder
+	for _, item := range items {
+		props := ""
+		if item.properties != "" {
+			props = fmt.Sprintf(" properties=\"%s\"", item.properties)
+		}
+		fmt.Fprintf(&manifest, "    <item id=\"%s\" href=\"%s\" media-type=\"%s\"%s/>\n", item.id, item.href, item.mediaType, props)
+		if item.spread != "" {
+			fmt.Fprintf(&spine, "    <itemref idref=\"%s\" properties=\"page-spread-%s\"/>\n", item.id, item.spread)
+		}
+	}
+	opf := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="zh-CN">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">urn:uuid:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>zh-CN</dc:language>
+    <meta property="dcterms:modified">%s</meta>
+    <meta property="rendition:spread">landscape</meta>
+  </metadata>
+  <manifest>
+%s  </manifest>
+  <spine>
+%s  </spine>
+</package>
+`, uuid.NewSHA1(uuid.NameSpaceURL, []byte(book.ID)), xmlEscape(title), time.Now().UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+
+	entries := []epubItem{
+		{href: "META-INF/container.xml", data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`)},
+		{href: "OEBPS/content.opf", data: []byte(opf)},
+	}
+	for _, item := range items {
+		entries = append(entries, epubItem{href: "OEBPS/" + item.href, data: item.data})
+	}
+	for _, e := range entries {
+		fw, err := zw.Create(e.href)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// epubPage 一个XHTML页面
+func epubPage(title, bodyClass, body string) []byte {
+	class := ""
+	if bodyClass != "" {
+		class = fmt.Sprintf(" class=\"%s\"", bodyClass)
+	}
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="zh-CN" lang="zh-CN">
+<head>
+  <meta charset="UTF-8"/>
+  <title>%s</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body%s>
+%s</body>
+</html>
+`, xmlEscape(title), class, body))
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
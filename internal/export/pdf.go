@@ -0,0 +1,408 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// 页面尺寸（pt），4:3与生成的插图比例一致
+const (
+	pageWidth  = 720.0
+	pageHeight = 540.0
+	pageMargin = 54.0
+)
+
+const (
+	titleFontSize   = 22.0 // 章节标题字号
+	maxBodyFontSize = 16.0 // 正文字号，放不下时逐步缩小
+	minBodyFontSize = 11.0
+	lineSpacing     = 1.75 // 行高与字号之比
+)
+
+// lineStartForbidden 不能出现在行首的标点，排版时挂在上一行末尾
+const lineStartForbidden = "，。、！？；：”’）》」』】〕…,.!?;:)]}"
+
+// WritePDF 将绘本渲染为PDF：封面之后每章占一个跨页，左页插图、右页标题和正文；
+// 正文放不下时先缩小字号，仍放不下再续排到后续页面，并补空白页保证下一章插图在左页
+// fontFile为TrueType轮廓的ttf/otf时嵌入用到的字形子集；为空或是CFF轮廓的otf、woff2时
+// 使用阅读器内置的STSong-Light（Adobe-GB1字符集，UniGB-UTF16-H编码），不嵌入字体
+func WritePDF(w io.Writer, book *Book, fontFile string) error {
+	font, err := loadPDFFont(fontFile)
+	if err != nil {
+		return err
+	}
+	newPage := func() *pdfPage { return &pdfPage{font: font} }
+	doc := &pdfDoc{}
+	pagesID := doc.reserve()
+	fontID := doc.reserve() // 排版完成、确定用到的字形后写入
+	gsID := doc.add([]byte("<< /Type /ExtGState /ca 0.85 >>"))
+	images := make(map[*Image]pdfImage)
+	var pageIDs []int
+
+	addPage := func(p *pdfPage) {
+		var xobjects strings.Builder
+		for name, id := range p.images {
+			fmt.Fprintf(&xobjects, " /%s %d 0 R", name, id)
+		}
+		contentID := doc.add(doc.stream("", p.content.Bytes()))
+		pageIDs = append(pageIDs, doc.add([]byte(fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 %d 0 R >> /ExtGState << /GS1 %d 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>",
+			pagesID, num(pageWidth), num(pageHeight), fontID, gsID, xobjects.String(), contentID))))
+	}
+	// 封面与第一章共用同一个图片对象
+	addImage := func(img *Image) pdfImage {
+		if img == nil {
+			return pdfImage{}
+		}
+		if added, ok := images[img]; ok {
+			return added
+		}
+		data, width, height, err := pdfJPEG(img)
+		if err != nil {
+			log.Printf("skip image in pdf export: %v\n", err)
+			images[img] = pdfImage{}
+			return pdfImage{}
+		}
+		added := pdfImage{
+			id:     doc.add(doc.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", width, height), data)),
+			width:  width,
+			height: height,
+		}
+		images[img] = added
+		return added
+	}
+
+	// 封面
+	cover := newPage()
+	title := strings.TrimSpace(book.Title)
+	titleY := pageHeight / 2 // 书名的垂直中心，有封面图时放在底部的半透明横条中
+	if img := addImage(book.Cover()); img.id != 0 {
+		cover.image(img)
+		cover.fillRect(0, 60, pageWidth, 120, "1 1 1", true)
+		titleY = 120
+	} else {
+		cover.fillRect(0, 0, pageWidth, pageHeight, "0.96 0.94 0.90", false)
+	}
+	titleSize := 32.0
+	if tw := font.textWidth(title, 1); tw > 0 {
+		titleSize = max(min(titleSize, (pageWidth-2*pageMargin)/tw), 18)
+	}
+	titleLines := font.wrapParagraph(title, titleSize, pageWidth-2*pageMargin)
+	y := titleY + float64(len(titleLines))*titleSize*0.6 - titleSize*0.95
+	for _, line := range titleLines {
+		cover.textCentered(line, titleSize, y)
+		y -= titleSize * 1.2
+	}
+	addPage(cover)
+
+	for idx, chapter := range book.Chapters {
+		if len(pageIDs)%2 == 0 {
+			// 插图放在偶数页（左页）
+			addPage(newPage())
+		}
+
+		left := newPage()
+		if img := addImage(chapter.Image); img.id != 0 {
+			left.image(img)
+		} else {
+			left.fillRect(0, 0, pageWidth, pageHeight, "0.96 0.94 0.90", false)
+			left.textCentered(chapterLabel(idx), 40, pageHeight/2-14)
+		}
+		addPage(left)
+
+		heading := strings.TrimSpace(chapter.Title)
+		if heading == "" {
+			heading = chapterLabel(idx)
+		}
+		page := newPage()
+		y := pageHeight - pageMargin - titleFontSize
+		for _, line := range font.wrapParagraph(heading, titleFontSize, pageWidth-2*pageMargin) {
+			page.textCentered(line, titleFontSize, y)
+			y -= titleFontSize * 1.3
+		}
+		y -= titleFontSize * 0.5
+		size, lines := font.layoutBody(chapter.Content, y)
+		for _, line := range lines {
+			if y < pageMargin {
+				page.pageNumber(len(pageIDs) + 1)
+				addPage(page)
+				page = newPage()
+				y = pageHeight - pageMargin - size
+			}
+			page.text(line, size, pageMargin, y)
+			y -= size * lineSpacing
+		}
+		page.pageNumber(len(pageIDs) + 1)
+		addPage(page)
+	}
+
+	font.write(doc, fontID)
+
+	var kids strings.Builder
+	for _, id := range pageIDs {
+		fmt.Fprintf(&kids, "%d 0 R ", id)
+	}
+	doc.set(pagesID, []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.TrimSpace(kids.String()), len(pageIDs))))
+	rootID := doc.add([]byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R /PageLayout /TwoPageRight >>", pagesID)))
+	infoID := doc.add([]byte(fmt.Sprintf("<< /Title %s /Producer (illustration2) /CreationDate (D:%s) >>",
+		pdfTextString(title), time.Now().UTC().Format("20060102150405Z"))))
+	return doc.writeTo(w, rootID, infoID)
+}
+
+// layoutBody 选择能从基线top排到下边距放下正文的最大字号，放不下时使用最小字号并由调用方续排
+func (f *pdfFont) layoutBody(content string, top float64) (float64, []string) {
+	width := pageWidth - 2*pageMargin
+	var lines []string
+	size := maxBodyFontSize
+	for ; size >= minBodyFontSize; size-- {
+		lines = lines[:0]
+		for _, p := range paragraphs(content) {
+			lines = append(lines, f.wrapParagraph("　　"+p, size, width)...)
+		}
+		if len(lines) <= int((top-pageMargin)/(size*lineSpacing))+1 {
+			return size, lines
+		}
+	}
+	return minBodyFontSize, lines
+}
+
+// wrapParagraph 按宽度折行：中文逐字断行，连续的ASCII字符作为一个单词整体换行，行首禁则标点挂在上一行
+func (f *pdfFont) wrapParagraph(text string, size, maxWidth float64) []string {
+	var lines []string
+	var line []rune
+	width := 0.0
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		if isWordRune(runes[i]) {
+			for j < len(runes) && isWordRune(runes[j]) {
+				j++
+			}
+			if f.textWidth(string(runes[i:j]), size) > maxWidth {
+				j = i + 1
+			}
+		}
+		seg := runes[i:j]
+		segWidth := f.textWidth(string(seg), size)
+		if width+segWidth > maxWidth && len(line) > 0 && !strings.ContainsRune(lineStartForbidden, seg[0]) {
+			lines = append(lines, strings.TrimRight(string(line), " "))
+			line, width = nil, 0
+			if seg[0] == ' ' {
+				i = j
+				continue
+			}
+		}
+		line = append(line, seg...)
+		width += segWidth
+		i = j
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func isWordRune(r rune) bool {
+	return r > ' ' && r < 0x7f && !strings.ContainsRune(lineStartForbidden, r)
+}
+
+// textWidth 文字宽度：嵌入字体按字形宽度计算；STSong-Light中ASCII为半角，其余按全角计算
+func (f *pdfFont) textWidth(s string, size float64) float64 {
+	w := 0.0
+	for _, r := range s {
+		switch {
+		case f.ttf != nil:
+			w += float64(f.ttf.scale(int(f.ttf.advances[f.ttf.glyph(r)]))) / 1000
+		case r < 0x80:
+			w += 0.5
+		default:
+			w++
+		}
+	}
+	return w * size
+}
+
+// pdfJPEG 返回可用DCTDecode直接嵌入的RGB JPEG，其他格式的图片解码后重新编码，透明部分铺白底
+func pdfJPEG(img *Image) ([]byte, int, int, error) {
+	if img.ContentType() == "image/jpeg" {
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(img.Data))
+		if err == nil && cfg.ColorModel == color.YCbCrModel {
+			return img.Data, cfg.Width, cfg.Height, nil
+		}
+	}
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("unsupported image %s: %w", img.ContentType(), err)
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(bounds)
+	draw.Draw(rgba, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, bounds, src, bounds.Min, draw.Over)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), bounds.Dx(), bounds.Dy(), nil
+}
+
+// pdfImage 已添加的图片对象
+type pdfImage struct {
+	id     int
+	width  int
+	height int
+}
+
+// pdfPage 一页的内容流及引用的图片
+type pdfPage struct {
+	font    *pdfFont
+	content bytes.Buffer
+	images  map[string]int
+}
+
+// image 铺满整页绘制图片，比例不同时居中裁切
+func (p *pdfPage) image(img pdfImage) {
+	if p.images == nil {
+		p.images = make(map[string]int)
+	}
+	name := fmt.Sprintf("Im%d", img.id)
+	p.images[name] = img.id
+	scale := max(pageWidth/float64(img.width), pageHeight/float64(img.height))
+	w, h := float64(img.width)*scale, float64(img.height)*scale
+	fmt.Fprintf(&p.content, "q 0 0 %s %s re W n %s 0 0 %s %s %s cm /%s Do Q\n",
+		num(pageWidth), num(pageHeight), num(w), num(h), num((pageWidth-w)/2), num((pageHeight-h)/2), name)
+}
+
+// fillRect 填充矩形，translucent时使用GS1的透明度
+func (p *pdfPage) fillRect(x, y, w, h float64, rgb string, translucent bool) {
+	gs := ""
+	if translucent {
+		gs = "/GS1 gs "
+	}
+	fmt.Fprintf(&p.content, "q %s%s rg %s %s %s %s re f Q\n", gs, rgb, num(x), num(y), num(w), num(h))
+}
+
+func (p *pdfPage) text(s string, size, x, y float64) {
+	fmt.Fprintf(&p.content, "BT 0.2 0.2 0.2 rg /F1 %s Tf %s %s Td %s Tj ET\n", num(size), num(x), num(y), p.font.encode(s))
+}
+
+func (p *pdfPage) textCentered(s string, size, y float64) {
+	p.text(s, size, (pageWidth-p.font.textWidth(s, size))/2, y)
+}
+
+func (p *pdfPage) pageNumber(n int) {
+	p.textCentered(strconv.Itoa(n), 9, pageMargin/2)
+}
+
+// pdfDoc 按对象号顺序保存PDF对象，写出时生成xref表
+type pdfDoc struct {
+	objects [][]byte
+}
+
+// reserve 预留对象号，稍后用set写入内容
+func (d *pdfDoc) reserve() int {
+	d.objects = append(d.objects, nil)
+	return len(d.objects)
+}
+
+func (d *pdfDoc) set(id int, obj []byte) {
+	d.objects[id-1] = obj
+}
+
+func (d *pdfDoc) add(obj []byte) int {
+	id := d.reserve()
+	d.set(id, obj)
+	return id
+}
+
+// stream 构造流对象，未指定Filter的内容用FlateDecode压缩
+func (d *pdfDoc) stream(dict string, data []byte) []byte {
+	if !strings.Contains(dict, "/Filter") {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+		dict = strings.TrimSpace(dict + " /Filter /FlateDecode")
+	}
+	var obj bytes.Buffer
+	fmt.Fprintf(&obj, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	obj.Write(data)
+	obj.WriteString("\nendstream")
+	return obj.Bytes()
+}
+
+func (d *pdfDoc) writeTo(w io.Writer, root, info int) error {
+	cw := &countingWriter{w: w}
+	cw.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int64, len(d.objects))
+	for i, obj := range d.objects {
+		offsets[i] = cw.n
+		cw.WriteString(fmt.Sprintf("%d 0 obj\n", i+1))
+		cw.Write(obj)
+		cw.WriteString("\nendobj\n")
+	}
+	xref := cw.n
+	cw.WriteString(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1))
+	for _, off := range offsets {
+		cw.WriteString(fmt.Sprintf("%010d 00000 n \n", off))
+	}
+	cw.WriteString(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(d.objects)+1, root, info, xref))
+	return cw.err
+}
+
+// countingWriter 记录已写出的字节数用于xref偏移，保留第一个写错误
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (c *countingWriter) WriteString(s string) {
+	c.Write([]byte(s))
+}
+
+// pdfTextHex 内容流中的文字，按UniGB-UTF16-H编码为UTF-16BE十六进制串
+func pdfTextHex(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// pdfTextString 文档信息中的文字，带BOM的UTF-16BE
+func pdfTextString(s string) string {
+	return "<FEFF" + strings.TrimPrefix(pdfTextHex(s), "<")
+}
+
+// num 坐标等数值，保留两位小数
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,130 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfFont 文字使用的字体：配置了TrueType字体时嵌入用到的字形子集，否则使用阅读器内置的STSong-Light
+type pdfFont struct {
+	ttf  *trueTypeFont
+	used map[uint16]rune // 内容流中用到的字形及对应字符，用于生成子集和ToUnicode
+}
+
+// loadPDFFont fontFile为空或不是TrueType轮廓时回退到STSong-Light，读取失败或字体损坏时返回错误
+func loadPDFFont(fontFile string) (*pdfFont, error) {
+	if fontFile == "" {
+		return &pdfFont{}, nil
+	}
+	data, err := os.ReadFile(fontFile)
+	if err != nil {
+		return nil, fmt.Errorf("read font file: %w", err)
+	}
+	ttf, err := parseTrueType(data)
+	if errors.Is(err, errNotTrueType) {
+		log.Printf("font %s has no TrueType outlines, pdf export falls back to STSong-Light\n", fontFile)
+		return &pdfFont{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse font file %s: %w", fontFile, err)
+	}
+	return &pdfFont{ttf: ttf, used: make(map[uint16]rune)}, nil
+}
+
+// encode 内容流中的文字：嵌入字体按Identity-H编码为字形编号，STSong-Light按UniGB-UTF16-H编码
+func (f *pdfFont) encode(s string) string {
+	if f.ttf == nil {
+		return pdfTextHex(s)
+	}
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		gid := f.ttf.glyph(r)
+		if _, ok := f.used[gid]; !ok {
+			f.used[gid] = r
+		}
+		fmt.Fprintf(&b, "%04X", gid)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// write 写入字体对象，需在所有文字编码之后调用
+func (f *pdfFont) write(d *pdfDoc, id int) {
+	if f.ttf == nil {
+		descriptorID := d.add([]byte("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>"))
+		cidFontID := d.add([]byte(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 4 >> /FontDescriptor %d 0 R /DW 1000 /W [1 95 500] >>", descriptorID)))
+		d.set(id, []byte(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light-UniGB-UTF16-H /Encoding /UniGB-UTF16-H /DescendantFonts [%d 0 R] >>", cidFontID)))
+		return
+	}
+
+	ttf := f.ttf
+	glyphs := make(map[uint16]bool, len(f.used))
+	gids := make([]uint16, 0, len(f.used))
+	for gid := range f.used {
+		glyphs[gid] = true
+		gids = append(gids, gid)
+	}
+	slices.Sort(gids)
+	data := ttf.subset(glyphs)
+	name := subsetTag(gids) + "+" + ttf.name
+
+	fileID := d.add(d.stream(fmt.Sprintf("/Length1 %d", len(data)), data))
+	descriptorID := d.add([]byte(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 4 /FontBBox [%d %d %d %d] /ItalicAngle %s /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, ttf.scale(ttf.bbox[0]), ttf.scale(ttf.bbox[1]), ttf.scale(ttf.bbox[2]), ttf.scale(ttf.bbox[3]),
+		num(ttf.italicAngle), ttf.scale(ttf.ascent), ttf.scale(ttf.descent), ttf.scale(ttf.capHeight), fileID)))
+	var widths strings.Builder
+	for _, gid := range gids {
+		fmt.Fprintf(&widths, "%d [%d] ", gid, ttf.scale(int(ttf.advances[gid])))
+	}
+	cidFontID := d.add([]byte(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW 1000 /W [%s] /CIDToGIDMap /Identity >>",
+		name, descriptorID, strings.TrimSpace(widths.String()))))
+	toUnicodeID := d.add(d.stream("", f.toUnicode(gids)))
+	d.set(id, []byte(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, cidFontID, toUnicodeID)))
+}
+
+// toUnicode 字形编号到字符的CMap，用于复制和搜索文字
+func (f *pdfFont) toUnicode(gids []uint16) []byte {
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	gids = slices.DeleteFunc(slices.Clone(gids), func(gid uint16) bool { return gid == 0 })
+	// 每个bfchar块最多100项
+	for chunk := range slices.Chunk(gids, 100) {
+		fmt.Fprintf(&b, "%d beginbfchar\n", len(chunk))
+		for _, gid := range chunk {
+			fmt.Fprintf(&b, "<%04X> <", gid)
+			for _, u := range utf16.Encode([]rune{f.used[gid]}) {
+				fmt.Fprintf(&b, "%04X", u)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return []byte(b.String())
+}
+
+// subsetTag 子集字体名称前缀，由用到的字形决定的6个大写字母
+func subsetTag(gids []uint16) string {
+	h := fnv.New32a()
+	for _, gid := range gids {
+		h.Write([]byte{byte(gid >> 8), byte(gid)})
+	}
+	sum := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(sum%26)
+		sum /= 26
+	}
+	return string(tag)
+}
@@ -0,0 +1,414 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// errNotTrueType 字体不是TrueType轮廓（如CFF轮廓的otf、woff2），无法作为CIDFontType2嵌入
+var errNotTrueType = errors.New("not a TrueType outline font")
+
+// trueTypeFont 解析后的TrueType字体，只读取嵌入PDF子集所需的表
+type trueTypeFont struct {
+	tables      map[string][]byte
+	name        string // PostScript名称
+	unitsPerEm  int
+	bbox        [4]int
+	ascent      int
+	descent     int
+	capHeight   int
+	italicAngle float64
+	numGlyphs   int
+	advances    []uint16 // 每个字形的宽度，单位为字体单位
+	offsets     []uint32 // loca表，字形i的数据为glyf[offsets[i]:offsets[i+1]]
+	cmap        map[rune]uint16
+}
+
+// parseTrueType 解析ttf或TrueType轮廓的otf
+func parseTrueType(data []byte) (*trueTypeFont, error) {
+	if len(data) < 12 {
+		return nil, errors.New("font file too short")
+	}
+	switch string(data[:4]) {
+	case "\x00\x01\x00\x00", "true":
+	case "OTTO", "wOF2", "wOFF":
+		return nil, errNotTrueType
+	default:
+		return nil, fmt.Errorf("unsupported font format %q", data[:4])
+	}
+
+	f := &trueTypeFont{tables: make(map[string][]byte)}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*numTables {
+		return nil, errors.New("truncated table directory")
+	}
+	for i := 0; i < numTables; i++ {
+		rec := data[12+16*i:]
+		offset, length := binary.BigEndian.Uint32(rec[8:]), binary.BigEndian.Uint32(rec[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("table %s out of range", rec[:4])
+		}
+		f.tables[string(rec[:4])] = data[offset : offset+length]
+	}
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf", "cmap"} {
+		if f.tables[tag] == nil {
+			if tag == "glyf" || tag == "loca" {
+				return nil, errNotTrueType
+			}
+			return nil, fmt.Errorf("missing %s table", tag)
+		}
+	}
+
+	head, hhea, maxp := f.tables["head"], f.tables["hhea"], f.tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 {
+		return nil, errors.New("truncated head, hhea or maxp table")
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	if f.unitsPerEm == 0 {
+		return nil, errors.New("invalid unitsPerEm")
+	}
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	f.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	f.capHeight = f.ascent
+	if os2 := f.tables["OS/2"]; len(os2) >= 90 && binary.BigEndian.Uint16(os2) >= 2 {
+		f.capHeight = int(int16(binary.BigEndian.Uint16(os2[88:])))
+	}
+	if post := f.tables["post"]; len(post) >= 8 {
+		f.italicAngle = float64(int32(binary.BigEndian.Uint32(post[4:]))) / 65536
+	}
+	f.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:]))
+
+	if err := f.parseHmtx(int(binary.BigEndian.Uint16(hhea[34:]))); err != nil {
+		return nil, err
+	}
+	if err := f.parseLoca(int16(binary.BigEndian.Uint16(head[50:])) == 1); err != nil {
+		return nil, err
+	}
+	if err := f.parseCmap(); err != nil {
+		return nil, err
+	}
+	f.name = f.postScriptName()
+	return f, nil
+}
+
+func (f *trueTypeFont) parseHmtx(numberOfHMetrics int) error {
+	hmtx := f.tables["hmtx"]
+	if numberOfHMetrics == 0 || numberOfHMetrics > f.numGlyphs || len(hmtx) < 4*numberOfHMetrics {
+		return errors.New("invalid hmtx table")
+	}
+	f.advances = make([]uint16, f.numGlyphs)
+	for i := range f.advances {
+		// numberOfHMetrics之后的字形使用最后一个宽度
+		f.advances[i] = binary.BigEndian.Uint16(hmtx[4*min(i, numberOfHMetrics-1):])
+	}
+	return nil
+}
+
+func (f *trueTypeFont) parseLoca(long bool) error {
+	loca, glyf := f.tables["loca"], f.tables["glyf"]
+	f.offsets = make([]uint32, f.numGlyphs+1)
+	for i := range f.offsets {
+		if long {
+			if len(loca) < 4*(i+1) {
+				return errors.New("truncated loca table")
+			}
+			f.offsets[i] = binary.BigEndian.Uint32(loca[4*i:])
+		} else {
+			if len(loca) < 2*(i+1) {
+				return errors.New("truncated loca table")
+			}
+			f.offsets[i] = uint32(binary.BigEndian.Uint16(loca[2*i:])) * 2
+		}
+		if f.offsets[i] > uint32(len(glyf)) || (i > 0 && f.offsets[i] < f.offsets[i-1]) {
+			return errors.New("invalid loca table")
+		}
+	}
+	return nil
+}
+
+// parseCmap 读取Unicode字符到字形的映射，优先使用完整Unicode的format 12子表
+func (f *trueTypeFont) parseCmap() error {
+	cmap := f.tables["cmap"]
+	if len(cmap) < 4 {
+		return errors.New("truncated cmap table")
+	}
+	var best []byte
+	bestRank := 0
+	for i := 0; i < int(binary.BigEndian.Uint16(cmap[2:])); i++ {
+		if len(cmap) < 4+8*(i+1) {
+			break
+		}
+		rec := cmap[4+8*i:]
+		platform, encoding, offset := binary.BigEndian.Uint16(rec), binary.BigEndian.Uint16(rec[2:]), binary.BigEndian.Uint32(rec[4:])
+		if offset+2 > uint32(len(cmap)) {
+			continue
+		}
+		sub := cmap[offset:]
+		format := binary.BigEndian.Uint16(sub)
+		rank := 0
+		switch {
+		case format == 12 && (platform == 0 || platform == 3 && encoding == 10):
+			rank = 2
+		case format == 4 && (platform == 0 || platform == 3 && encoding == 1):
+			rank = 1
+		}
+		if rank > bestRank {
+			best, bestRank = sub, rank
+		}
+	}
+
+	f.cmap = make(map[rune]uint16)
+	switch bestRank {
+	case 2:
+		if len(best) < 16 {
+			return errors.New("truncated cmap format 12")
+		}
+		n := int(binary.BigEndian.Uint32(best[12:]))
+		if len(best) < 16+12*n {
+			return errors.New("truncated cmap format 12")
+		}
+		for i := 0; i < n; i++ {
+			g := best[16+12*i:]
+			start, end, gid := binary.BigEndian.Uint32(g), binary.BigEndian.Uint32(g[4:]), binary.BigEndian.Uint32(g[8:])
+			for c := start; c <= end && c <= 0x10FFFF; c++ {
+				if id := gid + c - start; id < uint32(f.numGlyphs) {
+					f.cmap[rune(c)] = uint16(id)
+				}
+			}
+		}
+	case 1:
+		if len(best) < 14 {
+			return errors.New("truncated cmap format 4")
+		}
+		segs := int(binary.BigEndian.Uint16(best[6:])) / 2
+		if len(best) < 16+8*segs {
+			return errors.New("truncated cmap format 4")
+		}
+		ends, starts := best[14:], best[16+2*segs:]
+		deltas, rangeOffsets := best[16+4*segs:], best[16+6*segs:]
+		for s := 0; s < segs; s++ {
+			start, end := int(binary.BigEndian.Uint16(starts[2*s:])), int(binary.BigEndian.Uint16(ends[2*s:]))
+			delta, rangeOffset := binary.BigEndian.Uint16(deltas[2*s:]), int(binary.BigEndian.Uint16(rangeOffsets[2*s:]))
+			for c := start; c <= end && c != 0xFFFF; c++ {
+				gid := uint16(c) + delta
+				if rangeOffset != 0 {
+					// idRangeOffset是相对于其自身位置的偏移
+					pos := 16 + 6*segs + 2*s + rangeOffset + 2*(c-start)
+					if pos+2 > len(best) {
+						continue
+					}
+					if gid = binary.BigEndian.Uint16(best[pos:]); gid != 0 {
+						gid += delta
+					}
+				}
+				if gid != 0 && int(gid) < f.numGlyphs {
+					f.cmap[rune(c)] = gid
+				}
+			}
+		}
+	default:
+		return errors.New("no unicode cmap")
+	}
+	return nil
+}
+
+// postScriptName name表中的PostScript名称，只保留PDF名称中安全的字符
+func (f *trueTypeFont) postScriptName() string {
+	name := f.tables["name"]
+	if len(name) >= 6 {
+		count, strOffset := int(binary.BigEndian.Uint16(name[2:])), int(binary.BigEndian.Uint16(name[4:]))
+		for i := 0; i < count && len(name) >= 6+12*(i+1); i++ {
+			rec := name[6+12*i:]
+			platform, nameID := binary.BigEndian.Uint16(rec), binary.BigEndian.Uint16(rec[6:])
+			length, offset := int(binary.BigEndian.Uint16(rec[8:])), int(binary.BigEndian.Uint16(rec[10:]))
+			if nameID != 6 || strOffset+offset+length > len(name) {
+				continue
+			}
+			raw := name[strOffset+offset : strOffset+offset+length]
+			s := string(raw)
+			if platform == 0 || platform == 3 {
+				u := make([]uint16, len(raw)/2)
+				for j := range u {
+					u[j] = binary.BigEndian.Uint16(raw[2*j:])
+				}
+				s = string(utf16.Decode(u))
+			}
+			s = strings.Map(func(r rune) rune {
+				if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+					return r
+				}
+				return -1
+			}, s)
+			if s != "" {
+				return s
+			}
+		}
+	}
+	return "EmbeddedFont"
+}
+
+// glyph 字符对应的字形，字体中没有该字符时返回0（.notdef）；
+// 缺少的空白字符（如正文缩进的全角空格）使用普通空格，避免显示为方框
+func (f *trueTypeFont) glyph(r rune) uint16 {
+	gid, ok := f.cmap[r]
+	if !ok && unicode.IsSpace(r) {
+		gid = f.cmap[' ']
+	}
+	return gid
+}
+
+// scale 字体单位换算为PDF字形空间的千分之一em
+func (f *trueTypeFont) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
+
+// subset 生成只包含指定字形的字体，字形编号保持不变，未使用的字形数据为空；
+// 复合字形引用的部件一并保留，只输出PDF嵌入所需的表
+func (f *trueTypeFont) subset(glyphs map[uint16]bool) []byte {
+	keep := map[uint16]bool{0: true}
+	queue := make([]uint16, 0, len(glyphs)+1)
+	queue = append(queue, 0)
+	for gid := range glyphs {
+		queue = append(queue, gid)
+	}
+	glyf := f.tables["glyf"]
+	for len(queue) > 0 {
+		gid := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		keep[gid] = true
+		for _, c := range compositeComponents(glyf[f.offsets[gid]:f.offsets[gid+1]]) {
+			if int(c) < f.numGlyphs && !keep[c] {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	var newGlyf bytes.Buffer
+	loca := make([]byte, 4*(f.numGlyphs+1))
+	for gid := 0; gid < f.numGlyphs; gid++ {
+		binary.BigEndian.PutUint32(loca[4*gid:], uint32(newGlyf.Len()))
+		if keep[uint16(gid)] {
+			newGlyf.Write(glyf[f.offsets[gid]:f.offsets[gid+1]])
+			for newGlyf.Len()%4 != 0 {
+				newGlyf.WriteByte(0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*f.numGlyphs:], uint32(newGlyf.Len()))
+
+	head := bytes.Clone(f.tables["head"])
+	binary.BigEndian.PutUint32(head[8:], 0) // checkSumAdjustment，写出后重新计算
+	binary.BigEndian.PutUint16(head[50:], 1)
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": f.tables["hhea"],
+		"maxp": f.tables["maxp"],
+		"hmtx": f.tables["hmtx"],
+		"loca": loca,
+		"glyf": newGlyf.Bytes(),
+	}
+	// 保留hinting相关的表
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		if t := f.tables[tag]; t != nil {
+			tables[tag] = t
+		}
+	}
+	return writeSFNT(tables)
+}
+
+// compositeComponents 复合字形引用的部件字形，简单字形返回nil
+func compositeComponents(g []byte) []uint16 {
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+	var comps []uint16
+	for pos := 10; pos+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[pos:])
+		comps = append(comps, binary.BigEndian.Uint16(g[pos+2:]))
+		pos += 4
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&0x0008 != 0: // WE_HAVE_A_SCALE
+			pos += 2
+		case flags&0x0040 != 0: // WE_HAVE_AN_X_AND_Y_SCALE
+			pos += 4
+		case flags&0x0080 != 0: // WE_HAVE_A_TWO_BY_TWO
+			pos += 8
+		}
+		if flags&0x0020 == 0 { // MORE_COMPONENTS
+			break
+		}
+	}
+	return comps
+}
+
+// writeSFNT 按表名排序写出TrueType字体，并计算head中的checkSumAdjustment
+func writeSFNT(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := 16 << entrySelector
+
+	header := make([]byte, 12+16*n)
+	binary.BigEndian.PutUint32(header, 0x00010000)
+	binary.BigEndian.PutUint16(header[4:], uint16(n))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(header[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(header[10:], uint16(16*n-searchRange))
+
+	var body bytes.Buffer
+	headOffset := 0
+	for i, tag := range tags {
+		data := tables[tag]
+		rec := header[12+16*i:]
+		offset := len(header) + body.Len()
+		if tag == "head" {
+			headOffset = offset
+		}
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], sfntChecksum(data))
+		binary.BigEndian.PutUint32(rec[8:], uint32(offset))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(data)))
+		body.Write(data)
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	font := append(header, body.Bytes()...)
+	if headOffset > 0 {
+		binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-sfntChecksum(font))
+	}
+	return font
+}
+
+// sfntChecksum 按大端uint32求和，不足4字节补0
+func sfntChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
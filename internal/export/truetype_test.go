@@ -0,0 +1,233 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// 测试字体的字形：0为.notdef，3为由1和4组成的复合字形
+var testGlyphs = [][]byte{
+	simpleGlyph(0),
+	simpleGlyph(1),
+	simpleGlyph(2),
+	compositeGlyph(1, 4),
+	simpleGlyph(4),
+}
+
+var testAdvances = []uint16{1024, 1228, 2048, 1228, 614} // unitsPerEm为2048
+
+// simpleGlyph 只有头部和少量占位数据的简单字形
+func simpleGlyph(mark byte) []byte {
+	g := make([]byte, 14)
+	binary.BigEndian.PutUint16(g, 1)
+	g[13] = mark
+	return g
+}
+
+// compositeGlyph 第一个部件使用16位参数，第二个部件使用8位参数
+func compositeGlyph(first, second uint16) []byte {
+	g := make([]byte, 10, 22)
+	binary.BigEndian.PutUint16(g, 0xFFFF) // numberOfContours = -1
+	g = binary.BigEndian.AppendUint16(g, 0x0020|0x0001)
+	g = binary.BigEndian.AppendUint16(g, first)
+	g = append(g, 0, 0, 0, 0)
+	g = binary.BigEndian.AppendUint16(g, 0)
+	g = binary.BigEndian.AppendUint16(g, second)
+	return append(g, 0, 0)
+}
+
+// buildTestFont 构造最小的TrueType字体：short loca，cmap同时包含format 4和format 12子表
+func buildTestFont(t *testing.T) []byte {
+	t.Helper()
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint32(head, 0x00010000)
+	binary.BigEndian.PutUint16(head[18:], 2048)
+	for i, v := range []int16{-100, -400, 2000, 1800} {
+		binary.BigEndian.PutUint16(head[36+2*i:], uint16(v))
+	}
+	hhea := make([]byte, 36)
+	binary.BigEndian.PutUint16(hhea[4:], 1800)
+	binary.BigEndian.PutUint16(hhea[6:], uint16(0x10000-400))
+	binary.BigEndian.PutUint16(hhea[34:], uint16(len(testGlyphs)))
+	maxp := []byte{0, 0, 0x50, 0, 0, byte(len(testGlyphs))}
+
+	var hmtx, glyf, loca []byte
+	for i, g := range testGlyphs {
+		hmtx = binary.BigEndian.AppendUint16(hmtx, testAdvances[i])
+		hmtx = binary.BigEndian.AppendUint16(hmtx, 0)
+		loca = binary.BigEndian.AppendUint16(loca, uint16(len(glyf)/2))
+		glyf = append(glyf, g...)
+	}
+	loca = binary.BigEndian.AppendUint16(loca, uint16(len(glyf)/2))
+
+	// format 4：A->1，É->3，中->2
+	chars := []struct{ c, gid uint16 }{{'A', 1}, {0xC9, 3}, {0x4E2D, 2}, {0xFFFF, 0}}
+	segs := len(chars)
+	fmt4 := make([]byte, 16+8*segs)
+	binary.BigEndian.PutUint16(fmt4, 4)
+	binary.BigEndian.PutUint16(fmt4[2:], uint16(len(fmt4)))
+	binary.BigEndian.PutUint16(fmt4[6:], uint16(2*segs))
+	for i, ch := range chars {
+		binary.BigEndian.PutUint16(fmt4[14+2*i:], ch.c)
+		binary.BigEndian.PutUint16(fmt4[16+2*segs+2*i:], ch.c)
+		delta := ch.gid - ch.c
+		if ch.c == 0xFFFF {
+			delta = 1
+		}
+		binary.BigEndian.PutUint16(fmt4[16+4*segs+2*i:], delta)
+	}
+	// format 12：额外映射U+20000->2，只有使用format 12时才能找到
+	fmt12 := make([]byte, 16)
+	binary.BigEndian.PutUint16(fmt12, 12)
+	groups := [][3]uint32{{'A', 'A', 1}, {0xC9, 0xC9, 3}, {0x4E2D, 0x4E2D, 2}, {0x20000, 0x20000, 2}}
+	binary.BigEndian.PutUint32(fmt12[12:], uint32(len(groups)))
+	for _, g := range groups {
+		fmt12 = binary.BigEndian.AppendUint32(fmt12, g[0])
+		fmt12 = binary.BigEndian.AppendUint32(fmt12, g[1])
+		fmt12 = binary.BigEndian.AppendUint32(fmt12, g[2])
+	}
+	binary.BigEndian.PutUint32(fmt12[4:], uint32(len(fmt12)))
+	cmap := []byte{0, 0, 0, 2}
+	cmap = append(cmap, 0, 3, 0, 1, 0, 0, 0, 20)
+	cmap = append(cmap, 0, 3, 0, 10)
+	cmap = binary.BigEndian.AppendUint32(cmap, uint32(20+len(fmt4)))
+	cmap = append(cmap, fmt4...)
+	cmap = append(cmap, fmt12...)
+
+	psName := utf16.Encode([]rune("Test Font-Regular"))
+	name := []byte{0, 0, 0, 1, 0, 18, 0, 3, 0, 1, 4, 9, 0, 6, 0, byte(2 * len(psName)), 0, 0}
+	for _, u := range psName {
+		name = binary.BigEndian.AppendUint16(name, u)
+	}
+
+	return writeSFNT(map[string][]byte{
+		"head": head, "hhea": hhea, "maxp": maxp, "hmtx": hmtx,
+		"loca": loca, "glyf": glyf, "cmap": cmap, "name": name,
+		"fpgm": {0xB0, 0x00},
+	})
+}
+
+func TestParseTrueType(t *testing.T) {
+	f, err := parseTrueType(buildTestFont(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.name != "TestFont-Regular" {
+		t.Errorf("name = %q", f.name)
+	}
+	for r, want := range map[rune]uint16{'A': 1, 'É': 3, '中': 2, 0x20000: 2, 'B': 0, '　': 0} {
+		if got := f.glyph(r); got != want {
+			t.Errorf("glyph(%q) = %d, want %d", r, got, want)
+		}
+	}
+	if got := f.scale(int(f.advances[f.glyph('中')])); got != 1000 {
+		t.Errorf("width of 中 = %d, want 1000", got)
+	}
+	if f.scale(f.ascent) != 878 || f.scale(f.descent) != -195 {
+		t.Errorf("ascent, descent = %d, %d", f.scale(f.ascent), f.scale(f.descent))
+	}
+
+	for _, magic := range []string{"OTTO", "wOF2"} {
+		data := append([]byte(magic), make([]byte, 8)...)
+		if _, err := parseTrueType(data); err != errNotTrueType {
+			t.Errorf("%s: got %v, want errNotTrueType", magic, err)
+		}
+	}
+}
+
+func TestTrueTypeSubset(t *testing.T) {
+	f, err := parseTrueType(buildTestFont(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := f.subset(map[uint16]bool{3: true})
+	if sum := sfntChecksum(data); sum != 0xB1B0AFBA {
+		t.Errorf("font checksum = %#x, want 0xB1B0AFBA", sum)
+	}
+
+	tables := make(map[string][]byte)
+	for i := 0; i < int(binary.BigEndian.Uint16(data[4:])); i++ {
+		rec := data[12+16*i:]
+		offset, length := binary.BigEndian.Uint32(rec[8:]), binary.BigEndian.Uint32(rec[12:])
+		tables[string(rec[:4])] = data[offset : offset+length]
+		if sum := sfntChecksum(tables[string(rec[:4])]); sum != binary.BigEndian.Uint32(rec[4:]) && string(rec[:4]) != "head" {
+			t.Errorf("table %s checksum mismatch", rec[:4])
+		}
+	}
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf", "fpgm"} {
+		if tables[tag] == nil {
+			t.Errorf("subset missing %s table", tag)
+		}
+	}
+	if tables["cmap"] != nil || tables["name"] != nil {
+		t.Error("subset keeps tables not needed by pdf")
+	}
+	if binary.BigEndian.Uint16(tables["head"][50:]) != 1 {
+		t.Error("subset loca is not long format")
+	}
+
+	// 复合字形3引用的1和4一并保留，未使用的2为空，字形编号不变
+	loca, glyf := tables["loca"], tables["glyf"]
+	for gid, want := range testGlyphs {
+		start, end := binary.BigEndian.Uint32(loca[4*gid:]), binary.BigEndian.Uint32(loca[4*gid+4:])
+		got := bytes.TrimRight(glyf[start:end], "\x00")
+		if gid == 2 {
+			want = nil
+		}
+		if !bytes.Equal(got, bytes.TrimRight(want, "\x00")) {
+			t.Errorf("glyph %d = %x, want %x", gid, got, want)
+		}
+	}
+}
+
+func TestWritePDFFont(t *testing.T) {
+	dir := t.TempDir()
+	ttf := filepath.Join(dir, "book.ttf")
+	if err := os.WriteFile(ttf, buildTestFont(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	otf := filepath.Join(dir, "book.otf")
+	if err := os.WriteFile(otf, append([]byte("OTTO"), make([]byte, 64)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	book := &Book{Title: "A中", Chapters: []Chapter{{Title: "A", Content: "中É"}}}
+
+	tests := []struct {
+		name     string
+		fontFile string
+		want     []string
+		notWant  []string
+	}{
+		{"builtin", "", []string{"/BaseFont /STSong-Light", "/Encoding /UniGB-UTF16-H"}, []string{"/FontFile2"}},
+		{"embedded", ttf, []string{"/Subtype /CIDFontType2", "+TestFont-Regular", "/FontFile2", "/Encoding /Identity-H", "/CIDToGIDMap /Identity", "/ToUnicode"}, []string{"STSong"}},
+		{"cff fallback", otf, []string{"/BaseFont /STSong-Light"}, []string{"/FontFile2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WritePDF(&buf, book, tt.fontFile); err != nil {
+				t.Fatal(err)
+			}
+			pdf := buf.String()
+			for _, s := range tt.want {
+				if !strings.Contains(pdf, s) {
+					t.Errorf("pdf does not contain %q", s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(pdf, s) {
+					t.Errorf("pdf contains %q", s)
+				}
+			}
+		})
+	}
+
+	if err := WritePDF(&bytes.Buffer{}, book, filepath.Join(dir, "missing.ttf")); err == nil {
+		t.Error("missing font file: got nil error")
+	}
+}
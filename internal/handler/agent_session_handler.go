@@ -0,0 +1,448 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"illustration2/internal/export"
+	"illustration2/internal/ill_agent"
+	"illustration2/internal/store"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/adk"
+	"github.com/gin-gonic/gin"
+)
+
+type agentSession struct {
+	runner *adk.Runner
+	events *eventLog
+
+	mu         sync.Mutex
+	cancel     context.CancelFunc // 当前运行的取消函数，未运行时为nil
+	runSeq     int                // 运行序号，用于区分先后两次运行的结束
+	lastActive time.Time
+
+	lastInterruptID string // 最近一次中断的ID，运行失败时提示客户端从该节点重试
+	evicted         bool   // 已因空闲被清理，不能再开始运行
+}
+
+var (
+	errSessionRunning = errors.New("session is running")
+	errSessionEvicted = errors.New("session not found")
+)
+
+// start 标记会话开始一次运行，返回的context可被cancel接口取消，运行结束后需调用finish
+// 会话已在运行时返回errSessionRunning，已被清理时返回errSessionEvicted
+func (s *agentSession) start(parent context.Context) (ctx context.Context, finish func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.evicted {
+		return nil, nil, errSessionEvicted
+	}
+	if s.cancel != nil {
+		return nil, nil, errSessionRunning
+	}
+	ctx, cancel := context.WithCancel(parent)
+	s.runSeq++
+	seq := s.runSeq
+	s.cancel = cancel
+	s.lastActive = time.Now()
+	s.events.setRunning(true)
+
+	return ctx, func() {
+		cancel()
+		s.mu.Lock()
+		if s.runSeq == seq {
+			s.cancel = nil
+			s.events.setRunning(false)
+		}
+		s.lastActive = time.Now()
+		s.mu.Unlock()
+	}, nil
+}
+
+// stop 取消当前运行，返回会话是否正在运行
+func (s *agentSession) stop() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return false
+	}
+	s.cancel()
+	s.cancel = nil
+	return true
+}
+
+func (s *agentSession) setLastInterruptID(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastInterruptID = id
+}
+
+func (s *agentSession) getLastInterruptID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastInterruptID
+}
+
+func (s *agentSession) status() (running bool, lastActive time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cancel != nil, s.lastActive
+}
+
+func (h *AgentStreamHandler) newSession(ctx context.Context) *agentSession {
+	a := ill_agent.NewMKAgent(ctx, h.cfg)
+	runner := adk.NewRunner(ctx, adk.RunnerConfig{
+		EnableStreaming: true,
+		Agent:           a,
+		CheckPointStore: h.sessionStore,
+	})
+	return &agentSession{runner: runner, events: newEventLog(h.cfg.Session.EventLogSize), lastActive: time.Now()}
+}
+
+// getSession 获取会话，内存中不存在时（如服务重启后）根据持久化的checkpoint重建runner
+func (h *AgentStreamHandler) getSession(ctx context.Context, sessionID string) (*agentSession, error) {
+	h.sessionsMu.RLock()
+	session, ok := h.sessions[sessionID]
+	h.sessionsMu.RUnlock()
+	if ok {
+		return session, nil
+	}
+
+	// 持有锁检查checkpoint，避免与清理同时进行时为已删除的会话重建runner
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	if session, ok := h.sessions[sessionID]; ok {
+		return session, nil
+	}
+	_, exists, err := h.sessionStore.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+	session = h.newSession(ctx)
+	h.sessions[sessionID] = session
+	return session, nil
+}
+
+// removeSession 取消会话的运行并删除内存及持久化数据
+func (h *AgentStreamHandler) removeSession(ctx context.Context, sessionID string) error {
+	h.sessionsMu.Lock()
+	session, ok := h.sessions[sessionID]
+	delete(h.sessions, sessionID)
+	h.sessionsMu.Unlock()
+
+	if ok {
+		session.stop()
+	}
+	return h.sessionStore.Delete(ctx, sessionID)
+}
+
+type AgentSessionSummary struct {
+	SessionID  string    `json:"session_id"`
+	State      string    `json:"state,omitempty"`
+	Theme      string    `json:"theme,omitempty"`
+	Running    bool      `json:"running"`
+	LastActive time.Time `json:"last_active"`
+}
+
+type AgentSessionDetail struct {
+	SessionID  string    `json:"session_id"`
+	Running    bool      `json:"running"`
+	LastActive time.Time `json:"last_active"`
+	*ill_agent.IllustrationSessionState
+}
+
+func (h *AgentStreamHandler) summarize(ctx context.Context, sessionID string, updatedAt time.Time) (AgentSessionSummary, *ill_agent.IllustrationSessionState, bool) {
+	summary := AgentSessionSummary{SessionID: sessionID, LastActive: updatedAt}
+
+	h.sessionsMu.RLock()
+	session, inMemory := h.sessions[sessionID]
+	h.sessionsMu.RUnlock()
+	if inMemory {
+		running, lastActive := session.status()
+		summary.Running = running
+		if lastActive.After(summary.LastActive) {
+			summary.LastActive = lastActive
+		}
+	}
+
+	state, exists, err := ill_agent.LoadSessionState(ctx, sessionID)
+	if err != nil {
+		log.Printf("failed to load session %s: %v", sessionID, err)
+	}
+	if exists {
+		summary.State = state.State
+		if state.Story != nil {
+			summary.Theme = state.Story.Theme
+		}
+	}
+	return summary, state, inMemory || exists
+}
+
+// HandleListSessions GET /api/agent/sessions
+func (h *AgentStreamHandler) HandleListSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	infos, err := h.sessionStore.List(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	seen := make(map[string]bool, len(infos))
+	summaries := make([]AgentSessionSummary, 0, len(infos))
+	for _, info := range infos {
+		seen[info.ID] = true
+		summary, _, _ := h.summarize(ctx, info.ID, info.UpdatedAt)
+		summaries = append(summaries, summary)
+	}
+
+	// 刚创建、尚未写入存储的会话
+	h.sessionsMu.RLock()
+	pending := make([]string, 0)
+	for id := range h.sessions {
+		if !seen[id] {
+			pending = append(pending, id)
+		}
+	}
+	h.sessionsMu.RUnlock()
+	for _, id := range pending {
+		summary, _, _ := h.summarize(ctx, id, time.Time{})
+		summaries = append(summaries, summary)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": summaries})
+}
+
+// HandleGetSession GET /api/agent/sessions/:id
+func (h *AgentStreamHandler) HandleGetSession(c *gin.Context) { // ignore_security_alert IDOR
+	sessionID := c.Param("id")
+	summary, state, ok := h.summarize(c.Request.Context(), sessionID, time.Time{})
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AgentSessionDetail{
+		SessionID:                summary.SessionID,
+		Running:                  summary.Running,
+		LastActive:               summary.LastActive,
+		IllustrationSessionState: state,
+	})
+}
+
+// HandleGetSessionVideo GET /api/agent/sessions/:id/video
+// 重定向到故事视频的存储地址，本地存储的视频由/api/assets接口返回并支持Range请求
+func (h *AgentStreamHandler) HandleGetSessionVideo(c *gin.Context) { // ignore_security_alert IDOR
+	sessionID := c.Param("id")
+	state, exists, err := ill_agent.LoadSessionState(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	if state.VideoURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not generated yet"})
+		return
+	}
+	c.Redirect(http.StatusFound, state.VideoURL)
+}
+
+// HandleExportSession GET /api/agent/sessions/:id/export?format=pdf|epub
+// 将故事导出为绘本：封面之后每章一个跨页，左页插图、右页正文
+func (h *AgentStreamHandler) HandleExportSession(c *gin.Context) { // ignore_security_alert IDOR
+	sessionID := c.Param("id")
+	format := c.DefaultQuery("format", export.FormatPDF)
+	contentType, ok := export.ContentType(format)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported format, use pdf or epub"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	state, exists, err := ill_agent.LoadSessionState(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if state.Story == nil || len(state.Story.Chapters) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "story not generated yet"})
+		return
+	}
+
+	book, err := ill_agent.NewBook(ctx, sessionID, state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var buf bytes.Buffer
+	if format == export.FormatEPUB {
+		err = export.WriteEPUB(&buf, book, h.cfg.Export.FontFile)
+	} else {
+		err = export.WritePDF(&buf, book, h.cfg.Export.FontFile)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"; filename*=UTF-8''%s.%s",
+		sessionID, format, strings.ReplaceAll(url.QueryEscape(exportName(state.Story.Theme, sessionID)), "+", "%20"), format))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// exportName 导出文件名，使用故事主题，去掉文件名中不能出现的字符
+func exportName(theme, sessionID string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(theme))
+	if name == "" {
+		return sessionID
+	}
+	return name
+}
+
+// HandleCancelSession POST /api/agent/sessions/:id/cancel
+// 只能取消本进程中正在进行的运行；运行不会跨服务重启保留，重启后只有持久化状态的会话返回409，
+// 客户端需通过resume从最近的中断继续
+func (h *AgentStreamHandler) HandleCancelSession(c *gin.Context) { // ignore_security_alert IDOR
+	sessionID := c.Param("id")
+
+	h.sessionsMu.RLock()
+	session, ok := h.sessions[sessionID]
+	h.sessionsMu.RUnlock()
+	if !ok {
+		exists, err := h.sessionPersisted(c.Request.Context(), sessionID)
+		switch {
+		case errors.Is(err, store.ErrInvalidSessionID):
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		case exists:
+			c.JSON(http.StatusConflict, gin.H{"error": "session not running: runs do not survive a server restart, resume the session to continue"})
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		}
+		return
+	}
+	if !session.stop() {
+		c.JSON(http.StatusConflict, gin.H{"error": "session not running"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "cancelled": true})
+}
+
+// sessionPersisted 会话是否有持久化的状态或checkpoint
+func (h *AgentStreamHandler) sessionPersisted(ctx context.Context, sessionID string) (bool, error) {
+	if _, exists, err := h.sessionStore.GetState(ctx, sessionID); err != nil || exists {
+		return exists, err
+	}
+	_, exists, err := h.sessionStore.Get(ctx, sessionID)
+	return exists, err
+}
+
+// HandleDeleteSession DELETE /api/agent/sessions/:id
+func (h *AgentStreamHandler) HandleDeleteSession(c *gin.Context) { // ignore_security_alert IDOR
+	sessionID := c.Param("id")
+	if err := h.removeSession(c.Request.Context(), sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RunEviction 定期清理空闲超过ttl的会话（运行中的会话不清理），直到ctx结束
+func (h *AgentStreamHandler) RunEviction(ctx context.Context, ttl, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.evictIdleSessions(ctx, ttl)
+		}
+	}
+}
+
+func (h *AgentStreamHandler) evictIdleSessions(ctx context.Context, ttl time.Duration) {
+	infos, err := h.sessionStore.List(ctx)
+	if err != nil {
+		log.Printf("failed to list sessions for eviction: %v", err)
+		return
+	}
+
+	candidates := make(map[string]time.Time, len(infos))
+	for _, info := range infos {
+		candidates[info.ID] = info.UpdatedAt
+	}
+	h.sessionsMu.RLock()
+	for id := range h.sessions {
+		if _, ok := candidates[id]; !ok {
+			candidates[id] = time.Time{}
+		}
+	}
+	h.sessionsMu.RUnlock()
+
+	deadline := time.Now().Add(-ttl)
+	for id, updatedAt := range candidates {
+		summary, _, _ := h.summarize(ctx, id, updatedAt)
+		if summary.Running || summary.LastActive.After(deadline) {
+			continue
+		}
+		evicted, err := h.evictIfIdle(ctx, id, deadline)
+		if err != nil {
+			log.Printf("failed to evict session %s: %v", id, err)
+			continue
+		}
+		if evicted {
+			log.Printf("evicted idle session %s, last active at %s", id, summary.LastActive.Format(time.RFC3339))
+		}
+	}
+}
+
+// evictIfIdle 持有会话锁再次确认会话空闲后删除，检查之后才开始的运行（如resume）会保留会话
+func (h *AgentStreamHandler) evictIfIdle(ctx context.Context, sessionID string, deadline time.Time) (bool, error) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+
+	if session, ok := h.sessions[sessionID]; ok {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		if session.cancel != nil || session.lastActive.After(deadline) {
+			return false, nil
+		}
+		// 已经取得该会话的请求无法再开始运行
+		session.evicted = true
+		delete(h.sessions, sessionID)
+	}
+	return true, h.sessionStore.Delete(ctx, sessionID)
+}
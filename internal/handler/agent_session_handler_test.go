@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"illustration2/internal/config"
+	"illustration2/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEvictIfIdle(t *testing.T) {
+	ctx := context.Background()
+	sessionStore := store.NewMemoryStore()
+	h := NewAgentStreamHandler(config.Default(), nil, sessionStore)
+	if err := sessionStore.SetState(ctx, "s1", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	session := &agentSession{events: newEventLog(10), lastActive: time.Now().Add(-time.Hour)}
+	h.sessions["s1"] = session
+	deadline := time.Now().Add(-time.Minute)
+
+	// 清理前的检查之后会话开始了运行（如resume），不能删除
+	_, finish, err := session.start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.lastActive = time.Now().Add(-time.Hour)
+	if evicted, err := h.evictIfIdle(ctx, "s1", deadline); err != nil || evicted {
+		t.Fatalf("running session evicted: evicted=%v err=%v", evicted, err)
+	}
+	finish()
+	if evicted, err := h.evictIfIdle(ctx, "s1", deadline); err != nil || evicted {
+		t.Fatalf("recently active session evicted: evicted=%v err=%v", evicted, err)
+	}
+
+	session.lastActive = time.Now().Add(-time.Hour)
+	if evicted, err := h.evictIfIdle(ctx, "s1", deadline); err != nil || !evicted {
+		t.Fatalf("idle session not evicted: evicted=%v err=%v", evicted, err)
+	}
+	if _, exists, _ := sessionStore.GetState(ctx, "s1"); exists {
+		t.Fatal("state of evicted session still stored")
+	}
+	// 清理前已取得会话的请求不能再开始运行
+	if _, _, err := session.start(ctx); !errors.Is(err, errSessionEvicted) {
+		t.Fatalf("start after eviction: got %v, want errSessionEvicted", err)
+	}
+}
+
+func TestHandleCancelSession(t *testing.T) {
+	ctx := context.Background()
+	sessionStore := store.NewMemoryStore()
+	h := NewAgentStreamHandler(config.Default(), nil, sessionStore)
+	running := &agentSession{events: newEventLog(10)}
+	if _, _, err := running.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h.sessions["running"] = running
+	h.sessions["idle"] = &agentSession{events: newEventLog(10)}
+	// 服务重启后只有持久化数据、内存中没有的会话
+	if err := sessionStore.SetState(ctx, "restarted", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sessionStore.Set(ctx, "checkpoint-only", []byte("checkpoint")); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/api/agent/sessions/:id/cancel", h.HandleCancelSession)
+	tests := []struct {
+		id        string
+		want      int
+		wantError string
+	}{
+		{"running", http.StatusOK, ""},
+		{"running", http.StatusConflict, "session not running"},
+		{"idle", http.StatusConflict, "session not running"},
+		{"restarted", http.StatusConflict, "runs do not survive a server restart"},
+		{"checkpoint-only", http.StatusConflict, "runs do not survive a server restart"},
+		{"missing", http.StatusNotFound, "session not found"},
+		{"..", http.StatusNotFound, "session not found"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/agent/sessions/"+tt.id+"/cancel", nil))
+		if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.wantError) {
+			t.Errorf("cancel %s: got %d %s, want %d with %q", tt.id, w.Code, w.Body.String(), tt.want, tt.wantError)
+		}
+	}
+	if isRunning, _ := running.status(); isRunning {
+		t.Error("cancelled session still running")
+	}
+	// 重启后的取消不重建会话
+	if _, ok := h.sessions["restarted"]; ok {
+		t.Error("cancel created an in-memory session")
+	}
+}
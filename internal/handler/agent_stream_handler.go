@@ -3,33 +3,36 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"illustration2/internal/config"
 	"illustration2/internal/ill_agent"
 	"illustration2/internal/service"
+	"illustration2/internal/store"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 
-	"github.com/cloudwego/eino-examples/adk/common/store"
 	"github.com/cloudwego/eino/adk"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type AgentStreamHandler struct {
-	genService *service.GenerationService
-	sessions   map[string]*agentSession
-	sessionsMu sync.RWMutex
+	cfg          *config.Config
+	genService   *service.GenerationService
+	sessionStore store.SessionStore
+	sessions     map[string]*agentSession
+	sessionsMu   sync.RWMutex
 }
 
-type agentSession struct {
-	runner *adk.Runner
-}
-
-func NewAgentStreamHandler(genService *service.GenerationService) *AgentStreamHandler {
+func NewAgentStreamHandler(cfg *config.Config, genService *service.GenerationService, sessionStore store.SessionStore) *AgentStreamHandler {
 	return &AgentStreamHandler{
-		genService: genService,
-		sessions:   make(map[string]*agentSession),
+		cfg:          cfg,
+		genService:   genService,
+		sessionStore: sessionStore,
+		sessions:     make(map[string]*agentSession),
 	}
 }
 
@@ -38,9 +41,10 @@ type AgentStreamRequest struct {
 }
 
 type AgentStreamEvent struct {
-	Type      string      `json:"type"`    // event, error, complete
-	Data      interface{} `json:"data"`    // event data
-	Message   string      `json:"message"` // optional message
+	ID        int64       `json:"id,omitempty"` // 会话内单调递增的事件ID，connected事件没有ID
+	Type      string      `json:"type"`         // event, progress, error, complete
+	Data      interface{} `json:"data"`         // event data
+	Message   string      `json:"message"`      // optional message
 	SessionID string      `json:"session_id"`
 }
 
@@ -69,157 +73,193 @@ func (h *AgentStreamHandler) HandleAgentStream(c *gin.Context) {
 	// Generate session ID
 	sessionID := uuid.New().String()
 
-	// Set headers for SSE
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-
-	// Create a context that will be canceled if client disconnects
-	ctx, _ := context.WithCancel(c.Request.Context())
-
-	// Channel to receive events from the agent
-	eventChan := make(chan *adk.AgentEvent, 100)
-	doneChan := make(chan struct{})
-
 	// Create agent and runner
-	a := ill_agent.NewMKAgent(ctx)
-	runner := adk.NewRunner(ctx, adk.RunnerConfig{
-		EnableStreaming: true,
-		Agent:           a,
-		CheckPointStore: store.NewInMemoryStore(),
-	})
+	session := h.newSession(c.Request.Context())
+
+	// The run is detached from the request so that it keeps going if the client disconnects,
+	// it can only be stopped through the session cancel API
+	ctx, finish, _ := session.start(context.Background())
+	ctx = ill_agent.WithSessionID(ctx, sessionID)
 
 	// Start query
-	iter := runner.Query(ctx, theme, adk.WithCheckPointID(sessionID))
+	iter := session.runner.Query(ctx, theme, adk.WithCheckPointID(sessionID))
 
 	// Store session
-	session := &agentSession{
-		runner: runner,
-	}
 	h.sessionsMu.Lock()
 	h.sessions[sessionID] = session
 	h.sessionsMu.Unlock()
 
-	// Start the agent in a goroutine
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		// Process events
-		for {
-			event, ok := iter.Next()
-			if !ok {
-				break
-			}
+	// Start the agent in a goroutine, events are appended to the session event log
+	go h.runAgent(ctx, session, sessionID, iter, finish)
 
-			select {
-			case eventChan <- event:
-			case <-ctx.Done():
-				return
-			}
-		}
+	h.streamEvents(c, session, sessionID, 0, "Agent started, processing theme: "+theme)
+}
 
-		close(doneChan)
-	}()
+// HandleAgentEvents GET /api/agent/sessions/:id/events
+// 断线重连：重放Last-Event-ID之后的事件，若会话仍在运行则继续推送后续事件
+func (h *AgentStreamHandler) HandleAgentEvents(c *gin.Context) { // ignore_security_alert IDOR
+	sessionID := c.Param("id")
 
-	defer close(eventChan)
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		var err error
+		if lastID, err = strconv.ParseInt(lastEventID, 10, 64); err != nil || lastID < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+	}
 
-	// Flusher to send data immediately
-	flusher, ok := c.Writer.(http.Flusher)
+	h.sessionsMu.RLock()
+	session, ok := h.sessions[sessionID]
+	h.sessionsMu.RUnlock()
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "session event log not found"})
+		return
+	}
+	// 事件日志只保留最近的事件，更早的事件无法重放，客户端需通过会话详情接口获取当前状态
+	if _, _, _, err := session.events.since(lastID); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Send initial connected event with session ID
-	sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-		Type:      "connected",
-		Message:   "Agent started, processing theme: " + theme,
-		SessionID: sessionID,
-	})
+	h.streamEvents(c, session, sessionID, lastID, "Reattached to agent session")
+}
+
+// runAgent 消费agent事件并写入会话事件日志，运行结束后写入complete事件
+func (h *AgentStreamHandler) runAgent(ctx context.Context, session *agentSession, sessionID string,
+	iter *adk.AsyncIterator[*adk.AgentEvent], finish func()) {
+	defer finish()
 
-	// Process events and send to client
 	var finalData eventData
 	for {
-		select {
-		case event, ok := <-eventChan:
-			if !ok {
-				sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-					Type:      "complete",
-					Message:   "Agent execution completed",
+		event, ok := iter.Next()
+		if !ok {
+			break
+		}
+
+		if event.Output != nil {
+			if progress, ok := event.Output.CustomizedOutput.(*ill_agent.Progress); ok {
+				session.events.append(AgentStreamEvent{
+					Type:      "progress",
+					Data:      progress,
+					Message:   progress.Message,
 					SessionID: sessionID,
 				})
-				return
+				continue
 			}
+		}
 
-			// Convert event to our data structure
-			data := eventData{}
-			data.AgentName = event.AgentName
-			if event.Output != nil && event.Output.MessageOutput != nil {
-				data.IsStreaming = event.Output.MessageOutput.IsStreaming
-				if event.Output.MessageOutput.Message != nil {
-					data.Message = event.Output.MessageOutput.Message.Content
-				}
-				data.Output = event.Output
-			}
-			if event.Err != nil {
-				data.Err = event.Err.Error()
-			}
-			if event.Action != nil {
-				if event.Action.Exit {
-					data.Action = "exit"
-				} else if event.Action.Interrupted != nil {
-					data.Action = "interrupted"
-				} else {
-					data.Action = "normal_exec"
-				}
-			}
-			if event.Action != nil && event.Action.Interrupted != nil && len(event.Action.Interrupted.InterruptContexts) > 0 {
-				interruptID := event.Action.Interrupted.InterruptContexts[0].ID
-				reInfo := event.Action.Interrupted.InterruptContexts[0].Info.([]map[string]interface{})
-				if event.Output == nil {
-					event.Output = &adk.AgentOutput{}
-				}
-				event.Output.CustomizedOutput = map[string]any{
-					"interrupt_id":   interruptID,
-					"interrupt_info": reInfo,
+		data := toEventData(event)
+		finalData = data
+		if output, ok := data.Output.(*adk.AgentOutput); ok && data.Action == "interrupted" {
+			if info, ok := output.CustomizedOutput.(map[string]any); ok {
+				if id, ok := info["interrupt_id"].(string); ok {
+					session.setLastInterruptID(id)
 				}
-				data.Output = event.Output
 			}
-			finalData = data
+		}
 
-			sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-				Type:      "event",
-				Data:      data,
+		if event.Err != nil {
+			// 单个agent失败只结束本次运行，以error事件通知客户端如何重试
+			session.events.append(AgentStreamEvent{
+				Type:      "error",
+				Data:      newAgentErrorData(event.AgentName, event.Err, session.getLastInterruptID()),
+				Message:   "Agent execution failed: " + errorMessage(event.Err),
 				SessionID: sessionID,
 			})
+			return
+		}
 
-		case <-doneChan:
-			// sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-			// 	Type:      "complete",
-			// 	Message:   "Agent execution completed",
-			// 	SessionID: sessionID,
-			// })
-			if finalData.Action != "interrupted" && (finalData.AgentName == "视频生成助手" || finalData.AgentName == "章节视频生成助手") {
-				if finalData.Output != nil {
-					reInfo := make([]map[string]interface{}, 0)
-					json.Unmarshal([]byte(finalData.Message), &reInfo)
-					tmpAgentOutput := finalData.Output.(*adk.AgentOutput)
-					tmpAgentOutput.CustomizedOutput = map[string]any{
-						"interrupt_info": reInfo,
-					}
-					finalData.Output = tmpAgentOutput
-				}
+		session.events.append(AgentStreamEvent{
+			Type:      "event",
+			Data:      data,
+			SessionID: sessionID,
+		})
+	}
+
+	if ctx.Err() != nil {
+		session.events.append(AgentStreamEvent{
+			Type:      "error",
+			Data:      newAgentErrorData("", ctx.Err(), ""),
+			Message:   "Agent execution cancelled",
+			SessionID: sessionID,
+		})
+		return
+	}
+
+	if finalData.Action != "interrupted" && (finalData.AgentName == "视频生成助手" || finalData.AgentName == "章节视频生成助手") {
+		if tmpAgentOutput, ok := finalData.Output.(*adk.AgentOutput); ok {
+			reInfo := make([]map[string]interface{}, 0)
+			json.Unmarshal([]byte(finalData.Message), &reInfo)
+			customized := map[string]any{
+				"interrupt_info": reInfo,
+			}
+			state, exists, err := ill_agent.LoadSessionState(ctx, sessionID)
+			if err != nil {
+				log.Printf("failed to load session %s: %v", sessionID, err)
 			}
+			if exists && state.VideoURL != "" {
+				customized["video_url"] = state.VideoURL
+			}
+			tmpAgentOutput.CustomizedOutput = customized
+			finalData.Output = tmpAgentOutput
+		}
+	}
+	session.events.append(AgentStreamEvent{
+		Type:      "complete",
+		Data:      finalData,
+		SessionID: sessionID,
+	})
+}
+
+// streamEvents 以SSE推送会话事件日志中lastID之后的事件，直到本次运行结束或客户端断开
+func (h *AgentStreamHandler) streamEvents(c *gin.Context, session *agentSession, sessionID string, lastID int64, connectedMsg string) {
+	// Set headers for SSE
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Flusher to send data immediately
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+		return
+	}
+
+	// Send initial connected event with session ID
+	sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
+		Type:      "connected",
+		Message:   connectedMsg,
+		SessionID: sessionID,
+	})
+
+	ctx := c.Request.Context()
+	for {
+		events, running, wait, err := session.events.since(lastID)
+		if err != nil {
+			// 客户端接收过慢，未发送的事件已被丢弃
 			sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-				Type:      "complete",
-				Data:      finalData,
+				Type:      "error",
+				Message:   err.Error(),
 				SessionID: sessionID,
 			})
 			return
+		}
+		for _, event := range events {
+			sendSSEEvent(c.Writer, flusher, event)
+			lastID = event.ID
+		}
+		if !running {
+			return
+		}
 
+		select {
+		case <-wait:
 		case <-ctx.Done():
 			log.Println("Client disconnected")
 			return
@@ -227,6 +267,115 @@ func (h *AgentStreamHandler) HandleAgentStream(c *gin.Context) {
 	}
 }
 
+func toEventData(event *adk.AgentEvent) eventData {
+	// Convert event to our data structure
+	data := eventData{}
+	data.AgentName = event.AgentName
+	if event.Output != nil && event.Output.MessageOutput != nil {
+		data.IsStreaming = event.Output.MessageOutput.IsStreaming
+		if event.Output.MessageOutput.Message != nil {
+			data.Message = event.Output.MessageOutput.Message.Content
+		}
+		data.Output = event.Output
+	}
+	if event.Err != nil {
+		data.Err = event.Err.Error()
+	}
+	if event.Action != nil {
+		if event.Action.Exit {
+			data.Action = "exit"
+		} else if event.Action.Interrupted != nil {
+			data.Action = "interrupted"
+		} else {
+			data.Action = "normal_exec"
+		}
+	}
+	if event.Action != nil && event.Action.Interrupted != nil && len(event.Action.Interrupted.InterruptContexts) > 0 {
+		interruptCtx := event.Action.Interrupted.InterruptContexts[0]
+		infoType, info := renderInterruptInfo(interruptCtx.Info)
+		if event.Output == nil {
+			event.Output = &adk.AgentOutput{}
+		}
+		event.Output.CustomizedOutput = map[string]any{
+			"interrupt_id":   interruptCtx.ID,
+			"interrupt_type": infoType,
+			"interrupt_info": info,
+		}
+		data.Output = event.Output
+	}
+	return data
+}
+
+// agentErrorData error事件的数据
+type agentErrorData struct {
+	AgentName   string `json:"agent_name,omitempty"`
+	Err         string `json:"err"`
+	Message     string `json:"message,omitempty"` // 面向用户的错误描述
+	Retryable   bool   `json:"retryable"`
+	RetryHint   string `json:"retry_hint,omitempty"`
+	InterruptID string `json:"interrupt_id,omitempty"` // 可用于重试的最近一次中断ID
+}
+
+func newAgentErrorData(agentName string, err error, lastInterruptID string) agentErrorData {
+	data := agentErrorData{
+		AgentName: agentName,
+		Err:       err.Error(),
+	}
+	var agentErr *ill_agent.AgentError
+	if errors.As(err, &agentErr) {
+		data.Message = agentErr.UserMessage
+		if !agentErr.Retryable {
+			data.RetryHint = "原样重试无法成功，请根据错误信息调整后重试"
+			if lastInterruptID != "" {
+				data.InterruptID = lastInterruptID
+				data.RetryHint = "原样重试无法成功，可使用interrupt_id调用/api/agent/resume并修改审核意见后重试"
+			}
+			return data
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		data.RetryHint = "会话已取消"
+	case lastInterruptID != "":
+		data.Retryable = true
+		data.InterruptID = lastInterruptID
+		data.RetryHint = "可使用interrupt_id调用/api/agent/resume，从最近一次审核节点重新执行"
+	default:
+		data.Retryable = true
+		data.RetryHint = "请重新调用/api/agent/stream发起生成"
+	}
+	return data
+}
+
+// errorMessage 优先使用面向用户的错误描述
+func errorMessage(err error) string {
+	var agentErr *ill_agent.AgentError
+	if errors.As(err, &agentErr) {
+		return agentErr.UserMessage
+	}
+	return err.Error()
+}
+
+// renderInterruptInfo 将任意类型的中断信息转换为可JSON序列化的内容及其类型标识
+func renderInterruptInfo(info any) (string, any) {
+	switch v := info.(type) {
+	case *ill_agent.StoryReviewRequest:
+		return "story_review", v
+	case *ill_agent.ImageReviewRequest:
+		return "image_review", v
+	case *ill_agent.ChapterVideoRetryRequest:
+		return "chapter_video_retry", v
+	case nil:
+		return "none", nil
+	case string:
+		return "text", v
+	}
+	if _, err := json.Marshal(info); err != nil {
+		return fmt.Sprintf("%T", info), fmt.Sprintf("%+v", info)
+	}
+	return fmt.Sprintf("%T", info), info
+}
+
 func sendSSEEvent(w http.ResponseWriter, flusher http.Flusher, event AgentStreamEvent) {
 	data, err := json.Marshal(event)
 	if err != nil {
@@ -235,7 +384,11 @@ func sendSSEEvent(w http.ResponseWriter, flusher http.Flusher, event AgentStream
 	}
 
 	// Write SSE format
-	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	if event.ID > 0 {
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.ID, data)
+	} else {
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	}
 	if err != nil {
 		log.Printf("Failed to write event: %v", err)
 		return
@@ -246,7 +399,23 @@ func sendSSEEvent(w http.ResponseWriter, flusher http.Flusher, event AgentStream
 type AgentResumeRequest struct {
 	SessionID   string `json:"session_id" binding:"required"`
 	InterruptID string `json:"interrupt_id" binding:"required"`
-	Input       string `json:"input" binding:"required"`
+	// Input 审核结果，可以是文本（"ok"或修改意见），
+	// 也可以是按章节的结构化结果，如{"approve":[0,2],"revise":{"1":"make the dinosaur green"}}
+	// 章节视频重试中断可回复"retry"，或{"chapters":[1],"prompts":{"2":"a calmer scene"}}只重试部分章节
+	Input json.RawMessage `json:"input" binding:"required"`
+}
+
+// resumeInput 将恢复输入统一转换为字符串，结构化输入保留原始JSON交由审核agent解析
+func (r AgentResumeRequest) resumeInput() (string, error) {
+	var text string
+	if err := json.Unmarshal(r.Input, &text); err == nil {
+		return text, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(r.Input, &obj); err != nil {
+		return "", errors.New("input must be a string or an object")
+	}
+	return string(r.Input), nil
 }
 
 func (h *AgentStreamHandler) HandleAgentResume(c *gin.Context) { // ignore_security_alert IDOR
@@ -255,172 +424,53 @@ func (h *AgentStreamHandler) HandleAgentResume(c *gin.Context) { // ignore_secur
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	ctx := c.Request.Context()
+	input, err := req.resumeInput()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Get session
-	h.sessionsMu.RLock()
-	session, ok := h.sessions[req.SessionID]
-	h.sessionsMu.RUnlock()
-
-	if !ok {
+	session, err := h.getSession(c.Request.Context(), req.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if session == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
 		return
 	}
 
-	// Set headers for SSE
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-
-	// Flusher to send data immediately
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+	// Only stream the events produced by this resume
+	lastID := session.events.lastID()
+	ctx, finish, err := session.start(context.Background())
+	if errors.Is(err, errSessionEvicted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Send connected event
-	sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-		Type:      "connected",
-		Message:   "Resuming agent execution",
-		SessionID: req.SessionID,
-	})
-
-	// Create new event channel and done channel for this resume request
-	resumeEventChan := make(chan *adk.AgentEvent, 100)
-	resumeDoneChan := make(chan struct{})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	ctx = ill_agent.WithSessionID(ctx, req.SessionID)
 
 	// Resume the agent
-	var err error
 	iter, err := session.runner.ResumeWithParams(ctx, req.SessionID, &adk.ResumeParams{
 		Targets: map[string]any{
-			req.InterruptID: req.Input,
+			req.InterruptID: input,
 		},
 	})
 	if err != nil {
-		sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
+		session.events.append(AgentStreamEvent{
 			Type:      "error",
 			Message:   "Failed to resume agent: " + err.Error(),
 			SessionID: req.SessionID,
 		})
-		return
+		finish()
+	} else {
+		// Process events in a goroutine
+		go h.runAgent(ctx, session, req.SessionID, iter, finish)
 	}
 
-	// Process events in a goroutine
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		for {
-			event, ok := iter.Next()
-			if !ok {
-				break
-			}
-
-			select {
-			case resumeEventChan <- event:
-			case <-ctx.Done():
-				log.Println("Client disconnected")
-				return
-			}
-		}
-
-		close(resumeDoneChan)
-	}()
-
-	defer close(resumeEventChan)
-
-	// Process events and send to client
-	var finalData eventData
-	for {
-		select {
-		case event, ok := <-resumeEventChan:
-			if !ok {
-				log.Printf("Agent execution not ok, event: %+v\n", event)
-				sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-					Type:      "complete",
-					Message:   "Agent execution completed",
-					SessionID: req.SessionID,
-				})
-				return
-			}
-
-			// Convert event to our data structure
-			data := eventData{}
-			data.AgentName = event.AgentName
-			if event.Output != nil && event.Output.MessageOutput != nil {
-				data.IsStreaming = event.Output.MessageOutput.IsStreaming
-				if event.Output.MessageOutput.Message != nil {
-					data.Message = event.Output.MessageOutput.Message.Content
-				}
-				data.Output = event.Output
-			}
-			if event.Err != nil {
-				data.Err = event.Err.Error()
-			}
-			if event.Action != nil {
-				if event.Action.Exit {
-					data.Action = "exit"
-				} else if event.Action.Interrupted != nil {
-					data.Action = "interrupted"
-				} else {
-					data.Action = "normal_exec"
-				}
-			}
-			if event.Action != nil && event.Action.Interrupted != nil && len(event.Action.Interrupted.InterruptContexts) > 0 {
-				interruptID := event.Action.Interrupted.InterruptContexts[0].ID
-				reInfo := event.Action.Interrupted.InterruptContexts[0].Info.([]map[string]interface{})
-				if event.Output == nil {
-					event.Output = &adk.AgentOutput{}
-				}
-				event.Output.CustomizedOutput = map[string]any{
-					"interrupt_id":   interruptID,
-					"interrupt_info": reInfo,
-				}
-				data.Output = event.Output
-			}
-			finalData = data
-
-			sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-				Type:      "event",
-				Data:      data,
-				SessionID: req.SessionID,
-			})
-
-		case <-resumeDoneChan:
-			// sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-			// 	Type:      "complete",
-			// 	Message:   "Agent execution completed",
-			// 	SessionID: req.SessionID,
-			// })
-			if finalData.Action != "interrupted" && (finalData.AgentName == "视频生成助手" || finalData.AgentName == "章节视频生成助手") {
-				if finalData.Output != nil {
-					reInfo := make([]map[string]interface{}, 0)
-					json.Unmarshal([]byte(finalData.Message), &reInfo)
-					tmpAgentOutput := finalData.Output.(*adk.AgentOutput)
-					tmpAgentOutput.CustomizedOutput = map[string]any{
-						"interrupt_info": reInfo,
-					}
-					finalData.Output = tmpAgentOutput
-				}
-			}
-			sendSSEEvent(c.Writer, flusher, AgentStreamEvent{
-				Type:      "complete",
-				Data:      finalData,
-				SessionID: req.SessionID,
-			})
-			return
-
-		case <-ctx.Done():
-			log.Println("Client disconnected")
-			return
-
-		case <-ctx.Done():
-			log.Println("Resume client disconnected")
-			return
-		}
-	}
+	h.streamEvents(c, session, req.SessionID, lastID, "Resuming agent execution")
 }
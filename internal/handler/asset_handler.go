@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"errors"
+	"illustration2/internal/store"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AssetHandler 提供本地存储的生成资源下载
+type AssetHandler struct {
+	store *store.LocalAssetStore
+}
+
+func NewAssetHandler(store *store.LocalAssetStore) *AssetHandler {
+	return &AssetHandler{store: store}
+}
+
+// HandleGetAsset GET /api/assets/*key
+// 资源按内容寻址不会变化，允许客户端长期缓存，支持Range请求
+func (h *AssetHandler) HandleGetAsset(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	f, err := h.store.Open(key)
+	switch {
+	case errors.Is(err, store.ErrAssetNotFound), errors.Is(err, store.ErrInvalidAssetKey):
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime(), f)
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"sync"
+)
+
+// errEventsExpired 请求重放的事件已超出事件日志保留的范围
+var errEventsExpired = errors.New("events after Last-Event-ID are no longer available")
+
+// eventLog 会话的SSE事件日志
+// 每个事件分配会话内单调递增的ID，客户端断线后可按Last-Event-ID重放并继续接收
+// 只保留最近size个事件，避免长时间运行的视频会话持续占用内存
+type eventLog struct {
+	mu      sync.Mutex
+	events  []AgentStreamEvent // 保留的事件，ID连续
+	size    int
+	nextID  int64
+	running bool
+	notify  chan struct{} // 有新事件或运行状态变化时close并替换
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{size: max(size, 1), nextID: 1, notify: make(chan struct{})}
+}
+
+// append 写入事件并分配ID，超出size时丢弃最早的事件
+func (l *eventLog) append(event AgentStreamEvent) AgentStreamEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.ID = l.nextID
+	l.nextID++
+	if len(l.events) >= l.size {
+		l.events = append(l.events[:0], l.events[len(l.events)-l.size+1:]...)
+	}
+	l.events = append(l.events, event)
+	l.broadcast()
+	return event
+}
+
+func (l *eventLog) setRunning(running bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.running = running
+	l.broadcast()
+}
+
+// since 返回ID大于lastID的事件、当前是否仍在运行，以及下一次变化的通知channel
+// lastID之后的事件已被丢弃时返回errEventsExpired
+func (l *eventLog) since(lastID int64) ([]AgentStreamEvent, bool, <-chan struct{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lastID < l.oldestID()-1 {
+		return nil, l.running, l.notify, errEventsExpired
+	}
+	var events []AgentStreamEvent
+	if lastID < l.nextID-1 {
+		events = append(events, l.events[lastID-l.oldestID()+1:]...)
+	}
+	return events, l.running, l.notify, nil
+}
+
+func (l *eventLog) lastID() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.nextID - 1
+}
+
+// oldestID 保留的最早事件的ID，调用方需持有锁
+func (l *eventLog) oldestID() int64 {
+	return l.nextID - int64(len(l.events))
+}
+
+// broadcast 调用方需持有锁
+func (l *eventLog) broadcast() {
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
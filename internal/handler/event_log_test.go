@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventLogKeepsLastEvents(t *testing.T) {
+	l := newEventLog(3)
+	for i := 0; i < 5; i++ {
+		l.append(AgentStreamEvent{Type: "event"})
+	}
+	if got := l.lastID(); got != 5 {
+		t.Fatalf("lastID = %d, want 5", got)
+	}
+	if len(l.events) != 3 {
+		t.Fatalf("kept %d events, want 3", len(l.events))
+	}
+
+	tests := []struct {
+		lastID  int64
+		wantIDs []int64
+		wantErr error
+	}{
+		{lastID: 0, wantErr: errEventsExpired},
+		{lastID: 1, wantErr: errEventsExpired},
+		{lastID: 2, wantIDs: []int64{3, 4, 5}},
+		{lastID: 4, wantIDs: []int64{5}},
+		{lastID: 5},
+		{lastID: 9},
+	}
+	for _, tt := range tests {
+		events, _, _, err := l.since(tt.lastID)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("since(%d) err = %v, want %v", tt.lastID, err, tt.wantErr)
+			continue
+		}
+		var ids []int64
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		if len(ids) != len(tt.wantIDs) {
+			t.Errorf("since(%d) = %v, want %v", tt.lastID, ids, tt.wantIDs)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.wantIDs[i] {
+				t.Errorf("since(%d) = %v, want %v", tt.lastID, ids, tt.wantIDs)
+				break
+			}
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"errors"
+	"illustration2/internal/job"
 	"illustration2/internal/service"
+	"illustration2/internal/volc"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -24,13 +27,48 @@ func (h *GenerationHandler) HandleGeneration(c *gin.Context) {
 
 	resp, err := h.svc.Generate(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(statusForError(err), errorBody(err))
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+// HandleListJobs 列出视频生成任务，支持?status=过滤
+func (h *GenerationHandler) HandleListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"jobs": h.svc.ListJobs(c.Query("status"))})
+}
+
+// HandleGetJob 获取单个视频生成任务
+func (h *GenerationHandler) HandleGetJob(c *gin.Context) {
+	j, ok := h.svc.GetJob(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, j)
+}
+
+// HandleCancelJob 取消视频生成任务，Ark只允许取消排队中的任务
+func (h *GenerationHandler) HandleCancelJob(c *gin.Context) {
+	j, err := h.svc.CancelJob(c.Request.Context(), c.Param("id"))
+	switch {
+	case errors.Is(err, job.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, job.ErrJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(statusForError(err), errorBody(err))
+	default:
+		c.JSON(http.StatusOK, j)
+	}
+}
+
+// HandleListModels 返回可用模型及其能力
+func (h *GenerationHandler) HandleListModels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"models": h.svc.Models()})
+}
+
 func (h *GenerationHandler) HandleGetVideo(c *gin.Context) {
 	taskID := c.Param("task_id")
 	if taskID == "" {
@@ -40,9 +78,34 @@ func (h *GenerationHandler) HandleGetVideo(c *gin.Context) {
 
 	resp, err := h.svc.GetVideoResult(c.Request.Context(), taskID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(statusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// errorBody 构造错误响应，请求校验错误附带所有不合法的字段
+func errorBody(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	var verr *service.ValidationError
+	if errors.As(err, &verr) {
+		body["fields"] = verr.Fields
+	}
+	return body
+}
+
+// statusForError 将请求校验错误和Ark错误映射为对应的HTTP状态码
+func statusForError(err error) int {
+	var verr *service.ValidationError
+	switch {
+	case errors.As(err, &verr), volc.IsInvalidParam(err):
+		return http.StatusBadRequest
+	case volc.IsContentRejected(err):
+		return http.StatusUnprocessableEntity
+	case volc.IsRateLimited(err), volc.IsQuotaExceeded(err):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"illustration2/internal/service"
+	"illustration2/internal/volc"
+	"net/http"
+	"testing"
+)
+
+func TestStatusForError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"validation", &service.ValidationError{Fields: []service.FieldError{{Field: "duration", Message: "out of range"}}}, http.StatusBadRequest},
+		{"wrapped validation", fmt.Errorf("generate video: %w", &service.ValidationError{}), http.StatusBadRequest},
+		{"ark invalid parameter", &volc.ArkError{StatusCode: http.StatusBadRequest, Code: "InvalidParameter"}, http.StatusBadRequest},
+		{"ark 400 without code", &volc.ArkError{StatusCode: http.StatusBadRequest, Body: "bad request"}, http.StatusBadRequest},
+		{"sensitive content", &volc.ArkError{StatusCode: http.StatusBadRequest, Code: "InputTextSensitiveContentDetected"}, http.StatusUnprocessableEntity},
+		{"video task rejected", &volc.VideoTaskError{Code: "OutputVideoSensitiveContentDetected"}, http.StatusUnprocessableEntity},
+		{"rate limited", &volc.ArkError{StatusCode: http.StatusTooManyRequests, Code: "RateLimitExceeded.EndpointRPMExceeded"}, http.StatusTooManyRequests},
+		{"quota exceeded", &volc.ArkError{StatusCode: http.StatusForbidden, Code: "AccountOverdueError"}, http.StatusTooManyRequests},
+		{"ark server error", &volc.ArkError{StatusCode: http.StatusInternalServerError, Code: "InternalServiceError"}, http.StatusInternalServerError},
+		{"other", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := statusForError(tt.err); got != tt.want {
+			t.Errorf("%s: statusForError(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
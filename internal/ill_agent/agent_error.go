@@ -0,0 +1,70 @@
+package ill_agent
+
+import (
+	"context"
+	"errors"
+	"illustration2/internal/utils"
+	"illustration2/internal/volc"
+)
+
+// AgentError agent执行失败的错误，UserMessage可直接展示给用户
+type AgentError struct {
+	UserMessage string // 面向用户的错误描述
+	Retryable   bool   // 原样重试是否可能成功
+	Err         error  // 原始错误
+}
+
+func (e *AgentError) Error() string {
+	return e.UserMessage + ": " + e.Err.Error()
+}
+
+func (e *AgentError) Unwrap() error {
+	return e.Err
+}
+
+// newAgentError 根据Ark错误类型生成面向用户的错误，action为失败的操作，如"第2章图片生成"
+func newAgentError(action string, err error) error {
+	msg, retryable := describeError(err)
+	return &AgentError{
+		UserMessage: action + "失败：" + msg,
+		Retryable:   retryable,
+		Err:         err,
+	}
+}
+
+func describeError(err error) (string, bool) {
+	switch {
+	case volc.IsContentRejected(err):
+		return "内容未通过安全审核，请调整故事内容或修改意见后重试", false
+	case volc.IsRateLimited(err):
+		return "请求过于频繁，请稍后重试", true
+	case volc.IsQuotaExceeded(err):
+		return "模型调用额度不足，请联系管理员", false
+	case volc.IsModelNotFound(err):
+		return "模型接入点不存在或未开通，请检查配置", false
+	case volc.IsAuthError(err):
+		return "API Key无效或无权限，请检查配置", false
+	case volc.IsInvalidParam(err):
+		return "请求参数错误", false
+	case errors.Is(err, volc.ErrVideoTaskTimeout):
+		return "视频生成超时，请稍后重试", true
+	case isVideoTaskStatus(err, volc.VideoTaskCancelled):
+		return "视频任务已被取消", false
+	case isVideoTaskStatus(err, volc.VideoTaskFailed):
+		return "模型未能生成视频，请稍后重试或调整提示词", true
+	case errors.Is(err, utils.ErrInvalidVideo):
+		return "视频文件不完整或不是有效的视频，请稍后重试", true
+	case errors.Is(err, context.Canceled):
+		return "任务已取消", false
+	case errors.Is(err, context.DeadlineExceeded):
+		return "请求超时，请稍后重试", true
+	default:
+		return "服务暂时不可用，请稍后重试", true
+	}
+}
+
+// isVideoTaskStatus 判断错误是否为以指定状态结束的视频任务
+func isVideoTaskStatus(err error, status volc.VideoTaskStatus) bool {
+	var taskErr *volc.VideoTaskError
+	return errors.As(err, &taskErr) && taskErr.Status == status
+}
@@ -0,0 +1,123 @@
+package ill_agent
+
+import (
+	"bytes"
+	"context"
+	"illustration2/internal/model"
+	"illustration2/internal/store"
+	"illustration2/internal/volc"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/adk"
+)
+
+const testAssetBaseURL = "/api/assets"
+
+// newFakeArkServer 模拟Ark的图片生成和视频任务接口，返回的资源地址指向同一服务的/files/下，模拟会过期的临时地址
+func newFakeArkServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 64)...)
+	mp4 := append([]byte("\x00\x00\x00\x18ftypmp42"), bytes.Repeat([]byte{2}, 64)...)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/files/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+		case r.URL.Path == "/files/video.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write(mp4)
+		case r.URL.Path == "/api/v3/images/generations":
+			w.Write([]byte(`{"data":[{"url":"` + srv.URL + `/files/image.png?X-Tos-Expires=3600"}]}`))
+		case r.URL.Path == "/api/v3/contents/generations/tasks" && r.Method == http.MethodPost:
+			w.Write([]byte(`{"id":"task-1"}`))
+		case strings.HasPrefix(r.URL.Path, "/api/v3/contents/generations/tasks/"):
+			w.Write([]byte(`{"id":"task-1","status":"succeeded","content":{"video_url":"` + srv.URL + `/files/video.mp4?X-Tos-Expires=3600"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// runAgent 运行agent直到结束，返回最后一个错误
+func runAgent(ctx context.Context, a adk.Agent) error {
+	var lastErr error
+	iter := a.Run(ctx, &adk.AgentInput{})
+	for {
+		event, ok := iter.Next()
+		if !ok {
+			return lastErr
+		}
+		if event.Err != nil {
+			lastErr = event.Err
+		}
+	}
+}
+
+func TestGeneratedAssetsAreArchived(t *testing.T) {
+	SetSessionStore(store.NewMemoryStore())
+	assetStore, err := store.NewLocalAssetStore(t.TempDir(), testAssetBaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetAssetArchiver(store.NewAssetArchiver(assetStore, nil))
+	t.Cleanup(func() { SetAssetArchiver(store.NewAssetArchiver(nil, nil)) })
+
+	srv := newFakeArkServer(t)
+	client := &volc.ArkClient{BaseURL: srv.URL, APIKey: "test", HTTPClient: srv.Client(), Retry: volc.RetryPolicy{MaxAttempts: 1}}
+	ctx := WithSessionID(context.Background(), "archive")
+	if err := SaveSessionState(ctx, &IllustrationSessionState{
+		Story:        &model.Story{Theme: "小兔子找月亮", Chapters: []model.StoryChapter{{Title: "第1章", Content: "开头"}}},
+		ImagePrompts: []model.ImagePrompt{{ChapterIndex: 0, Prompt: "小兔子"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runAgent(ctx, ImageGenerateAgent{ArkClient: client, MaxImages: 1, MaxConcurrency: 1}); err != nil {
+		t.Fatalf("image generate: %v", err)
+	}
+	state, _, err := LoadSessionState(ctx, "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := state.GeneratedImages[0]
+	if len(images) != 1 || !strings.HasPrefix(images[0], testAssetBaseURL+"/"+store.AssetKindImage+"/") || !strings.HasSuffix(images[0], ".png") {
+		t.Fatalf("GeneratedImages = %v, want archived image urls", state.GeneratedImages)
+	}
+	assertArchived(t, assetStore, images[0])
+
+	// 合成需要ffmpeg和真实视频，这里只检查章节视频已转存，忽略合成的错误
+	runAgent(ctx, ChapterVideoGenerateAgent{
+		ArkClient:      client,
+		Duration:       5,
+		MaxConcurrency: 1,
+		Wait:           volc.WaitOptions{PollInterval: time.Millisecond, Timeout: time.Second},
+	})
+	state, _, err = LoadSessionState(ctx, "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.ChapterVideoFailures) > 0 {
+		t.Fatalf("chapter video failed: %+v", state.ChapterVideoFailures)
+	}
+	video := state.ChapterVideoURLs[0]
+	if !strings.HasPrefix(video, testAssetBaseURL+"/"+store.AssetKindVideo+"/") || !strings.HasSuffix(video, ".mp4") {
+		t.Fatalf("ChapterVideoURLs = %v, want archived video urls", state.ChapterVideoURLs)
+	}
+	assertArchived(t, assetStore, video)
+}
+
+// assertArchived 检查地址对应的资源已保存在存储中
+func assertArchived(t *testing.T, s *store.LocalAssetStore, u string) {
+	t.Helper()
+	key := strings.TrimPrefix(u, s.URL(""))
+	if exists, err := s.Exists(context.Background(), key); err != nil || !exists {
+		t.Errorf("%s not in asset store: exists=%v err=%v", u, exists, err)
+	}
+}
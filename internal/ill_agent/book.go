@@ -0,0 +1,68 @@
+package ill_agent
+
+import (
+	"context"
+	"fmt"
+	"illustration2/internal/export"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// NewBook 将会话中的故事整理为导出用的绘本，每章使用第一张生成的图片作为插图
+// 插图下载失败（如模型返回的临时地址已过期）时该章不带插图，不影响导出
+func NewBook(ctx context.Context, sessionID string, state *IllustrationSessionState) (*export.Book, error) {
+	if state.Story == nil || len(state.Story.Chapters) == 0 {
+		return nil, fmt.Errorf("session %s has no story", sessionID)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "book_images_*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	book := &export.Book{
+		ID:       sessionID,
+		Title:    state.Story.Theme,
+		Chapters: make([]export.Chapter, len(state.Story.Chapters)),
+	}
+	var wg sync.WaitGroup
+	for idx, chapter := range state.Story.Chapters {
+		book.Chapters[idx] = export.Chapter{Title: chapter.Title, Content: chapter.Content}
+		src := firstImage(state.GeneratedImages[idx])
+		if src == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := assetArchiver.Download(ctx, src, filepath.Join(tmpDir, fmt.Sprintf("image_%d", idx)))
+			if err != nil {
+				log.Printf("第%d章插图下载失败，导出时不带插图: %v\n", idx+1, err)
+				return
+			}
+			data, err := os.ReadFile(result.Path)
+			if err != nil {
+				log.Printf("第%d章插图读取失败，导出时不带插图: %v\n", idx+1, err)
+				return
+			}
+			book.Chapters[idx].Image = &export.Image{Data: data}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+func firstImage(urls []string) string {
+	for _, u := range urls {
+		if u != "" {
+			return u
+		}
+	}
+	return ""
+}
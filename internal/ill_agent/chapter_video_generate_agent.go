@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/model"
+	"illustration2/internal/store"
 	"illustration2/internal/utils"
 	"illustration2/internal/volc"
 	"log"
@@ -13,25 +16,32 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/schema"
 )
 
 type ChapterVideoGenerateAgent struct {
-	AgentName string
-	AgentDesc string
-	ModelName string
-	ArkClient *volc.ArkClient
+	AgentName      string
+	AgentDesc      string
+	ModelName      string
+	ArkClient      *volc.ArkClient
+	Duration       int                  // 章节视频时长（秒）
+	MaxConcurrency int                  // 同时生成视频的章节数上限
+	Wait           volc.WaitOptions     // 等待视频任务结束的轮询参数
+	Compose        config.ComposeConfig // 章节视频合成参数
 }
 
-func NewChapterVideoGenerateAgent(ctx context.Context) adk.Agent {
+func NewChapterVideoGenerateAgent(ctx context.Context, cfg *config.Config) adk.Agent {
 	a := ChapterVideoGenerateAgent{
-		AgentName: "章节视频生成助手",
-		AgentDesc: "一个可以基于每章首帧图并发生成视频的agent",
-		ModelName: "ep-20260305130909-qnwqm",
-		ArkClient: volc.NewArkClientWithTimeout(300 * time.Second),
+		AgentName:      "章节视频生成助手",
+		AgentDesc:      "一个可以基于每章首帧图并发生成视频的agent",
+		ModelName:      cfg.Models.Endpoint(cfg.Models.ChapterVideo),
+		ArkClient:      volc.NewArkClient(cfg.Ark, cfg.Video.Timeout),
+		Duration:       cfg.Video.ChapterDuration,
+		MaxConcurrency: cfg.Video.Concurrency,
+		Wait:           volc.NewWaitOptions(cfg.Video),
+		Compose:        cfg.Video.Compose,
 	}
 	return a
 }
@@ -50,192 +60,372 @@ func (r ChapterVideoGenerateAgent) Run(ctx context.Context, input *adk.AgentInpu
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
-		sessionState := GetSessionState(ctx)
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 		if len(sessionState.GeneratedImages) == 0 {
 			gen.Send(&adk.AgentEvent{Err: errors.New("no generated images found, cannot generate chapter videos")})
 			return
 		}
 
-		promptByChapter := make(map[int]string, len(sessionState.ChapterVideoPrompts))
-		for _, p := range sessionState.ChapterVideoPrompts {
-			promptByChapter[p.ChapterIndex] = strings.TrimSpace(p.Prompt)
-		}
-
 		var chapterIndices []int
 		for idx := range sessionState.GeneratedImages {
 			chapterIndices = append(chapterIndices, idx)
 		}
 		sort.Ints(chapterIndices)
 
-		type res struct {
-			chapter int
-			url     string
-			err     error
+		// 图片可能已重新生成，清除上一轮的章节视频及拼接的视频
+		sessionState.ChapterVideoURLs = make(map[int]string, len(chapterIndices))
+		sessionState.ChapterVideoFailures = nil
+		sessionState.VideoURL = ""
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
 		}
 
-		ctx2, cancel := context.WithCancel(ctx)
-		defer cancel()
+		r.generate(ctx, gen, sessionState, chapterIndices)
+	}()
 
-		resCh := make(chan res, len(chapterIndices))
-		var wg sync.WaitGroup
-		wg.Add(len(chapterIndices))
-		for _, idx := range chapterIndices {
-			chapterIdx := idx
-			go func() {
-				defer wg.Done()
+	return iter
+}
 
-				images := sessionState.GeneratedImages[chapterIdx]
-				if len(images) == 0 {
-					resCh <- res{chapter: chapterIdx, err: fmt.Errorf("chapter %d has no images", chapterIdx)}
-					cancel()
-					return
-				}
-				firstFrameURL := images[0]
-				if strings.TrimSpace(firstFrameURL) == "" {
-					resCh <- res{chapter: chapterIdx, err: fmt.Errorf("chapter %d first frame url is empty", chapterIdx)}
-					cancel()
-					return
-				}
+// Resume 重试失败的章节，已生成的章节视频保持不变
+func (r ChapterVideoGenerateAgent) Resume(ctx context.Context, info *adk.ResumeInfo,
+	opts ...adk.AgentRunOption) *adk.AsyncIterator[*adk.AgentEvent] {
+	iter, gen := adk.NewAsyncIteratorPair[*adk.AgentEvent]()
 
-				basePrompt := promptByChapter[chapterIdx]
-				if basePrompt == "" && sessionState.Story != nil && chapterIdx >= 0 && chapterIdx < len(sessionState.Story.Chapters) {
-					c := sessionState.Story.Chapters[chapterIdx]
-					basePrompt = strings.TrimSpace(c.Title) + "\n" + strings.TrimSpace(c.Content)
-				}
-				if basePrompt == "" && strings.TrimSpace(sessionState.Story.Theme) != "" {
-					basePrompt = strings.TrimSpace(sessionState.Story.Theme)
-				}
-				if basePrompt == "" {
-					resCh <- res{chapter: chapterIdx, err: fmt.Errorf("chapter %d prompt is empty", chapterIdx)}
-					cancel()
-					return
-				}
+	go func() {
+		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
-				// videoPrompt := basePrompt + "\nAnimate from the provided first frame image. Duration 8 seconds. 16:9, 24fps. Smooth motion, cinematic lighting, consistent style, no on-screen text, no subtitles, no logos, no watermark."
-				videoPrompt := basePrompt
-				if sessionState.Story != nil && chapterIdx >= 0 && chapterIdx < len(sessionState.Story.Chapters) {
-					videoPrompt = fmt.Sprintf("%s\n其他要求：需要为视频内容配上解说，内容为“%s”", videoPrompt, strings.TrimSpace(sessionState.Story.Chapters[chapterIdx].Content))
-				}
+		if info.ResumeData == nil {
+			gen.Send(&adk.AgentEvent{Err: errors.New("chapter_video_generate agent receives nil resume data")})
+			return
+		}
+		input, ok := info.ResumeData.(string)
+		if !ok {
+			gen.Send(&adk.AgentEvent{Err: errors.New("chapter_video_generate agent receives invalid resume data")})
+			return
+		}
 
-				videoParams := volc.VideoTaskParams{
-					Model:         r.ModelName,
-					Prompt:        videoPrompt,
-					FirstFrameURL: firstFrameURL,
-					Duration:      10,
-				}
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
+		failed := make([]int, 0, len(sessionState.ChapterVideoFailures))
+		for idx := range sessionState.ChapterVideoFailures {
+			failed = append(failed, idx)
+		}
+		sort.Ints(failed)
+		if len(failed) == 0 {
+			gen.Send(&adk.AgentEvent{Err: errors.New("no failed chapter videos to retry")})
+			return
+		}
 
-				taskID, err := r.ArkClient.CreateVideoTask(ctx2, videoParams)
-				if err != nil {
-					resCh <- res{chapter: chapterIdx, err: fmt.Errorf("create task failed for chapter %d: %w", chapterIdx, err)}
-					cancel()
-					return
-				}
+		retry, err := ParseChapterVideoRetry(input, failed)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: fmt.Errorf("chapter_video_generate agent receives invalid resume data: %w", err)})
+			return
+		}
+		for idx, prompt := range retry.Prompts {
+			setChapterVideoPrompt(sessionState, idx, strings.TrimSpace(prompt))
+		}
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
-				var status string
-				var videoURL string
-				maxAttempts := 120
-				attempts := 0
-				for attempts < maxAttempts {
-					status, videoURL, err = r.ArkClient.GetVideoTask(ctx2, taskID)
-					if err != nil {
-						resCh <- res{chapter: chapterIdx, err: fmt.Errorf("get task failed for chapter %d: %w", chapterIdx, err)}
-						cancel()
-						return
-					}
-					if status == "succeeded" && videoURL != "" {
-						resCh <- res{chapter: chapterIdx, url: videoURL}
-						return
-					}
-					if status == "failed" {
-						resCh <- res{chapter: chapterIdx, err: fmt.Errorf("video generation failed for chapter %d", chapterIdx)}
-						cancel()
-						return
-					}
-					time.Sleep(5 * time.Second)
-					attempts++
-				}
+		r.generate(ctx, gen, sessionState, retry.chapters())
+	}()
 
-				resCh <- res{chapter: chapterIdx, err: fmt.Errorf("video generation timeout for chapter %d", chapterIdx)}
-				cancel()
-			}()
-		}
+	return iter
+}
 
-		wg.Wait()
-		close(resCh)
+// generate 并发生成指定章节的视频，每个章节完成后立即保存结果，单个章节失败不影响其他章节
+// 有失败章节时中断等待用户重试，全部章节都有视频后再拼接
+func (r ChapterVideoGenerateAgent) generate(ctx context.Context, gen *adk.AsyncGenerator[*adk.AgentEvent],
+	sessionState *IllustrationSessionState, chapterIndices []int) {
+	if sessionState.ChapterVideoURLs == nil {
+		sessionState.ChapterVideoURLs = make(map[int]string)
+	}
+	if sessionState.ChapterVideoFailures == nil {
+		sessionState.ChapterVideoFailures = make(map[int]ChapterVideoFailure)
+	}
 
-		chapterVideoURLs := make(map[int]string, len(chapterIndices))
-		for r := range resCh {
-			if r.err != nil {
-				gen.Send(&adk.AgentEvent{Err: r.err})
-				return
+	progress := newVideoProgress(gen, "chapter_video_generate", len(chapterIndices))
+	var mu sync.Mutex
+	finish := func(chapterIdx int, prompt, url string, err error, aborted *AbortedVideoTask) {
+		progress.finished(chapterIdx, err)
+		mu.Lock()
+		defer mu.Unlock()
+		if aborted != nil {
+			sessionState.AbortedVideoTasks = append(sessionState.AbortedVideoTasks, *aborted)
+		}
+		if err != nil {
+			log.Printf("chapter %d video failed: %v\n", chapterIdx, err)
+			failure := ChapterVideoFailure{
+				ChapterIndex: chapterIdx,
+				Title:        chapterTitle(sessionState, chapterIdx),
+				Prompt:       prompt,
+				Error:        err.Error(),
 			}
-			chapterVideoURLs[r.chapter] = r.url
+			var agentErr *AgentError
+			if errors.As(err, &agentErr) {
+				failure.Error = agentErr.UserMessage
+				failure.Retryable = agentErr.Retryable
+			}
+			sessionState.ChapterVideoFailures[chapterIdx] = failure
+		} else {
+			sessionState.ChapterVideoURLs[chapterIdx] = url
+			delete(sessionState.ChapterVideoFailures, chapterIdx)
 		}
+		// 所有章节结束后还会再保存一次，这里保存失败只记录日志
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			log.Printf("failed to save chapter %d video: %v\n", chapterIdx, err)
+		}
+	}
 
-		sessionState.ChapterVideoURLs = chapterVideoURLs
-		sessionState.State = "chapter_video_generate"
-		SaveSessionState(ctx, sessionState)
-
-		infoList := make([]map[string]interface{}, 0, len(chapterIndices))
-		for _, idx := range chapterIndices {
-			if url := chapterVideoURLs[idx]; url != "" {
-				infoList = append(infoList, map[string]interface{}{
-					"text":      fmt.Sprintf("第%d章视频：", idx+1),
-					"videoUrls": []string{url},
-				})
-			}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(r.MaxConcurrency, 1))
+	for _, idx := range chapterIndices {
+		chapterIdx := idx
+		prompt := chapterVideoPrompt(sessionState, chapterIdx)
+		images := sessionState.GeneratedImages[chapterIdx]
+		switch {
+		case len(images) == 0 || strings.TrimSpace(images[0]) == "":
+			finish(chapterIdx, prompt, "", fmt.Errorf("chapter %d has no first frame image", chapterIdx), nil)
+			continue
+		case prompt == "":
+			finish(chapterIdx, prompt, "", fmt.Errorf("chapter %d prompt is empty", chapterIdx), nil)
+			continue
 		}
-		data, _ := json.Marshal(infoList)
+		firstFrameURL := images[0]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
 
-		log.Printf("chapterVideoURLs: %+v\n", chapterVideoURLs)
+			// videoPrompt := basePrompt + "\nAnimate from the provided first frame image. Duration 8 seconds. 16:9, 24fps. Smooth motion, cinematic lighting, consistent style, no on-screen text, no subtitles, no logos, no watermark."
+			videoPrompt := prompt
+			if sessionState.Story != nil && chapterIdx >= 0 && chapterIdx < len(sessionState.Story.Chapters) {
+				videoPrompt = fmt.Sprintf("%s\n其他要求：需要为视频内容配上解说，内容为“%s”", videoPrompt, strings.TrimSpace(sessionState.Story.Chapters[chapterIdx].Content))
+			}
 
-		// 拼接视频并保存到resource目录
-		if len(chapterVideoURLs) >= 2 {
-			keys := make([]int, 0, len(chapterVideoURLs))
-			for k := range chapterVideoURLs {
-				keys = append(keys, k)
+			// 转存后的图片地址模型可能无法访问，转换为模型可用的地址
+			firstFrame, err := assetArchiver.InputURL(ctx, firstFrameURL)
+			if err != nil {
+				finish(chapterIdx, prompt, "", newAgentError(fmt.Sprintf("第%d章首帧图片读取", chapterIdx+1), err), nil)
+				return
 			}
-			sort.Ints(keys)
 
-			videoURLList := make([]string, 0, len(chapterVideoURLs))
-			for _, k := range keys {
-				videoURLList = append(videoURLList, chapterVideoURLs[k])
+			videoParams := volc.VideoTaskParams{
+				Model:         r.ModelName,
+				Prompt:        videoPrompt,
+				FirstFrameURL: firstFrame,
+				Duration:      r.Duration,
 			}
 
-			resourceDir := "resource"
-			if err := os.MkdirAll(resourceDir, 0755); err != nil {
-				log.Printf("failed to create resource directory: %v\n", err)
-			} else {
-				theme := "story"
-				if sessionState.Story != nil && strings.TrimSpace(sessionState.Story.Theme) != "" {
-					theme = strings.TrimSpace(sessionState.Story.Theme)
-				}
-				timestamp := time.Now().Format("20060102_150405")
-				outputFileName := fmt.Sprintf("%s_%s.mp4", theme, timestamp)
-				outputPath := filepath.Join(resourceDir, outputFileName)
-
-				log.Printf("开始拼接视频，输出路径: %s\n", outputPath)
-				if err := utils.ConcatVideosFromURLs(ctx, videoURLList, outputPath); err != nil {
-					log.Printf("视频拼接失败: %v\n", err)
-				} else {
-					log.Printf("视频拼接成功: %s\n", outputPath)
+			taskID, err := r.ArkClient.CreateVideoTask(ctx, videoParams)
+			if err != nil {
+				finish(chapterIdx, prompt, "", newAgentError(fmt.Sprintf("第%d章视频任务创建", chapterIdx+1), err), nil)
+				return
+			}
+			progress.created(chapterIdx, taskID)
+
+			wait := r.Wait
+			wait.OnUpdate = progress.onUpdate(chapterIdx)
+			result, err := r.ArkClient.WaitForVideoTask(ctx, taskID, wait)
+			if err != nil {
+				var aborted *AbortedVideoTask
+				if shouldAbortVideoTask(ctx, err) {
+					a := abortVideoTask(ctx, r.ArkClient, chapterIdx, taskID)
+					aborted = &a
 				}
+				finish(chapterIdx, prompt, "", newAgentError(fmt.Sprintf("第%d章视频生成", chapterIdx+1), err), aborted)
+				return
 			}
+			videoURL, err := assetArchiver.Archive(ctx, store.AssetKindVideo, result.VideoURL)
+			if err != nil {
+				finish(chapterIdx, prompt, "", newAgentError(fmt.Sprintf("第%d章视频保存", chapterIdx+1), err), nil)
+				return
+			}
+			finish(chapterIdx, prompt, videoURL, nil, nil)
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		gen.Send(&adk.AgentEvent{Err: err})
+		return
+	}
+
+	if len(sessionState.ChapterVideoFailures) > 0 {
+		sessionState.State = "chapter_video_retry"
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
 		}
 
-		gen.Send(&adk.AgentEvent{
-			Output: &adk.AgentOutput{
-				MessageOutput: &adk.MessageVariant{
-					IsStreaming: false,
-					Message: &schema.Message{
-						Role:    schema.Assistant,
-						Content: string(data),
-					},
+		retryReq := &ChapterVideoRetryRequest{
+			Message:        "部分章节视频生成失败，已生成的章节视频已保存。回复retry重试失败章节，或提供新的提示词后重试。",
+			Completed:      sessionState.ChapterVideoURLs,
+			AllowedActions: []string{ReviewActionRetry},
+		}
+		for _, failure := range sessionState.ChapterVideoFailures {
+			retryReq.Failed = append(retryReq.Failed, failure)
+		}
+		sort.Slice(retryReq.Failed, func(i, j int) bool {
+			return retryReq.Failed[i].ChapterIndex < retryReq.Failed[j].ChapterIndex
+		})
+		gen.Send(adk.StatefulInterrupt(ctx, retryReq, sessionState.State))
+		return
+	}
+
+	chapterVideoURLs := sessionState.ChapterVideoURLs
+	sessionState.ChapterVideoFailures = nil
+	sessionState.State = "chapter_video_generate"
+	if err := SaveSessionState(ctx, sessionState); err != nil {
+		gen.Send(&adk.AgentEvent{Err: err})
+		return
+	}
+
+	keys := make([]int, 0, len(chapterVideoURLs))
+	for k := range chapterVideoURLs {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	infoList := make([]map[string]interface{}, 0, len(keys))
+	for _, idx := range keys {
+		infoList = append(infoList, map[string]interface{}{
+			"text":      fmt.Sprintf("第%d章视频：", idx+1),
+			"videoUrls": []string{chapterVideoURLs[idx]},
+		})
+	}
+	data, _ := json.Marshal(infoList)
+
+	log.Printf("chapterVideoURLs: %+v\n", chapterVideoURLs)
+
+	if err := r.compose(ctx, sessionState, keys); err != nil {
+		log.Printf("视频合成失败: %v\n", err)
+		gen.Send(&adk.AgentEvent{Err: err})
+		return
+	}
+
+	gen.Send(&adk.AgentEvent{
+		Output: &adk.AgentOutput{
+			MessageOutput: &adk.MessageVariant{
+				IsStreaming: false,
+				Message: &schema.Message{
+					Role:    schema.Assistant,
+					Content: string(data),
 				},
 			},
-		})
-	}()
+		},
+	})
+}
 
-	return iter
+// compose 将章节视频按顺序合成为故事视频并转存，记录到会话状态的VideoURL
+// 合成时加入标题卡、转场、字幕和背景音乐，因此只有一个章节时也重新合成
+func (r ChapterVideoGenerateAgent) compose(ctx context.Context, sessionState *IllustrationSessionState, chapters []int) error {
+	tmpDir, err := os.MkdirTemp("", "chapter_videos_*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	story := sessionState.Story
+	if story == nil {
+		story = &model.Story{}
+	}
+	srcs := make([]string, 0, len(chapters))
+	dsts := make([]string, 0, len(chapters))
+	for _, idx := range chapters {
+		srcs = append(srcs, sessionState.ChapterVideoURLs[idx])
+		dsts = append(dsts, filepath.Join(tmpDir, fmt.Sprintf("video_%d.mp4", idx)))
+	}
+	results, err := assetArchiver.DownloadAll(ctx, srcs, dsts)
+	if err != nil {
+		var downloadErr *utils.DownloadError
+		if errors.As(err, &downloadErr) {
+			return newAgentError(fmt.Sprintf("第%d章视频下载", chapters[downloadErr.Index]+1), downloadErr.Err)
+		}
+		return newAgentError("章节视频下载", err)
+	}
+
+	clips := make([]utils.StoryClip, 0, len(chapters))
+	for i, idx := range chapters {
+		log.Printf("第%d章视频: %d bytes, sha256 %s, cached %v\n", idx+1, results[i].Size, results[i].SHA256, results[i].Cached)
+		info, err := utils.ProbeVideo(ctx, results[i].Path)
+		if err != nil {
+			return newAgentError(fmt.Sprintf("第%d章视频校验", idx+1), err)
+		}
+		clip := utils.StoryClip{Path: results[i].Path, Info: info}
+		if idx < len(story.Chapters) {
+			clip.Chapter = story.Chapters[idx]
+		}
+		clips = append(clips, clip)
+	}
+	outputPath := filepath.Join(tmpDir, "story.mp4")
+	log.Printf("开始合成视频，共%d个章节\n", len(clips))
+	if err := utils.ComposeStoryVideo(ctx, story.Theme, clips, outputPath, r.Compose); err != nil {
+		return newAgentError("故事视频合成", err)
+	}
+	videoURL, err := assetArchiver.ArchiveFile(ctx, store.AssetKindVideo, outputPath)
+	if err != nil {
+		return newAgentError("故事视频保存", err)
+	}
+	log.Printf("视频合成成功: %s\n", videoURL)
+
+	sessionState.VideoURL = videoURL
+	return SaveSessionState(ctx, sessionState)
+}
+
+// chapterVideoPrompt 章节视频提示词，未生成提示词时使用章节内容或故事主题
+func chapterVideoPrompt(state *IllustrationSessionState, chapterIdx int) string {
+	for _, p := range state.ChapterVideoPrompts {
+		if p.ChapterIndex == chapterIdx && strings.TrimSpace(p.Prompt) != "" {
+			return strings.TrimSpace(p.Prompt)
+		}
+	}
+	if state.Story == nil {
+		return ""
+	}
+	if chapterIdx >= 0 && chapterIdx < len(state.Story.Chapters) {
+		c := state.Story.Chapters[chapterIdx]
+		if prompt := strings.TrimSpace(strings.TrimSpace(c.Title) + "\n" + strings.TrimSpace(c.Content)); prompt != "" {
+			return prompt
+		}
+	}
+	return strings.TrimSpace(state.Story.Theme)
+}
+
+// setChapterVideoPrompt 替换章节视频提示词，章节没有提示词时追加
+func setChapterVideoPrompt(state *IllustrationSessionState, chapterIdx int, prompt string) {
+	for i := range state.ChapterVideoPrompts {
+		if state.ChapterVideoPrompts[i].ChapterIndex == chapterIdx {
+			state.ChapterVideoPrompts[i].Prompt = prompt
+			return
+		}
+	}
+	state.ChapterVideoPrompts = append(state.ChapterVideoPrompts, model.VideoPrompt{ChapterIndex: chapterIdx, Prompt: prompt})
+}
+
+// chapterTitle 章节标题，故事中没有该章节时使用默认标题
+func chapterTitle(state *IllustrationSessionState, chapterIdx int) string {
+	if state.Story != nil && chapterIdx >= 0 && chapterIdx < len(state.Story.Chapters) {
+		return state.Story.Chapters[chapterIdx].Title
+	}
+	return fmt.Sprintf("第%d章", chapterIdx+1)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"illustration2/internal/config"
 	"illustration2/internal/model"
 	"illustration2/internal/volc"
 	"log"
@@ -20,7 +21,7 @@ type ChapterVideoPromptAgent struct {
 	ArkClient *volc.ArkClient
 }
 
-func NewChapterVideoPromptAgent(ctx context.Context) adk.Agent {
+func NewChapterVideoPromptAgent(ctx context.Context, cfg *config.Config) adk.Agent {
 	a := ChapterVideoPromptAgent{
 		AgentName: "章节视频提示词助手",
 		AgentDesc: `You are a professional video prompt engineer. Convert the user-provided story (theme + chapters) and any visual feedback into ONE high-quality English video generation prompt.
@@ -37,8 +38,8 @@ Theme: %s
 Chapters:
 %s
 `,
-		ModelName: "ep-20250220181854-c8s82",
-		ArkClient: volc.NewArkClientDefault(),
+		ModelName: cfg.Models.Endpoint(cfg.Models.Chat),
+		ArkClient: volc.NewArkClient(cfg.Ark, cfg.Ark.Timeout),
 	}
 	return a
 }
@@ -57,8 +58,13 @@ func (r ChapterVideoPromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
-		sessionState := GetSessionState(ctx)
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 		if sessionState.Story == nil || len(sessionState.Story.Chapters) == 0 {
 			gen.Send(&adk.AgentEvent{Err: errors.New("story is empty, cannot generate chapter video prompts")})
 			return
@@ -75,7 +81,7 @@ func (r ChapterVideoPromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 			content, err := r.ArkClient.ChatJSON(ctx, r.ModelName, prompt)
 			if err != nil {
-				gen.Send(&adk.AgentEvent{Err: errors.New("chapter video prompt generation failed")})
+				gen.Send(&adk.AgentEvent{Err: newAgentError(fmt.Sprintf("第%d章视频提示词生成", i+1), err)})
 				return
 			}
 			chapterVideoPrompts = append(chapterVideoPrompts, model.VideoPrompt{
@@ -86,7 +92,10 @@ func (r ChapterVideoPromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 		sessionState.ChapterVideoPrompts = chapterVideoPrompts
 		sessionState.State = "chapter_video_prompt"
-		SaveSessionState(ctx, sessionState)
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
 		log.Printf("chapterVideoPrompts: %+v\n", chapterVideoPrompts)
 
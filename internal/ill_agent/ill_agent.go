@@ -11,6 +11,7 @@ import (
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
+	"illustration2/internal/config"
 	"illustration2/internal/tools"
 	"illustration2/internal/volc"
 )
@@ -52,12 +53,14 @@ type IllustrationAgent struct {
 	videoTool tool.InvokableTool
 }
 
-func NewIllustrationAgent(ctx context.Context) (*IllustrationAgent, error) {
-	arkClient := volc.NewArkClientDefault()
+func NewIllustrationAgent(ctx context.Context, cfg *config.Config) (*IllustrationAgent, error) {
+	arkClient := volc.NewArkClient(cfg.Ark, cfg.Video.Timeout)
 	chatModel, err := ark.NewChatModel(ctx, &ark.ChatModelConfig{
 		APIKey:     arkClient.APIKey,
-		HTTPClient: arkClient.HTTPClient,
-		Model:      "ep-20250220181854-c8s82",
+		HTTPClient: arkClient.ChatHTTPClient(),
+		BaseURL:    cfg.Ark.BaseURL + "/api/v3",
+		Region:     cfg.Ark.Region,
+		Model:      cfg.Models.Endpoint(cfg.Models.Chat),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create chat model: %w", err)
@@ -65,8 +68,8 @@ func NewIllustrationAgent(ctx context.Context) (*IllustrationAgent, error) {
 
 	return &IllustrationAgent{
 		chatModel: chatModel,
-		imageTool: tools.NewImageTool(arkClient),
-		videoTool: tools.NewVideoTool(arkClient),
+		imageTool: tools.NewImageTool(arkClient, cfg.Models.Endpoint(cfg.Models.Image)),
+		videoTool: tools.NewVideoTool(arkClient, cfg.Models.Endpoint(cfg.Models.ToolVideo), volc.NewWaitOptions(cfg.Video)),
 	}, nil
 }
 
@@ -98,9 +101,13 @@ func (a *IllustrationAgent) handleStoryGeneration(ctx context.Context, state *Se
 	log.Println("State: Generating story for theme:", theme)
 	state.Theme = theme
 	content, err := a.runLLM(ctx, storyWriterInstruction, fmt.Sprintf("Theme: %s", theme))
-	if err != nil { return state, nil, err }
+	if err != nil {
+		return state, nil, err
+	}
 	story, err := a.parseStory(content)
-	if err != nil { return state, nil, err }
+	if err != nil {
+		return state, nil, err
+	}
 	state.Story = story
 	state.State = StateStoryWaitingReview
 	return state, story, nil
@@ -111,9 +118,13 @@ func (a *IllustrationAgent) handleStoryRevision(ctx context.Context, state *Sess
 	storyBytes, _ := json.Marshal(state.Story)
 	prompt := fmt.Sprintf("Revise the following story based on this feedback: '%s'.\n\nStory:\n%s", feedback, string(storyBytes))
 	content, err := a.runLLM(ctx, storyWriterInstruction, prompt)
-	if err != nil { return state, nil, err }
+	if err != nil {
+		return state, nil, err
+	}
 	story, err := a.parseStory(content)
-	if err != nil { return state, nil, err }
+	if err != nil {
+		return state, nil, err
+	}
 	state.Story = story
 	state.State = StateStoryWaitingReview
 	return state, story, nil
@@ -123,9 +134,13 @@ func (a *IllustrationAgent) handlePromptGeneration(ctx context.Context, state *S
 	log.Println("State: Generating prompts...")
 	storyBytes, _ := json.Marshal(state.Story)
 	content, err := a.runLLM(ctx, promptEngineerInstruction, string(storyBytes))
-	if err != nil { return state, nil, err }
+	if err != nil {
+		return state, nil, err
+	}
 	storyWithPrompts, err := a.parseStory(content)
-	if err != nil { return state, nil, err }
+	if err != nil {
+		return state, nil, err
+	}
 	state.Story = storyWithPrompts
 	state.State = StatePromptsGenerated
 	return a.handleImageGeneration(ctx, state)
@@ -136,11 +151,15 @@ func (a *IllustrationAgent) handleImageGeneration(ctx context.Context, state *Se
 	for _, chapter := range state.Story.Chapters {
 		toolInput := fmt.Sprintf(`{"prompt": "%s"}`, chapter.ImagePrompt)
 		output, err := a.imageTool.InvokableRun(ctx, toolInput)
-		if err != nil { return state, nil, err }
+		if err != nil {
+			return state, nil, err
+		}
 		var resp tools.ImageToolResp
 		if err := json.Unmarshal([]byte(output), &resp); err == nil && len(resp.Images) > 0 {
 			chapter.ImageURL = resp.Images[0]
-		} else { return state, nil, fmt.Errorf("failed to parse image tool output: %s", output) }
+		} else {
+			return state, nil, fmt.Errorf("failed to parse image tool output: %s", output)
+		}
 	}
 	state.State = StateImagesWaitingReview
 	return state, state.Story, nil
@@ -152,11 +171,15 @@ func (a *IllustrationAgent) handleImageRevision(ctx context.Context, state *Sess
 		newPrompt := fmt.Sprintf("%s. User feedback: %s", chapter.ImagePrompt, feedback)
 		toolInput := fmt.Sprintf(`{"prompt": "%s"}`, newPrompt)
 		output, err := a.imageTool.InvokableRun(ctx, toolInput)
-		if err != nil { return state, nil, err }
+		if err != nil {
+			return state, nil, err
+		}
 		var resp tools.ImageToolResp
 		if err := json.Unmarshal([]byte(output), &resp); err == nil && len(resp.Images) > 0 {
 			chapter.ImageURL = resp.Images[0]
-		} else { return state, nil, fmt.Errorf("failed to parse revised image tool output: %s", output) }
+		} else {
+			return state, nil, fmt.Errorf("failed to parse revised image tool output: %s", output)
+		}
 	}
 	state.State = StateImagesWaitingReview
 	return state, state.Story, nil
@@ -165,15 +188,21 @@ func (a *IllustrationAgent) handleImageRevision(ctx context.Context, state *Sess
 func (a *IllustrationAgent) handleVideoGeneration(ctx context.Context, state *SessionState) (*SessionState, any, error) {
 	log.Println("State: Generating video...")
 	var refImages []string
-	for _, ch := range state.Story.Chapters { refImages = append(refImages, ch.ImageURL) }
+	for _, ch := range state.Story.Chapters {
+		refImages = append(refImages, ch.ImageURL)
+	}
 	videoArgs := tools.VideoToolArgs{Prompt: state.Theme, ReferenceImageURLs: refImages}
 	argsBytes, _ := json.Marshal(videoArgs)
 	output, err := a.videoTool.InvokableRun(ctx, string(argsBytes))
-	if err != nil { return state, nil, err }
+	if err != nil {
+		return state, nil, err
+	}
 	var resp tools.VideoToolResp
 	if err := json.Unmarshal([]byte(output), &resp); err == nil {
 		state.VideoURL = resp.VideoURL
-	} else { return state, nil, fmt.Errorf("failed to parse video tool output: %s", output) }
+	} else {
+		return state, nil, fmt.Errorf("failed to parse video tool output: %s", output)
+	}
 	state.State = StateVideoGenerated
 	return state, state.VideoURL, nil
 }
@@ -215,4 +244,4 @@ func (a *IllustrationAgent) parseStory(content string) (*Story, error) {
 		story.Chapters[i].ID = i + 1
 	}
 	return &story, nil
-}
\ No newline at end of file
+}
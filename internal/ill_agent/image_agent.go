@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"illustration2/internal/config"
 	"illustration2/internal/model"
 	"log"
 	"os"
@@ -13,12 +14,12 @@ import (
 	"github.com/cloudwego/eino/adk"
 )
 
-func NewImageAgent(ctx context.Context) adk.Agent {
+func NewImageAgent(ctx context.Context, cfg *config.Config) adk.Agent {
 	imageLoopAgent, err := adk.NewLoopAgent(ctx, &adk.LoopAgentConfig{
 		Name:        "图片生成&审核agent",
 		Description: "一个可以生成图片&可持续根据反馈优化重新生成图片的agent",
 		SubAgents: []adk.Agent{
-			NewImageGenerateAgent(ctx),
+			NewImageGenerateAgent(ctx, cfg),
 			NewImageReviewAgent(ctx),
 		},
 	})
@@ -29,10 +30,10 @@ func NewImageAgent(ctx context.Context) adk.Agent {
 		Name:        "图片小助手",
 		Description: "一个图片生成助手",
 		SubAgents: []adk.Agent{
-			NewImagePromptAgent(ctx),
+			NewImagePromptAgent(ctx, cfg),
 			imageLoopAgent,
-			NewChapterVideoPromptAgent(ctx),
-			NewChapterVideoGenerateAgent(ctx),
+			NewChapterVideoPromptAgent(ctx, cfg),
+			NewChapterVideoGenerateAgent(ctx, cfg),
 		},
 	})
 	if err != nil {
@@ -42,8 +43,12 @@ func NewImageAgent(ctx context.Context) adk.Agent {
 	return la
 }
 
-func TestImageAgent(ctx context.Context) {
-	sessionState := GetSessionState(ctx)
+func TestImageAgent(ctx context.Context, cfg *config.Config) {
+	ctx = WithSessionID(ctx, "1")
+	sessionState, err := GetSessionState(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
 	sessionState.Story = &model.Story{
 		Theme: "恐龙为什么灭绝了？",
 		Chapters: []model.StoryChapter{
@@ -61,9 +66,11 @@ func TestImageAgent(ctx context.Context) {
 			},
 		},
 	}
-	SaveSessionState(ctx, sessionState)
+	if err := SaveSessionState(ctx, sessionState); err != nil {
+		log.Fatal(err)
+	}
 
-	a := NewImageAgent(ctx)
+	a := NewImageAgent(ctx, cfg)
 	runner := adk.NewRunner(ctx, adk.RunnerConfig{
 		EnableStreaming: true, // you can disable streaming here
 		Agent:           a,
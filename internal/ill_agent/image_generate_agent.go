@@ -2,29 +2,37 @@ package ill_agent
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/model"
+	"illustration2/internal/store"
 	"illustration2/internal/volc"
 	"log"
-	"time"
+	"sync"
 
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/schema"
 )
 
 type ImageGenerateAgent struct {
-	AgentName string
-	AgentDesc string
-	ModelName string
-	ArkClient *volc.ArkClient
+	AgentName      string
+	AgentDesc      string
+	ModelName      string
+	ArkClient      *volc.ArkClient
+	Size           string // 图片分辨率
+	MaxImages      int    // 每章生成的图片数
+	MaxConcurrency int    // 同时生成图片的章节数上限
 }
 
-func NewImageGenerateAgent(ctx context.Context) adk.Agent {
+func NewImageGenerateAgent(ctx context.Context, cfg *config.Config) adk.Agent {
 	a := ImageGenerateAgent{
-		AgentName: "图片生成助手",
-		AgentDesc: ``,
-		ModelName: "ep-20251124201143-rwjnq",
-		ArkClient: volc.NewArkClientWithTimeout(180 * time.Second),
+		AgentName:      "图片生成助手",
+		AgentDesc:      ``,
+		ModelName:      cfg.Models.Endpoint(cfg.Models.Image),
+		ArkClient:      volc.NewArkClient(cfg.Ark, cfg.Image.Timeout),
+		Size:           cfg.Image.Size,
+		MaxImages:      cfg.Image.MaxImages,
+		MaxConcurrency: cfg.Image.Concurrency,
 	}
 	return a
 }
@@ -43,39 +51,107 @@ func (r ImageGenerateAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
-		sessionState := GetSessionState(ctx)
-		// 调用工具生成每个章节的图片提示词
-		generatedImages := make(map[int][]string)
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
+		// 并发生成每个章节的图片，审核后仅重新生成需要修改的章节，已通过的章节保留原图
+		revisions := sessionState.ImageRevisions
+		generatedImages := make(map[int][]string, len(sessionState.ImagePrompts))
+		pending := make([]model.ImagePrompt, 0, len(sessionState.ImagePrompts))
 		for _, prompt := range sessionState.ImagePrompts {
-			generateImagesReq := volc.ImageGenParams{
-				Model:                     r.ModelName,
-				Prompt:                    prompt.Prompt,
-				Size:                      "2304x1728",
-				SequentialImageGeneration: "auto",
-				MaxImages:                 1,
+			_, needRevise := revisions[prompt.ChapterIndex]
+			if len(revisions) > 0 && !needRevise && len(sessionState.GeneratedImages[prompt.ChapterIndex]) > 0 {
+				generatedImages[prompt.ChapterIndex] = sessionState.GeneratedImages[prompt.ChapterIndex]
+				continue
 			}
-			if sessionState.ImageFeedback != "" {
-				generateImagesReq.Prompt = fmt.Sprintf("%s\n%s", generateImagesReq.Prompt, sessionState.ImageFeedback)
-				if len(sessionState.GeneratedImages[prompt.ChapterIndex]) > 0 {
-					generateImagesReq.ImageInputs = sessionState.GeneratedImages[prompt.ChapterIndex]
+			pending = append(pending, prompt)
+		}
+
+		concurrency := max(r.MaxConcurrency, 1)
+		ctx2, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var (
+			wg       sync.WaitGroup
+			mu       sync.Mutex
+			firstErr error
+			done     int
+		)
+		sem := make(chan struct{}, concurrency)
+		for _, prompt := range pending {
+			prompt := prompt
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-ctx2.Done():
+					return
 				}
-			}
-			urls, err := r.ArkClient.GenerateImages(ctx, generateImagesReq)
-			if err != nil {
-				log.Fatal(fmt.Errorf("image generation failed: %+v", err))
-				event := &adk.AgentEvent{
-					Err: errors.New("image generation failed"),
+
+				generateImagesReq := volc.ImageGenParams{
+					Model:                     r.ModelName,
+					Prompt:                    prompt.Prompt,
+					Size:                      r.Size,
+					SequentialImageGeneration: "auto",
+					MaxImages:                 r.MaxImages,
 				}
-				gen.Send(event)
-				return
-			}
-			generatedImages[prompt.ChapterIndex] = urls
+				var err error
+				if revision, ok := revisions[prompt.ChapterIndex]; ok {
+					generateImagesReq.Prompt = fmt.Sprintf("%s\n%s", generateImagesReq.Prompt, revision)
+					generateImagesReq.ImageInputs, err = inputImages(ctx2, sessionState.GeneratedImages[prompt.ChapterIndex])
+				}
+				var urls []string
+				if err == nil {
+					urls, err = r.ArkClient.GenerateImages(ctx2, generateImagesReq)
+				}
+				if err == nil {
+					// Ark返回的图片地址会过期，转存后使用稳定地址
+					urls, err = archiveImages(ctx2, urls)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = newAgentError(fmt.Sprintf("第%d章图片生成", prompt.ChapterIndex+1), err)
+						cancel()
+					}
+					return
+				}
+				generatedImages[prompt.ChapterIndex] = urls
+				done++
+				gen.Send(newProgressEvent(&Progress{
+					Stage:        "image_generate",
+					ChapterIndex: prompt.ChapterIndex,
+					Status:       "succeeded",
+					Completed:    done,
+					Total:        len(pending),
+					Message:      fmt.Sprintf("第%d章图片生成完成（%d/%d）", prompt.ChapterIndex+1, done, len(pending)),
+				}))
+			}()
+		}
+		wg.Wait()
+		if firstErr == nil && ctx.Err() != nil {
+			firstErr = ctx.Err()
+		}
+		if firstErr != nil {
+			log.Printf("image generation failed: %+v\n", firstErr)
+			gen.Send(&adk.AgentEvent{Err: firstErr})
+			return
 		}
 		log.Printf("generatedImages: %+v\n", generatedImages)
 		sessionState.GeneratedImages = generatedImages
+		sessionState.ImageRevisions = nil
 		sessionState.State = "image_generate"
-		SaveSessionState(ctx, sessionState)
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
 		event := &adk.AgentEvent{
 			Output: &adk.AgentOutput{
@@ -93,3 +169,29 @@ func (r ImageGenerateAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 	return iter
 }
+
+// inputImages 将已生成的图片转换为模型可用的输入地址
+func inputImages(ctx context.Context, images []string) ([]string, error) {
+	inputs := make([]string, 0, len(images))
+	for _, src := range images {
+		input, err := assetArchiver.InputURL(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// archiveImages 转存生成的图片，返回稳定地址
+func archiveImages(ctx context.Context, urls []string) ([]string, error) {
+	archived := make([]string, 0, len(urls))
+	for _, src := range urls {
+		u, err := assetArchiver.Archive(ctx, store.AssetKindImage, src)
+		if err != nil {
+			return nil, err
+		}
+		archived = append(archived, u)
+	}
+	return archived, nil
+}
@@ -2,8 +2,8 @@ package ill_agent
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"illustration2/internal/config"
 	"illustration2/internal/model"
 	"illustration2/internal/volc"
 	"log"
@@ -19,14 +19,14 @@ type ImagePromptAgent struct {
 	ArkClient *volc.ArkClient
 }
 
-func NewImagePromptAgent(ctx context.Context) adk.Agent {
+func NewImagePromptAgent(ctx context.Context, cfg *config.Config) adk.Agent {
 	a := ImagePromptAgent{
 		AgentName: "图片提示词助手",
 		AgentDesc: `You are a professional graphic prompt word engineer who needs to analyze and summarize the user's input content to generate professional, concise, and clear meaning graphic prompt words. Only output the final English prompt words without additional information.
 User input content: 
 %s`,
-		ModelName: "ep-20250220181854-c8s82",
-		ArkClient: volc.NewArkClientDefault(),
+		ModelName: cfg.Models.Endpoint(cfg.Models.Chat),
+		ArkClient: volc.NewArkClient(cfg.Ark, cfg.Ark.Timeout),
 	}
 	return a
 }
@@ -45,8 +45,13 @@ func (r ImagePromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
-		sessionState := GetSessionState(ctx)
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 		// 调用工具生成每个章节的图片提示词
 		imagePrompts := make([]model.ImagePrompt, 0)
 		for i, chapter := range sessionState.Story.Chapters {
@@ -54,7 +59,7 @@ func (r ImagePromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 			content, err := r.ArkClient.ChatJSON(ctx, r.ModelName, prompt)
 			if err != nil {
 				event := &adk.AgentEvent{
-					Err: errors.New("image prompt generation failed"),
+					Err: newAgentError(fmt.Sprintf("第%d章图片提示词生成", i+1), err),
 				}
 				gen.Send(event)
 				return
@@ -67,7 +72,10 @@ func (r ImagePromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 		log.Printf("imagePrompts: %+v\n", imagePrompts)
 		sessionState.ImagePrompts = imagePrompts
 		sessionState.State = "image_prompt"
-		SaveSessionState(ctx, sessionState)
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
 		event := &adk.AgentEvent{
 			Output: &adk.AgentOutput{
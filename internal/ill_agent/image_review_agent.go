@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/cloudwego/eino/adk"
@@ -36,8 +37,13 @@ func (r ImageReviewAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
-		sessionState := GetSessionState(ctx)
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 		if sessionState.GeneratedImages == nil {
 			event := &adk.AgentEvent{
 				Err: errors.New("generated_images not found in session"),
@@ -47,22 +53,34 @@ func (r ImageReviewAgent) Run(ctx context.Context, input *adk.AgentInput,
 		}
 
 		sessionState.State = "image_review"
-		SaveSessionState(ctx, sessionState)
-
-		infoList := make([]map[string]interface{}, 0)
-		infoList = append(infoList, map[string]interface{}{
-			"text": "已生成图片如下：",
-		})
-		for i, urls := range sessionState.GeneratedImages {
-			infoList = append(infoList, map[string]interface{}{
-				"text":      fmt.Sprintf("第%d章节组图：", i+1),
-				"imageUrls": urls,
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
+
+		chapterIndices := make([]int, 0, len(sessionState.GeneratedImages))
+		for idx := range sessionState.GeneratedImages {
+			chapterIndices = append(chapterIndices, idx)
+		}
+		sort.Ints(chapterIndices)
+
+		reviewReq := &ImageReviewRequest{
+			Message:        "已生成图片如下，如果图片符合要求，请回复ok。否则提供反馈。",
+			Chapters:       make([]ImageReviewChapter, 0, len(chapterIndices)),
+			AllowedActions: []string{ReviewActionApprove, ReviewActionRevise},
+		}
+		for _, idx := range chapterIndices {
+			title := fmt.Sprintf("第%d章节组图", idx+1)
+			if sessionState.Story != nil && idx < len(sessionState.Story.Chapters) {
+				title = sessionState.Story.Chapters[idx].Title
+			}
+			reviewReq.Chapters = append(reviewReq.Chapters, ImageReviewChapter{
+				ChapterIndex: idx,
+				Title:        title,
+				ImageURLs:    sessionState.GeneratedImages[idx],
 			})
 		}
-		infoList = append(infoList, map[string]interface{}{
-			"text": "如果图片符合要求，请回复ok。否则提供反馈。",
-		})
-		event := adk.StatefulInterrupt(ctx, infoList, sessionState.State)
+		event := adk.StatefulInterrupt(ctx, reviewReq, sessionState.State)
 		gen.Send(event)
 	}()
 
@@ -75,6 +93,7 @@ func (r ImageReviewAgent) Resume(ctx context.Context, info *adk.ResumeInfo,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
 		if info.ResumeData == nil {
 			event := &adk.AgentEvent{
@@ -93,39 +112,53 @@ func (r ImageReviewAgent) Resume(ctx context.Context, info *adk.ResumeInfo,
 			return
 		}
 
-		sessionState := GetSessionState(ctx)
-		if strings.ToLower(feedback) != "ok" {
-			sessionState.NeedToEditImages = true
-			sessionState.ImageFeedback = feedback
-		} else {
-			sessionState.NeedToEditImages = false
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
 		}
-		SaveSessionState(ctx, sessionState)
-
-		if !sessionState.NeedToEditImages {
+		chapterCount := len(sessionState.ImagePrompts)
+		for idx := range sessionState.GeneratedImages {
+			if idx+1 > chapterCount {
+				chapterCount = idx + 1
+			}
+		}
+		reviewFeedback, err := ParseReviewFeedback(feedback, chapterCount)
+		if err != nil {
 			event := &adk.AgentEvent{
-				Action: adk.NewBreakLoopAction(r.AgentName),
-				// Action: adk.NewExitAction(),
+				Err: fmt.Errorf("image_review agent receives invalid resume data: %w", err),
 			}
 			gen.Send(event)
 			return
 		}
+		sessionState.NeedToEditImages = reviewFeedback.NeedRevision()
+		sessionState.ImageRevisions = reviewFeedback.Revise
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
-		if sessionState.ImageFeedback == "" {
+		if !sessionState.NeedToEditImages {
 			event := &adk.AgentEvent{
-				Err: errors.New("image feedback is nil"),
+				Action: adk.NewBreakLoopAction(r.AgentName),
+				// Action: adk.NewExitAction(),
 			}
 			gen.Send(event)
 			return
 		}
 
+		revised := make([]string, 0, len(reviewFeedback.Revise))
+		for _, ch := range reviewFeedback.chapters() {
+			revised = append(revised, fmt.Sprintf("第%d章: %s", ch+1, reviewFeedback.Revise[ch]))
+		}
+
 		event := &adk.AgentEvent{
 			Output: &adk.AgentOutput{
 				MessageOutput: &adk.MessageVariant{
 					IsStreaming: false,
 					Message: &schema.Message{
 						Role:    schema.Assistant,
-						Content: sessionState.ImageFeedback,
+						Content: strings.Join(revised, "\n"),
 					},
 				},
 			},
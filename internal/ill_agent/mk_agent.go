@@ -2,76 +2,139 @@ package ill_agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"illustration2/internal/config"
 	"illustration2/internal/model"
+	"illustration2/internal/store"
 	"log"
-	"sync"
+	"runtime/debug"
 
 	"github.com/cloudwego/eino/adk"
 )
 
 // SessionState 会话状态
 type IllustrationSessionState struct {
-	State               string              `json:"state"`                           // 当前状态
-	Story               *model.Story        `json:"story,omitempty"`                 // 生成的故事
-	ImagePrompts        []model.ImagePrompt `json:"image_prompts,omitempty"`         // 图片生成提示词
-	GeneratedImages     map[int][]string    `json:"generated_images,omitempty"`      // 生成的图片，key为章节索引
-	VideoPrompt         string              `json:"video_prompt,omitempty"`          // 视频生成提示词
-	ChapterVideoPrompts []model.VideoPrompt `json:"chapter_video_prompts,omitempty"` // 视频生成提示词
-	ChapterVideoURLs    map[int]string      `json:"chapter_video_urls,omitempty"`
-	VideoURL            string              `json:"video_url,omitempty"`           // 最终生成的视频URL
-	NeedToEditStory     bool                `json:"need_to_edit_story,omitempty"`  // 是否需要编辑故事
-	StoryFeedback       string              `json:"story_feedback,omitempty"`      // 故事反馈
-	NeedToEditImage     bool                `json:"need_to_edit_image,omitempty"`  // 是否需要编辑图片
-	ImageFeedback       string              `json:"image_feedback,omitempty"`      // 图片反馈
-	NeedToEditImages    bool                `json:"need_to_edit_images,omitempty"` // 是否需要编辑图片
+	State                string                      `json:"state"`                           // 当前状态
+	Story                *model.Story                `json:"story,omitempty"`                 // 生成的故事
+	ImagePrompts         []model.ImagePrompt         `json:"image_prompts,omitempty"`         // 图片生成提示词
+	GeneratedImages      map[int][]string            `json:"generated_images,omitempty"`      // 生成的图片，key为章节索引
+	VideoPrompt          string                      `json:"video_prompt,omitempty"`          // 视频生成提示词
+	ChapterVideoPrompts  []model.VideoPrompt         `json:"chapter_video_prompts,omitempty"` // 视频生成提示词
+	ChapterVideoURLs     map[int]string              `json:"chapter_video_urls,omitempty"`
+	ChapterVideoFailures map[int]ChapterVideoFailure `json:"chapter_video_failures,omitempty"` // 视频生成失败的章节，key为章节索引
+	VideoURL             string                      `json:"video_url,omitempty"`              // 最终生成的视频URL
+	NeedToEditStory      bool                        `json:"need_to_edit_story,omitempty"`     // 是否需要编辑故事
+	StoryFeedback        string                      `json:"story_feedback,omitempty"`         // 故事反馈
+	StoryRevisions       map[int]string              `json:"story_revisions,omitempty"`        // 需要修改的故事章节及意见，key为章节索引
+	NeedToEditImage      bool                        `json:"need_to_edit_image,omitempty"`     // 是否需要编辑图片
+	ImageRevisions       map[int]string              `json:"image_revisions,omitempty"`        // 需要重新生成的章节图片及意见，key为章节索引
+	NeedToEditImages     bool                        `json:"need_to_edit_images,omitempty"`    // 是否需要编辑图片
+	AbortedVideoTasks    []AbortedVideoTask          `json:"aborted_video_tasks,omitempty"`    // 被中止的视频任务
 }
 
-var sessions map[string]*IllustrationSessionState = make(map[string]*IllustrationSessionState) // 会话状态管理
-var sessionMu sync.RWMutex
+var sessionStore store.SessionStore = store.NewMemoryStore() // 会话状态存储
 
-func GetSessionID(ctx context.Context) string {
-	sessionID, ok := ctx.Value("sessionID").(string)
-	if !ok {
-		return "unknow"
+// SetSessionStore 设置会话状态的持久化存储，需在创建Agent之前调用
+func SetSessionStore(s store.SessionStore) {
+	sessionStore = s
+}
+
+var assetArchiver = store.NewAssetArchiver(nil, nil) // 生成资源转存，默认不转存
+
+// SetAssetArchiver 设置生成的图片、视频的转存方式，需在创建Agent之前调用
+func SetAssetArchiver(a *store.AssetArchiver) {
+	assetArchiver = a
+}
+
+type sessionIDKey struct{}
+
+// WithSessionID 将会话ID注入context，Agent通过GetSessionID读取，以隔离不同用户的会话状态
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey{}, sessionID)
+}
+
+// ErrNoSessionID context中没有会话ID，调用方需先用WithSessionID注入
+var ErrNoSessionID = errors.New("session id not found in context")
+
+// GetSessionID 读取WithSessionID注入的会话ID，未注入时返回ErrNoSessionID
+func GetSessionID(ctx context.Context) (string, error) {
+	sessionID, ok := ctx.Value(sessionIDKey{}).(string)
+	if !ok || sessionID == "" {
+		return "", ErrNoSessionID
 	}
-	return sessionID
+	return sessionID, nil
 }
 
-func GetSessionState(ctx context.Context) *IllustrationSessionState {
-	sessionMu.RLock()
-	defer sessionMu.RUnlock()
+func newSessionState() *IllustrationSessionState {
+	return &IllustrationSessionState{
+		State:               "init",
+		Story:               &model.Story{},
+		ImagePrompts:        []model.ImagePrompt{},
+		GeneratedImages:     make(map[int][]string),
+		ChapterVideoPrompts: []model.VideoPrompt{},
+		ChapterVideoURLs:    make(map[int]string),
+	}
+}
 
-	state, exists := sessions[GetSessionID(ctx)]
+// GetSessionState 读取当前会话的状态，会话尚无状态时返回新的状态
+// 读取失败时返回错误，不能用新状态代替，否则随后的保存会覆盖已持久化的会话
+func GetSessionState(ctx context.Context) (*IllustrationSessionState, error) {
+	sessionID, err := GetSessionID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	state, exists, err := LoadSessionState(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("load session %s: %w", sessionID, err)
+	}
 	if !exists {
-		// 创建新的会话状态
-		state = &IllustrationSessionState{
-			State:               "init",
-			Story:               &model.Story{},
-			ImagePrompts:        []model.ImagePrompt{},
-			GeneratedImages:     make(map[int][]string),
-			ChapterVideoPrompts: []model.VideoPrompt{},
-			ChapterVideoURLs:    make(map[int]string),
-		}
+		return newSessionState(), nil
 	}
-
-	return state
+	return state, nil
 }
 
-func SaveSessionState(ctx context.Context, state *IllustrationSessionState) {
-	sessionMu.Lock()
-	defer sessionMu.Unlock()
+// LoadSessionState 读取指定会话已保存的状态，会话不存在时返回false
+func LoadSessionState(ctx context.Context, sessionID string) (*IllustrationSessionState, bool, error) {
+	data, exists, err := sessionStore.GetState(ctx, sessionID)
+	if err != nil || !exists {
+		return nil, false, err
+	}
 
-	sessions[GetSessionID(ctx)] = state
+	state := newSessionState()
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal session state: %w", err)
+	}
+	if state.Story == nil {
+		state.Story = &model.Story{}
+	}
+	return state, true, nil
+}
+
+// SaveSessionState 保存当前会话的状态
+func SaveSessionState(ctx context.Context, state *IllustrationSessionState) error {
+	sessionID, err := GetSessionID(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshal session state: %w", err)
+	}
+	if err := sessionStore.SetState(ctx, sessionID, data); err != nil {
+		return fmt.Errorf("save session %s: %w", sessionID, err)
+	}
+	return nil
 }
 
-func NewMKAgent(ctx context.Context) adk.Agent {
+func NewMKAgent(ctx context.Context, cfg *config.Config) adk.Agent {
 	la, err := adk.NewSequentialAgent(ctx, &adk.SequentialAgentConfig{
 		Name:        "插画Agent",
 		Description: "一个可以生成儿童插画的Agent",
 		SubAgents: []adk.Agent{
-			NewStoryAgent(ctx),
-			NewImageAgent(ctx),
+			NewStoryAgent(ctx, cfg),
+			NewImageAgent(ctx, cfg),
 		},
 	})
 	if err != nil {
@@ -80,3 +143,12 @@ func NewMKAgent(ctx context.Context) adk.Agent {
 
 	return la
 }
+
+// recoverAsErrorEvent 将agent goroutine中的panic转换为错误事件，避免单个会话的异常导致整个服务退出
+// 需在defer gen.Close()之后defer调用
+func recoverAsErrorEvent(gen *adk.AsyncGenerator[*adk.AgentEvent]) {
+	if p := recover(); p != nil {
+		log.Printf("agent panic: %v\n%s", p, debug.Stack())
+		gen.Send(&adk.AgentEvent{Err: fmt.Errorf("agent panic: %v", p)})
+	}
+}
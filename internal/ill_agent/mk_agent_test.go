@@ -0,0 +1,220 @@
+package ill_agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/model"
+	"illustration2/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/adk"
+)
+
+// newFakeChatServer 模拟Ark的chat completions接口，返回以用户输入（故事主题）为标题的两章故事
+func newFakeChatServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream   bool `json:"stream"`
+			Messages []struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		theme := ""
+		for _, m := range req.Messages {
+			if m.Role == "user" {
+				json.Unmarshal(m.Content, &theme)
+			}
+		}
+		// 拉长响应时间，让两个会话的运行交错
+		time.Sleep(20 * time.Millisecond)
+		story := fmt.Sprintf("第1章: %s#关于%s的开头。##第2章: %s的结尾#关于%s的结尾。", theme, theme, theme, theme)
+
+		if !req.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"id": "chat-1", "object": "chat.completion", "created": time.Now().Unix(), "model": "fake",
+				"choices": []map[string]any{{"index": 0, "finish_reason": "stop",
+					"message": map[string]any{"role": "assistant", "content": story}}},
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, part := range []string{story[:len(story)/2], story[len(story)/2:]} {
+			chunk := map[string]any{
+				"id": "chat-1", "object": "chat.completion.chunk", "created": time.Now().Unix(), "model": "fake",
+				"choices": []map[string]any{{"index": 0, "delta": map[string]any{"role": "assistant", "content": part}}},
+			}
+			if i == 1 {
+				chunk["choices"].([]map[string]any)[0]["finish_reason"] = "stop"
+			}
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMKAgentParallelSessionsIsolated(t *testing.T) {
+	SetSessionStore(store.NewMemoryStore())
+	srv := newFakeChatServer(t)
+	cfg := config.Default()
+	cfg.Ark.APIKey = "test"
+	cfg.Ark.BaseURL = srv.URL
+
+	themes := map[string]string{
+		"session-a": "小兔子找月亮",
+		"session-b": "恐龙去上学",
+	}
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for sessionID, theme := range themes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runner := adk.NewRunner(ctx, adk.RunnerConfig{
+				EnableStreaming: true,
+				Agent:           NewMKAgent(ctx, cfg),
+				CheckPointStore: sessionStore,
+			})
+			iter := runner.Query(WithSessionID(ctx, sessionID), theme, adk.WithCheckPointID(sessionID))
+			var last *adk.AgentEvent
+			for {
+				event, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if event.Err != nil {
+					t.Errorf("%s: %v", sessionID, event.Err)
+					return
+				}
+				last = event
+			}
+			if last == nil || last.Action == nil || last.Action.Interrupted == nil {
+				t.Errorf("%s: expected story review interrupt, got %+v", sessionID, last)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for sessionID, theme := range themes {
+		state, exists, err := LoadSessionState(ctx, sessionID)
+		if err != nil || !exists {
+			t.Fatalf("%s: load state: exists=%v err=%v", sessionID, exists, err)
+		}
+		if len(state.Story.Chapters) != 2 {
+			t.Fatalf("%s: got %d chapters, want 2", sessionID, len(state.Story.Chapters))
+		}
+		for _, chapter := range state.Story.Chapters {
+			for otherID, other := range themes {
+				if otherID != sessionID && strings.Contains(chapter.Title+chapter.Content, other) {
+					t.Errorf("%s: chapter %q contains theme of %s", sessionID, chapter.Title, otherID)
+				}
+			}
+			if !strings.Contains(chapter.Title, theme) {
+				t.Errorf("%s: chapter %q does not belong to theme %q", sessionID, chapter.Title, theme)
+			}
+		}
+	}
+}
+
+func TestGetSessionStateWithoutSessionID(t *testing.T) {
+	if _, err := GetSessionState(context.Background()); !errors.Is(err, ErrNoSessionID) {
+		t.Fatalf("got %v, want ErrNoSessionID", err)
+	}
+}
+
+func TestSessionStatePersistsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := store.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSessionStore(fileStore)
+	t.Cleanup(func() { SetSessionStore(store.NewMemoryStore()) })
+	ctx := WithSessionID(context.Background(), "restart")
+	state, err := GetSessionState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.State = "story_review"
+	state.Story.Chapters = []model.StoryChapter{{Title: "第1章", Content: "开头"}}
+	if err := SaveSessionState(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开同一目录，模拟进程重启
+	fileStore, err = store.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSessionStore(fileStore)
+	state, err = GetSessionState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != "story_review" || len(state.Story.Chapters) != 1 || state.Story.Chapters[0].Content != "开头" {
+		t.Errorf("state after restart = %+v", state)
+	}
+}
+
+func TestGetSessionStateCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := store.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSessionStore(fileStore)
+	t.Cleanup(func() { SetSessionStore(store.NewMemoryStore()) })
+	ctx := WithSessionID(context.Background(), "corrupt")
+	corrupt := []byte(`{"state":"story_review","story":`)
+	if err := fileStore.SetState(ctx, "corrupt", corrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读取失败时返回错误，不能返回新状态让agent覆盖已保存的会话
+	if state, err := GetSessionState(ctx); err == nil {
+		t.Fatalf("GetSessionState of corrupt state = %+v, want error", state)
+	}
+	if data, _, _ := fileStore.GetState(ctx, "corrupt"); string(data) != string(corrupt) {
+		t.Errorf("corrupt state overwritten: %q", data)
+	}
+}
+
+func TestSaveSessionStateError(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := store.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSessionStore(fileStore)
+	t.Cleanup(func() { SetSessionStore(store.NewMemoryStore()) })
+	// 会话目录被同名文件占用，写入失败
+	if err := os.WriteFile(filepath.Join(dir, "blocked"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSessionState(WithSessionID(context.Background(), "blocked"), newSessionState()); err == nil {
+		t.Error("SaveSessionState: got nil error")
+	}
+	if err := SaveSessionState(context.Background(), newSessionState()); !errors.Is(err, ErrNoSessionID) {
+		t.Errorf("SaveSessionState without session id: got %v, want ErrNoSessionID", err)
+	}
+}
@@ -0,0 +1,142 @@
+package ill_agent
+
+import (
+	"fmt"
+	"illustration2/internal/volc"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/adk"
+)
+
+const progressHeartbeat = 15 * time.Second // 视频任务状态未变化时下发进度事件的最小间隔
+
+// Progress 长耗时生成任务的进度信息，随AgentEvent的CustomizedOutput下发
+type Progress struct {
+	Stage          string `json:"stage"`                     // 所处阶段，如image_generate
+	ChapterIndex   int    `json:"chapter_index"`             // 章节索引，从0开始，整体视频为-1
+	TaskID         string `json:"task_id,omitempty"`         // Ark视频任务ID
+	Status         string `json:"status"`                    // 章节状态，如created、queued、running、succeeded、failed
+	Completed      int    `json:"completed"`                 // 已完成章节数
+	Total          int    `json:"total"`                     // 总章节数
+	Percent        int    `json:"percent"`                   // 已完成章节的百分比
+	ElapsedSeconds int    `json:"elapsed_seconds,omitempty"` // 章节视频任务创建后已用时（秒）
+	Message        string `json:"message"`                   // 可读的进度描述
+}
+
+// newProgressEvent 进度事件只带CustomizedOutput，没有MessageOutput，不会进入后续agent的对话历史
+func newProgressEvent(p *Progress) *adk.AgentEvent {
+	if p.Total > 0 {
+		p.Percent = p.Completed * 100 / p.Total
+	}
+	return &adk.AgentEvent{
+		Output: &adk.AgentOutput{
+			CustomizedOutput: p,
+		},
+	}
+}
+
+// videoProgress 汇总并发视频任务的进度并下发进度事件，可在多个goroutine中使用
+type videoProgress struct {
+	gen   *adk.AsyncGenerator[*adk.AgentEvent]
+	stage string
+	total int
+
+	mu        sync.Mutex
+	completed int
+	tasks     map[int]*videoTaskProgress
+}
+
+type videoTaskProgress struct {
+	taskID   string
+	status   string
+	started  time.Time
+	lastSent time.Time
+}
+
+func newVideoProgress(gen *adk.AsyncGenerator[*adk.AgentEvent], stage string, total int) *videoProgress {
+	return &videoProgress{gen: gen, stage: stage, total: total, tasks: make(map[int]*videoTaskProgress)}
+}
+
+// created 视频任务已创建
+func (p *videoProgress) created(chapterIdx int, taskID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := &videoTaskProgress{taskID: taskID, status: "created", started: time.Now()}
+	p.tasks[chapterIdx] = t
+	p.send(chapterIdx, t, fmt.Sprintf("%s任务已创建：%s", videoLabel(chapterIdx), taskID))
+}
+
+// onUpdate 返回用作WaitOptions.OnUpdate的回调，任务状态变化或超过progressHeartbeat未下发时下发进度事件
+// 结束状态由finished下发
+func (p *videoProgress) onUpdate(chapterIdx int) func(result *volc.VideoTaskResult) {
+	return func(result *volc.VideoTaskResult) {
+		if result.Status.Terminal() {
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		t, ok := p.tasks[chapterIdx]
+		if !ok {
+			return
+		}
+		status := string(result.Status)
+		if status == t.status && time.Since(t.lastSent) < progressHeartbeat {
+			return
+		}
+		t.status = status
+		elapsed := int(time.Since(t.started).Seconds())
+		if result.Status == volc.VideoTaskQueued {
+			p.send(chapterIdx, t, fmt.Sprintf("%s任务排队中，已用时%d秒", videoLabel(chapterIdx), elapsed))
+		} else {
+			p.send(chapterIdx, t, fmt.Sprintf("%s生成中，已用时%d秒", videoLabel(chapterIdx), elapsed))
+		}
+	}
+}
+
+// finished 章节视频生成结束，err不为nil表示失败
+func (p *videoProgress) finished(chapterIdx int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.tasks[chapterIdx]
+	if !ok {
+		t = &videoTaskProgress{}
+		p.tasks[chapterIdx] = t
+	}
+	p.completed++
+	if err != nil {
+		t.status = "failed"
+		p.send(chapterIdx, t, fmt.Sprintf("%s生成失败（%d/%d）", videoLabel(chapterIdx), p.completed, p.total))
+		return
+	}
+	t.status = "succeeded"
+	p.send(chapterIdx, t, fmt.Sprintf("%s生成完成（%d/%d）", videoLabel(chapterIdx), p.completed, p.total))
+}
+
+// send 下发进度事件，需持有p.mu
+func (p *videoProgress) send(chapterIdx int, t *videoTaskProgress, message string) {
+	progress := &Progress{
+		Stage:        p.stage,
+		ChapterIndex: chapterIdx,
+		TaskID:       t.taskID,
+		Status:       t.status,
+		Completed:    p.completed,
+		Total:        p.total,
+		Message:      message,
+	}
+	if !t.started.IsZero() {
+		progress.ElapsedSeconds = int(time.Since(t.started).Seconds())
+	}
+	t.lastSent = time.Now()
+	p.gen.Send(newProgressEvent(progress))
+}
+
+func videoLabel(chapterIdx int) string {
+	if chapterIdx < 0 {
+		return "视频"
+	}
+	return fmt.Sprintf("第%d章视频", chapterIdx+1)
+}
@@ -0,0 +1,157 @@
+package ill_agent
+
+import (
+	"context"
+	"illustration2/internal/store"
+	"testing"
+
+	"github.com/cloudwego/eino/adk"
+)
+
+// progressInterruptAgent 先下发进度事件再中断，恢复后再下发一次进度事件后结束
+type progressInterruptAgent struct{}
+
+func (progressInterruptAgent) Name(ctx context.Context) string        { return "progress" }
+func (progressInterruptAgent) Description(ctx context.Context) string { return "progress" }
+
+func (progressInterruptAgent) Run(ctx context.Context, input *adk.AgentInput,
+	options ...adk.AgentRunOption) *adk.AsyncIterator[*adk.AgentEvent] {
+	iter, gen := adk.NewAsyncIteratorPair[*adk.AgentEvent]()
+	go func() {
+		defer gen.Close()
+		gen.Send(newProgressEvent(&Progress{Stage: "chapter_video_generate", Status: "running", Total: 2, Message: "第1章视频生成中"}))
+		gen.Send(adk.StatefulInterrupt(ctx, &ChapterVideoRetryRequest{Message: "retry?"}, "chapter_video_retry"))
+	}()
+	return iter
+}
+
+func (progressInterruptAgent) Resume(ctx context.Context, info *adk.ResumeInfo,
+	opts ...adk.AgentRunOption) *adk.AsyncIterator[*adk.AgentEvent] {
+	iter, gen := adk.NewAsyncIteratorPair[*adk.AgentEvent]()
+	go func() {
+		defer gen.Close()
+		gen.Send(newProgressEvent(&Progress{Stage: "chapter_video_generate", Status: "succeeded", Completed: 2, Total: 2, Message: "完成"}))
+	}()
+	return iter
+}
+
+func TestResumeAfterProgressEvent(t *testing.T) {
+	ctx := context.Background()
+	a, err := adk.NewSequentialAgent(ctx, &adk.SequentialAgentConfig{
+		Name:        "sequence",
+		Description: "sequence",
+		SubAgents:   []adk.Agent{progressInterruptAgent{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints := store.NewMemoryStore()
+	runner := adk.NewRunner(ctx, adk.RunnerConfig{Agent: a, CheckPointStore: checkpoints})
+
+	iter := runner.Query(ctx, "start", adk.WithCheckPointID("s1"))
+	var interruptID string
+	for {
+		event, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if event.Err != nil {
+			t.Fatalf("run: %v", event.Err)
+		}
+		if event.Action != nil && event.Action.Interrupted != nil {
+			interruptID = event.Action.Interrupted.InterruptContexts[0].ID
+		}
+	}
+	if interruptID == "" {
+		t.Fatal("no interrupt event")
+	}
+
+	iter, err = runner.ResumeWithParams(ctx, "s1", &adk.ResumeParams{Targets: map[string]any{interruptID: "retry"}})
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	var resumed bool
+	for {
+		event, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if event.Err != nil {
+			t.Fatalf("resume: %v", event.Err)
+		}
+		if event.Output != nil {
+			if p, ok := event.Output.CustomizedOutput.(*Progress); ok && p.Status == "succeeded" {
+				resumed = true
+			}
+		}
+	}
+	if !resumed {
+		t.Fatal("resumed run did not reach the agent")
+	}
+}
+
+// historyAgent 记录收到的对话历史
+type historyAgent struct{ messages *[]adk.Message }
+
+func (historyAgent) Name(ctx context.Context) string        { return "history" }
+func (historyAgent) Description(ctx context.Context) string { return "history" }
+
+func (a historyAgent) Run(ctx context.Context, input *adk.AgentInput,
+	options ...adk.AgentRunOption) *adk.AsyncIterator[*adk.AgentEvent] {
+	*a.messages = input.Messages
+	iter, gen := adk.NewAsyncIteratorPair[*adk.AgentEvent]()
+	gen.Close()
+	return iter
+}
+
+// progressAgent 只下发一次进度事件
+type progressAgent struct{}
+
+func (progressAgent) Name(ctx context.Context) string        { return "progress" }
+func (progressAgent) Description(ctx context.Context) string { return "progress" }
+
+func (progressAgent) Run(ctx context.Context, input *adk.AgentInput,
+	options ...adk.AgentRunOption) *adk.AsyncIterator[*adk.AgentEvent] {
+	iter, gen := adk.NewAsyncIteratorPair[*adk.AgentEvent]()
+	gen.Send(newProgressEvent(&Progress{Stage: "image_generate", Completed: 1, Total: 4, Message: "第1章插图生成完成"}))
+	gen.Close()
+	return iter
+}
+
+func TestProgressEventNotInHistory(t *testing.T) {
+	ctx := context.Background()
+	var history []adk.Message
+	a, err := adk.NewSequentialAgent(ctx, &adk.SequentialAgentConfig{
+		Name:        "sequence",
+		Description: "sequence",
+		SubAgents:   []adk.Agent{progressAgent{}, historyAgent{messages: &history}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := adk.NewRunner(ctx, adk.RunnerConfig{Agent: a})
+
+	iter := runner.Query(ctx, "start")
+	var progress *Progress
+	for {
+		event, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if event.Err != nil {
+			t.Fatal(event.Err)
+		}
+		if event.Output != nil {
+			if event.Output.MessageOutput != nil {
+				t.Errorf("progress event has MessageOutput: %+v", event.Output.MessageOutput)
+			}
+			progress, _ = event.Output.CustomizedOutput.(*Progress)
+		}
+	}
+	if progress == nil || progress.Percent != 25 {
+		t.Fatalf("progress = %+v", progress)
+	}
+	if len(history) != 1 || history[0].Content != "start" {
+		t.Errorf("history = %v, want only the user input", history)
+	}
+}
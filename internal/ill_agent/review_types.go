@@ -0,0 +1,202 @@
+package ill_agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// 审核中断允许用户执行的操作
+const (
+	ReviewActionApprove = "approve" // 通过，回复ok
+	ReviewActionRevise  = "revise"  // 提供反馈意见重新生成
+	ReviewActionRetry   = "retry"   // 重试失败的章节，可修改提示词
+)
+
+// StoryReviewChapter 待审核的故事章节
+type StoryReviewChapter struct {
+	ChapterIndex int    `json:"chapter_index"` // 章节索引，从0开始
+	Title        string `json:"title"`         // 章节标题
+	Body         string `json:"body"`          // 章节内容
+}
+
+// StoryReviewRequest 故事审核中断信息
+type StoryReviewRequest struct {
+	Message        string               `json:"message"`         // 提示语
+	Chapters       []StoryReviewChapter `json:"chapters"`        // 待审核的章节
+	AllowedActions []string             `json:"allowed_actions"` // 允许的操作
+}
+
+// ImageReviewChapter 待审核的章节图片
+type ImageReviewChapter struct {
+	ChapterIndex int      `json:"chapter_index"` // 章节索引，从0开始
+	Title        string   `json:"title"`         // 章节标题
+	ImageURLs    []string `json:"image_urls"`    // 章节组图
+}
+
+// ImageReviewRequest 图片审核中断信息
+type ImageReviewRequest struct {
+	Message        string               `json:"message"`         // 提示语
+	Chapters       []ImageReviewChapter `json:"chapters"`        // 待审核的章节图片
+	AllowedActions []string             `json:"allowed_actions"` // 允许的操作
+}
+
+// ChapterVideoFailure 视频生成失败的章节
+type ChapterVideoFailure struct {
+	ChapterIndex int    `json:"chapter_index"` // 章节索引，从0开始
+	Title        string `json:"title"`         // 章节标题
+	Prompt       string `json:"prompt"`        // 使用的视频提示词，可修改后重试
+	Error        string `json:"error"`         // 面向用户的失败原因
+	Retryable    bool   `json:"retryable"`     // 原样重试是否可能成功，否则需修改提示词
+}
+
+// ChapterVideoRetryRequest 章节视频部分失败的中断信息
+type ChapterVideoRetryRequest struct {
+	Message        string                `json:"message"`         // 提示语
+	Failed         []ChapterVideoFailure `json:"failed"`          // 失败的章节
+	Completed      map[int]string        `json:"completed"`       // 已生成的章节视频，key为章节索引
+	AllowedActions []string              `json:"allowed_actions"` // 允许的操作
+}
+
+func init() {
+	// 中断信息和进度事件（CustomizedOutput）随checkpoint一起gob序列化，需注册具体类型
+	schema.RegisterName[*StoryReviewRequest]("illustration2_story_review_request")
+	schema.RegisterName[*ImageReviewRequest]("illustration2_image_review_request")
+	schema.RegisterName[*ChapterVideoRetryRequest]("illustration2_chapter_video_retry_request")
+	schema.RegisterName[*Progress]("illustration2_progress")
+}
+
+// ReviewFeedback 审核结果，按章节给出通过或修改意见，key为章节索引
+// 恢复输入支持三种形式：
+//   - "ok"：全部章节通过
+//   - {"approve":[0,2],"revise":{"1":"make the dinosaur green"}}：仅修改revise中的章节，其余章节保持不变
+//   - 其他文本：作为所有章节的修改意见
+type ReviewFeedback struct {
+	Approve []int          `json:"approve,omitempty"`
+	Revise  map[int]string `json:"revise,omitempty"`
+}
+
+// ParseReviewFeedback 解析审核恢复输入，chapterCount为当前章节数，用于校验章节索引
+func ParseReviewFeedback(input string, chapterCount int) (*ReviewFeedback, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, errors.New("review feedback is empty")
+	}
+
+	feedback := &ReviewFeedback{Revise: make(map[int]string)}
+	if strings.ToLower(input) == "ok" {
+		for i := 0; i < chapterCount; i++ {
+			feedback.Approve = append(feedback.Approve, i)
+		}
+		return feedback, nil
+	}
+
+	if !strings.HasPrefix(input, "{") {
+		for i := 0; i < chapterCount; i++ {
+			feedback.Revise[i] = input
+		}
+		return feedback, nil
+	}
+
+	if err := json.Unmarshal([]byte(input), feedback); err != nil {
+		return nil, fmt.Errorf("invalid review feedback: %w", err)
+	}
+	for _, idx := range feedback.Approve {
+		if idx < 0 || idx >= chapterCount {
+			return nil, fmt.Errorf("approved chapter index %d out of range [0, %d)", idx, chapterCount)
+		}
+		if _, ok := feedback.Revise[idx]; ok {
+			return nil, fmt.Errorf("chapter %d is both approved and revised", idx)
+		}
+	}
+	for idx, text := range feedback.Revise {
+		if idx < 0 || idx >= chapterCount {
+			return nil, fmt.Errorf("revised chapter index %d out of range [0, %d)", idx, chapterCount)
+		}
+		if strings.TrimSpace(text) == "" {
+			delete(feedback.Revise, idx)
+		}
+	}
+	return feedback, nil
+}
+
+// NeedRevision 是否有章节需要修改
+func (f *ReviewFeedback) NeedRevision() bool {
+	return len(f.Revise) > 0
+}
+
+// chapters 返回需要修改的章节索引，按从小到大排序
+func (f *ReviewFeedback) chapters() []int {
+	indices := make([]int, 0, len(f.Revise))
+	for idx := range f.Revise {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// ChapterVideoRetry 重试失败章节视频的恢复输入，Prompts的key为章节索引
+// 恢复输入支持三种形式：
+//   - "retry"或"ok"：按原提示词重试全部失败章节
+//   - {"chapters":[1],"prompts":{"2":"a calmer scene"}}：只重试chapters和prompts中的章节，prompts中的章节使用新提示词
+//   - 其他文本：作为全部失败章节的新提示词
+type ChapterVideoRetry struct {
+	Chapters []int          `json:"chapters,omitempty"`
+	Prompts  map[int]string `json:"prompts,omitempty"`
+}
+
+// ParseChapterVideoRetry 解析重试恢复输入，failed为失败的章节索引，只允许重试这些章节
+func ParseChapterVideoRetry(input string, failed []int) (*ChapterVideoRetry, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, errors.New("retry input is empty")
+	}
+
+	retry := &ChapterVideoRetry{Prompts: make(map[int]string)}
+	switch lower := strings.ToLower(input); {
+	case lower == "ok" || lower == ReviewActionRetry:
+		retry.Chapters = append(retry.Chapters, failed...)
+		return retry, nil
+	case !strings.HasPrefix(input, "{"):
+		for _, idx := range failed {
+			retry.Prompts[idx] = input
+		}
+		return retry, nil
+	}
+
+	if err := json.Unmarshal([]byte(input), retry); err != nil {
+		return nil, fmt.Errorf("invalid retry input: %w", err)
+	}
+	for _, idx := range retry.Chapters {
+		if !slices.Contains(failed, idx) {
+			return nil, fmt.Errorf("chapter %d has no failed video to retry", idx)
+		}
+	}
+	for idx, prompt := range retry.Prompts {
+		if !slices.Contains(failed, idx) {
+			return nil, fmt.Errorf("chapter %d has no failed video to retry", idx)
+		}
+		if strings.TrimSpace(prompt) == "" {
+			delete(retry.Prompts, idx)
+		}
+	}
+	if len(retry.chapters()) == 0 {
+		return nil, errors.New("no chapter selected to retry")
+	}
+	return retry, nil
+}
+
+// chapters 返回需要重试的章节索引，按从小到大排序
+func (r *ChapterVideoRetry) chapters() []int {
+	indices := slices.Clone(r.Chapters)
+	for idx := range r.Prompts {
+		indices = append(indices, idx)
+	}
+	slices.Sort(indices)
+	return slices.Compact(indices)
+}
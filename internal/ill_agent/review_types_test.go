@@ -0,0 +1,96 @@
+package ill_agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReviewFeedback(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *ReviewFeedback
+		wantErr string
+	}{
+		{"ok", "ok", &ReviewFeedback{Approve: []int{0, 1, 2}, Revise: map[int]string{}}, ""},
+		{"ok case and spaces", "  OK\n", &ReviewFeedback{Approve: []int{0, 1, 2}, Revise: map[int]string{}}, ""},
+		{"plain text revises all", "make it shorter", &ReviewFeedback{Revise: map[int]string{0: "make it shorter", 1: "make it shorter", 2: "make it shorter"}}, ""},
+		{"json approve all", `{"approve":[0,1,2]}`, &ReviewFeedback{Approve: []int{0, 1, 2}, Revise: map[int]string{}}, ""},
+		{"json revise", `{"approve":[0,2],"revise":{"1":"make the dinosaur green"}}`,
+			&ReviewFeedback{Approve: []int{0, 2}, Revise: map[int]string{1: "make the dinosaur green"}}, ""},
+		// 空白的修改意见视为不修改
+		{"blank revision dropped", `{"revise":{"1":"  ","2":"brighter"}}`, &ReviewFeedback{Revise: map[int]string{2: "brighter"}}, ""},
+		{"empty", "  ", nil, "empty"},
+		{"malformed json", `{"revise":`, nil, "invalid review feedback"},
+		{"non numeric key", `{"revise":{"first":"x"}}`, nil, "invalid review feedback"},
+		{"approve out of range", `{"approve":[3]}`, nil, "approved chapter index 3 out of range"},
+		{"revise out of range", `{"revise":{"-1":"x"}}`, nil, "revised chapter index -1 out of range"},
+		{"approved and revised", `{"approve":[1],"revise":{"1":"x"}}`, nil, "chapter 1 is both approved and revised"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReviewFeedback(tt.input, 3)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %+v, %v, want error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got.NeedRevision() != (len(tt.want.Revise) > 0) {
+				t.Errorf("NeedRevision = %v", got.NeedRevision())
+			}
+		})
+	}
+}
+
+func TestParseChapterVideoRetry(t *testing.T) {
+	failed := []int{1, 3}
+	tests := []struct {
+		name         string
+		input        string
+		wantChapters []int
+		wantPrompts  map[int]string
+		wantErr      string
+	}{
+		{"retry all", "retry", []int{1, 3}, map[int]string{}, ""},
+		{"ok retries all", " OK ", []int{1, 3}, map[int]string{}, ""},
+		{"plain text prompts all", "a calmer scene", []int{1, 3}, map[int]string{1: "a calmer scene", 3: "a calmer scene"}, ""},
+		{"json chapters", `{"chapters":[3]}`, []int{3}, map[int]string{}, ""},
+		{"json prompts", `{"chapters":[1],"prompts":{"3":"a calmer scene"}}`, []int{1, 3}, map[int]string{3: "a calmer scene"}, ""},
+		// 重复的章节只重试一次
+		{"duplicate indices", `{"chapters":[3,1,3],"prompts":{"3":"a calmer scene"}}`, []int{1, 3}, map[int]string{3: "a calmer scene"}, ""},
+		{"blank prompt dropped", `{"chapters":[1],"prompts":{"3":" "}}`, []int{1}, map[int]string{}, ""},
+		// 什么都没选是错误，重试全部需要明确输入retry
+		{"empty selection", `{}`, nil, nil, "no chapter selected to retry"},
+		{"empty chapters", `{"chapters":[],"prompts":{"1":""}}`, nil, nil, "no chapter selected to retry"},
+		{"empty", "", nil, nil, "empty"},
+		{"chapter not failed", `{"chapters":[2]}`, nil, nil, "chapter 2 has no failed video to retry"},
+		{"out of range", `{"chapters":[99]}`, nil, nil, "chapter 99 has no failed video to retry"},
+		{"prompt out of range", `{"prompts":{"-1":"x"}}`, nil, nil, "chapter -1 has no failed video to retry"},
+		{"malformed json", `{"chapters":"1"}`, nil, nil, "invalid retry input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseChapterVideoRetry(tt.input, failed)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %+v, %v, want error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.chapters(), tt.wantChapters) || !reflect.DeepEqual(got.Prompts, tt.wantPrompts) {
+				t.Errorf("got chapters %v, prompts %v, want %v, %v", got.chapters(), got.Prompts, tt.wantChapters, tt.wantPrompts)
+			}
+		})
+	}
+}
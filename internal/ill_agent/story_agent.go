@@ -3,25 +3,31 @@ package ill_agent
 import (
 	"context"
 	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/volc"
 	"log"
 
-	"os"
-
 	"github.com/cloudwego/eino-ext/components/model/ark"
 	"github.com/cloudwego/eino/adk"
 	arkModel "github.com/volcengine/volcengine-go-sdk/service/arkruntime/model"
 )
 
-func NewStoryAgent(ctx context.Context) adk.Agent {
-	apiKey := os.Getenv("ARK_API_KEY")
+func NewStoryAgent(ctx context.Context, cfg *config.Config) adk.Agent {
+	// 经由ArkClient的HTTP客户端发送，与其他Ark请求共用chat接口的限流
+	arkClient := volc.NewArkClient(cfg.Ark, cfg.Ark.Timeout)
 	chatModel, err := ark.NewChatModel(context.Background(), &ark.ChatModelConfig{
-		APIKey:  apiKey,
-		Model:   "ep-20250220181854-c8s82",
-		BaseURL: "https://ark.cn-beijing.volces.com/api/v3",
+		APIKey:     cfg.Ark.APIKey,
+		Model:      cfg.Models.Endpoint(cfg.Models.Chat),
+		BaseURL:    cfg.Ark.BaseURL + "/api/v3",
+		Region:     cfg.Ark.Region,
+		HTTPClient: arkClient.ChatHTTPClient(),
 		Thinking: &arkModel.Thinking{
 			Type: arkModel.ThinkingTypeDisabled,
 		},
 	})
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to create chat model: %w", err))
+	}
 
 	a, err := adk.NewChatModelAgent(ctx, &adk.ChatModelAgentConfig{
 		Name:        "故事生成助手",
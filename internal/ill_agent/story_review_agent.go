@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"illustration2/internal/model"
 	"log"
+	"slices"
 	"strings"
 
 	"github.com/cloudwego/eino/adk"
@@ -31,6 +32,7 @@ func (r StoryReviewAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
 		contentToReview, ok := adk.GetSessionValue(ctx, "story_content_to_review")
 		// log.Printf("story_content_to_review: %v\n", contentToReview)
@@ -61,24 +63,35 @@ func (r StoryReviewAgent) Run(ctx context.Context, input *adk.AgentInput,
 				Content: content,
 			})
 		}
-		sessionState := GetSessionState(ctx)
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
+		if len(sessionState.StoryRevisions) > 0 {
+			storyChapters = mergeRevisedChapters(sessionState.Story.Chapters, storyChapters, sessionState.StoryRevisions)
+		}
+		sessionState.StoryRevisions = nil
 		sessionState.Story.Chapters = storyChapters
 		sessionState.State = "story_review"
-		SaveSessionState(ctx, sessionState)
-
-		infoList := make([]map[string]interface{}, 0)
-		infoList = append(infoList, map[string]interface{}{
-			"text": "已生成故事如下：",
-		})
-		for _, chapter := range sessionState.Story.Chapters {
-			infoList = append(infoList, map[string]interface{}{
-				"text": fmt.Sprintf("%s\n%s\n", chapter.Title, chapter.Content),
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
+
+		reviewReq := &StoryReviewRequest{
+			Message:        "已生成故事如下，如果内容符合要求，请回复ok。否则提供反馈。",
+			Chapters:       make([]StoryReviewChapter, 0, len(sessionState.Story.Chapters)),
+			AllowedActions: []string{ReviewActionApprove, ReviewActionRevise},
+		}
+		for i, chapter := range sessionState.Story.Chapters {
+			reviewReq.Chapters = append(reviewReq.Chapters, StoryReviewChapter{
+				ChapterIndex: i,
+				Title:        chapter.Title,
+				Body:         chapter.Content,
 			})
 		}
-		infoList = append(infoList, map[string]interface{}{
-			"text": "如果内容符合要求，请回复ok。否则提供反馈。",
-		})
-		event := adk.StatefulInterrupt(ctx, infoList, sessionState.State)
+		event := adk.StatefulInterrupt(ctx, reviewReq, sessionState.State)
 		gen.Send(event)
 	}()
 
@@ -91,6 +104,7 @@ func (r StoryReviewAgent) Resume(ctx context.Context, info *adk.ResumeInfo,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 		// if !info.IsResumeTarget { // not explicitly resumed, interrupt with the same review content again
 		// 	sessionState := GetSessionState(ctx)
 		// 	info := "Story content to review: \n"
@@ -120,26 +134,32 @@ func (r StoryReviewAgent) Resume(ctx context.Context, info *adk.ResumeInfo,
 			return
 		}
 
-		sessionState := GetSessionState(ctx)
-		if strings.ToLower(feedback) != "ok" {
-			sessionState.NeedToEditStory = true
-			sessionState.StoryFeedback = feedback
-		} else {
-			sessionState.NeedToEditStory = false
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
 		}
-		SaveSessionState(ctx, sessionState)
-
-		if !sessionState.NeedToEditStory {
+		reviewFeedback, err := ParseReviewFeedback(feedback, len(sessionState.Story.Chapters))
+		if err != nil {
 			event := &adk.AgentEvent{
-				Action: adk.NewBreakLoopAction(r.AgentName),
+				Err: fmt.Errorf("review agent receives invalid resume data: %w", err),
 			}
 			gen.Send(event)
 			return
 		}
+		sessionState.NeedToEditStory = reviewFeedback.NeedRevision()
+		if sessionState.NeedToEditStory {
+			sessionState.StoryRevisions = reviewFeedback.Revise
+			sessionState.StoryFeedback = buildStoryFeedback(sessionState.Story.Chapters, reviewFeedback)
+		}
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
-		if sessionState.StoryFeedback == "" {
+		if !sessionState.NeedToEditStory {
 			event := &adk.AgentEvent{
-				Err: errors.New("story feedback is nil"),
+				Action: adk.NewBreakLoopAction(r.AgentName),
 			}
 			gen.Send(event)
 			return
@@ -161,3 +181,40 @@ func (r StoryReviewAgent) Resume(ctx context.Context, info *adk.ResumeInfo,
 
 	return iter
 }
+
+// buildStoryFeedback 将按章节的修改意见组织为发给故事生成模型的反馈
+func buildStoryFeedback(chapters []model.StoryChapter, feedback *ReviewFeedback) string {
+	var sb strings.Builder
+	sb.WriteString("请根据以下反馈修改对应章节，其余章节必须保持原样不变，章节数量和顺序不变，并按原格式输出完整故事：\n")
+	for _, idx := range feedback.chapters() {
+		title := fmt.Sprintf("第%d章", idx+1)
+		if idx < len(chapters) {
+			title = chapters[idx].Title
+		}
+		sb.WriteString(fmt.Sprintf("%s: %s\n", title, feedback.Revise[idx]))
+	}
+	return sb.String()
+}
+
+// mergeRevisedChapters 按章节索引合并修改后的故事：只采用revisions中章节的新内容，已通过的章节保持上一版不变
+// 模型返回的章节数与上一版不同时按索引对应，缺少的修改章节保留上一版，多出的章节丢弃；全部章节都修改时直接使用新故事
+func mergeRevisedChapters(prev, revised []model.StoryChapter, revisions map[int]string) []model.StoryChapter {
+	if len(revisions) >= len(prev) {
+		return revised
+	}
+	if len(revised) != len(prev) {
+		log.Printf("revised story has %d chapters, previous version has %d, merging by chapter index\n", len(revised), len(prev))
+	}
+	merged := slices.Clone(prev)
+	for idx := range revisions {
+		if idx < 0 || idx >= len(merged) {
+			continue
+		}
+		if idx >= len(revised) {
+			log.Printf("revised story has no chapter %d, keeping the previous version\n", idx)
+			continue
+		}
+		merged[idx] = revised[idx]
+	}
+	return merged
+}
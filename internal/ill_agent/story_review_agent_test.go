@@ -0,0 +1,40 @@
+package ill_agent
+
+import (
+	"illustration2/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestMergeRevisedChapters(t *testing.T) {
+	chapters := func(names ...string) []model.StoryChapter {
+		out := make([]model.StoryChapter, len(names))
+		for i, name := range names {
+			out[i] = model.StoryChapter{Title: name, Content: name + "的内容"}
+		}
+		return out
+	}
+	prev := chapters("a", "b", "c")
+	tests := []struct {
+		name      string
+		revised   []model.StoryChapter
+		revisions map[int]string
+		want      []model.StoryChapter
+	}{
+		{"same count", chapters("a2", "b2", "c2"), map[int]string{1: "x"}, chapters("a", "b2", "c")},
+		// 章节数不同时按索引对应，已通过的章节不被改写
+		{"more chapters", chapters("a2", "b2", "c2", "d2"), map[int]string{1: "x"}, chapters("a", "b2", "c")},
+		{"fewer chapters", chapters("a2", "b2"), map[int]string{0: "x"}, chapters("a2", "b", "c")},
+		{"revised chapter missing", chapters("a2"), map[int]string{2: "x"}, chapters("a", "b", "c")},
+		{"all revised", chapters("a2", "b2", "c2", "d2"), map[int]string{0: "x", 1: "x", 2: "x"}, chapters("a2", "b2", "c2", "d2")},
+	}
+	for _, tt := range tests {
+		got := mergeRevisedChapters(prev, tt.revised, tt.revisions)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if !reflect.DeepEqual(prev, chapters("a", "b", "c")) {
+		t.Error("previous chapters modified")
+	}
+}
@@ -5,28 +5,39 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/store"
 	"illustration2/internal/volc"
 	"log"
 	"sort"
-	"time"
 
 	"github.com/cloudwego/eino/adk"
 	"github.com/cloudwego/eino/schema"
 )
 
 type VideoGenerateAgent struct {
-	AgentName string
-	AgentDesc string
-	ModelName string
-	ArkClient *volc.ArkClient
+	AgentName    string
+	AgentDesc    string
+	ModelName    string
+	ArkClient    *volc.ArkClient
+	Duration     int              // 视频时长（秒）
+	MaxRefImages int              // 模型支持的最多参考图数量
+	Wait         volc.WaitOptions // 等待视频任务结束的轮询参数
 }
 
-func NewVideoGenerateAgent(ctx context.Context) adk.Agent {
+func NewVideoGenerateAgent(ctx context.Context, cfg *config.Config) adk.Agent {
+	videoModel, ok := cfg.Registry().Get(cfg.Models.Video)
+	if !ok {
+		log.Fatalf("models.video: unknown model alias %q\n", cfg.Models.Video)
+	}
 	a := VideoGenerateAgent{
-		AgentName: "视频生成助手",
-		AgentDesc: "一个可以根据生成的图片创建视频的agent",
-		ModelName: "ep-20260107003549-kcrmk",
-		ArkClient: volc.NewArkClientWithTimeout(300 * time.Second), // 视频生成可能需要更长时间
+		AgentName:    "视频生成助手",
+		AgentDesc:    "一个可以根据生成的图片创建视频的agent",
+		ModelName:    cfg.Models.Endpoint(cfg.Models.Video),
+		ArkClient:    volc.NewArkClient(cfg.Ark, cfg.Video.Timeout), // 视频生成可能需要更长时间
+		Duration:     cfg.Video.StoryDuration,
+		MaxRefImages: videoModel.MaxReferenceImages,
+		Wait:         volc.NewWaitOptions(cfg.Video),
 	}
 	return a
 }
@@ -45,8 +56,13 @@ func (r VideoGenerateAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
-		sessionState := GetSessionState(ctx)
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
 		// 检查是否有生成的图片
 		if sessionState.GeneratedImages == nil || len(sessionState.GeneratedImages) == 0 {
@@ -81,73 +97,72 @@ func (r VideoGenerateAgent) Run(ctx context.Context, input *adk.AgentInput,
 			images := sessionState.GeneratedImages[idx]
 			referenceImages = append(referenceImages, images...)
 		}
+		// 超出模型支持数量的参考图按章节顺序截断
+		if r.MaxRefImages > 0 && len(referenceImages) > r.MaxRefImages {
+			log.Printf("reference images truncated from %d to %d\n", len(referenceImages), r.MaxRefImages)
+			referenceImages = referenceImages[:r.MaxRefImages]
+		}
+		// 转存后的图片地址模型可能无法访问，转换为模型可用的地址
+		for i, src := range referenceImages {
+			input, err := assetArchiver.InputURL(ctx, src)
+			if err != nil {
+				gen.Send(&adk.AgentEvent{Err: newAgentError("参考图片读取", err)})
+				return
+			}
+			referenceImages[i] = input
+		}
 
 		// 调用视频生成API
 		videoParams := volc.VideoTaskParams{
 			Model:              r.ModelName,
 			Prompt:             videoPrompt,
 			ReferenceImageURLs: referenceImages,
-			Duration:           12, // 视频时长12秒
+			Duration:           r.Duration,
 		}
 
 		// 创建视频任务
 		taskID, err := r.ArkClient.CreateVideoTask(ctx, videoParams)
 		if err != nil {
-			log.Fatal(fmt.Errorf("video task creation failed: %+v", err))
+			log.Printf("video task creation failed: %+v\n", err)
 			event := &adk.AgentEvent{
-				Err: errors.New("video task creation failed"),
+				Err: newAgentError("视频任务创建", err),
 			}
 			gen.Send(event)
 			return
 		}
 		log.Printf("Video task created with ID: %s\n", taskID)
+		progress := newVideoProgress(gen, "video_generate", 1)
+		progress.created(-1, taskID)
 
 		// 轮询视频任务状态
-		var status string
-		var videoURL string
-		maxAttempts := 60 // 最多轮询60次
-		attempts := 0
-
-		for attempts < maxAttempts {
-			status, videoURL, err = r.ArkClient.GetVideoTask(ctx, taskID)
-			if err != nil {
-				log.Fatal(fmt.Errorf("failed to get video task status: %+v", err))
-				event := &adk.AgentEvent{
-					Err: errors.New("failed to get video task status"),
-				}
-				gen.Send(event)
-				return
-			}
-
-			if status == "succeeded" && videoURL != "" {
-				break
-			}
-
-			if status == "failed" {
-				event := &adk.AgentEvent{
-					Err: errors.New("video generation failed"),
+		wait := r.Wait
+		wait.OnUpdate = progress.onUpdate(-1)
+		result, err := r.ArkClient.WaitForVideoTask(ctx, taskID, wait)
+		progress.finished(-1, err)
+		if err != nil {
+			log.Printf("video task %s failed: %+v\n", taskID, err)
+			if shouldAbortVideoTask(ctx, err) {
+				sessionState.AbortedVideoTasks = append(sessionState.AbortedVideoTasks, abortVideoTask(ctx, r.ArkClient, -1, taskID))
+				if err := SaveSessionState(ctx, sessionState); err != nil {
+					log.Printf("failed to save aborted video task: %v\n", err)
 				}
-				gen.Send(event)
-				return
 			}
-
-			// 等待5秒后再次轮询
-			time.Sleep(5 * time.Second)
-			attempts++
+			gen.Send(&adk.AgentEvent{Err: newAgentError("视频生成", err)})
+			return
 		}
-
-		if attempts >= maxAttempts {
-			event := &adk.AgentEvent{
-				Err: errors.New("video generation timeout"),
-			}
-			gen.Send(event)
+		videoURL, err := assetArchiver.Archive(ctx, store.AssetKindVideo, result.VideoURL)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: newAgentError("视频保存", err)})
 			return
 		}
 
 		// 保存视频URL到会话状态
 		sessionState.VideoURL = videoURL
 		sessionState.State = "video_generate"
-		SaveSessionState(ctx, sessionState)
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
 		log.Printf("Generated video URL: %s\n", videoURL)
 
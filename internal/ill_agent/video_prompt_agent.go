@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"illustration2/internal/config"
 	"illustration2/internal/volc"
 	"log"
 	"strings"
@@ -19,7 +20,7 @@ type VideoPromptAgent struct {
 	ArkClient *volc.ArkClient
 }
 
-func NewVideoPromptAgent(ctx context.Context) adk.Agent {
+func NewVideoPromptAgent(ctx context.Context, cfg *config.Config) adk.Agent {
 	a := VideoPromptAgent{
 		AgentName: "视频提示词助手",
 		AgentDesc: `You are a professional video prompt engineer. Convert the user-provided story (theme + chapters) and any visual feedback into ONE high-quality English video generation prompt.
@@ -36,8 +37,8 @@ Theme: %s
 Chapters:
 %s
 `,
-		ModelName: "ep-20250220181854-c8s82",
-		ArkClient: volc.NewArkClientDefault(),
+		ModelName: cfg.Models.Endpoint(cfg.Models.Chat),
+		ArkClient: volc.NewArkClient(cfg.Ark, cfg.Ark.Timeout),
 	}
 	return a
 }
@@ -56,8 +57,13 @@ func (r VideoPromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 	go func() {
 		defer gen.Close()
+		defer recoverAsErrorEvent(gen)
 
-		sessionState := GetSessionState(ctx)
+		sessionState, err := GetSessionState(ctx)
+		if err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 		if sessionState.Story == nil {
 			event := &adk.AgentEvent{
 				Err: errors.New("story is empty, cannot generate video prompt"),
@@ -80,7 +86,7 @@ func (r VideoPromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 		content, err := r.ArkClient.ChatJSON(ctx, r.ModelName, prompt)
 		if err != nil {
 			event := &adk.AgentEvent{
-				Err: errors.New("video prompt generation failed"),
+				Err: newAgentError("视频提示词生成", err),
 			}
 			gen.Send(event)
 			return
@@ -88,7 +94,10 @@ func (r VideoPromptAgent) Run(ctx context.Context, input *adk.AgentInput,
 
 		sessionState.VideoPrompt = content
 		sessionState.State = "video_prompt"
-		SaveSessionState(ctx, sessionState)
+		if err := SaveSessionState(ctx, sessionState); err != nil {
+			gen.Send(&adk.AgentEvent{Err: err})
+			return
+		}
 
 		log.Printf("videoPrompt: %s\n", content)
 
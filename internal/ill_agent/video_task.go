@@ -0,0 +1,40 @@
+package ill_agent
+
+import (
+	"context"
+	"errors"
+	"illustration2/internal/volc"
+	"log"
+	"time"
+)
+
+const abortVideoTaskTimeout = 10 * time.Second // 取消Ark视频任务的超时时间
+
+// AbortedVideoTask 被中止的视频任务（会话取消或等待超时）
+type AbortedVideoTask struct {
+	TaskID          string    `json:"task_id"`
+	ChapterIndex    int       `json:"chapter_index"`    // 章节索引，整体视频为-1
+	RemoteCancelled bool      `json:"remote_cancelled"` // Ark端任务是否已取消，运行中的任务无法取消
+	AbortedAt       time.Time `json:"aborted_at"`
+}
+
+// shouldAbortVideoTask 等待视频任务失败后，判断Ark端任务是否可能仍在运行需要取消
+func shouldAbortVideoTask(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, volc.ErrVideoTaskTimeout)
+}
+
+// abortVideoTask 取消Ark端的视频任务，避免任务在无人等待时继续运行计费
+// ctx通常已被取消，因此使用独立的超时context发起取消请求
+func abortVideoTask(ctx context.Context, client *volc.ArkClient, chapterIdx int, taskID string) AbortedVideoTask {
+	cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortVideoTaskTimeout)
+	defer cancel()
+
+	aborted := AbortedVideoTask{TaskID: taskID, ChapterIndex: chapterIdx, AbortedAt: time.Now()}
+	if err := client.CancelVideoTask(cctx, taskID); err != nil {
+		log.Printf("failed to cancel video task %s: %v\n", taskID, err)
+	} else {
+		aborted.RemoteCancelled = true
+		log.Printf("video task %s cancelled\n", taskID)
+	}
+	return aborted
+}
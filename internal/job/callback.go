@@ -0,0 +1,157 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// 回调请求头，签名为HMAC-SHA256(secret, timestamp + "." + body)的十六进制编码
+const (
+	HeaderSignature = "X-Signature"
+	HeaderTimestamp = "X-Signature-Timestamp"
+)
+
+// Sign 计算回调签名，接收方可用同样的方式校验
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ErrCallbackAddress 回调地址指向本机、内网或链路本地地址（如云主机元数据服务）
+var ErrCallbackAddress = errors.New("callback address not allowed")
+
+// sharedAddressSpace 运营商级NAT地址段，部分云厂商的元数据服务位于其中
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// callbackAddrAllowed 回调只允许投递到公网地址
+func callbackAddrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// ValidateCallbackURL 校验回调地址：必须是http(s)绝对地址，且解析出的所有IP都是公网地址
+// 投递时callbackClient会再次校验实际连接的IP，防止DNS重绑定
+func ValidateCallbackURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("must be an absolute http(s) url")
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !callbackAddrAllowed(addr) {
+			return fmt.Errorf("%w: %s", ErrCallbackAddress, host)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !callbackAddrAllowed(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrCallbackAddress, host, addr)
+		}
+	}
+	return nil
+}
+
+// newCallbackClient 创建投递回调的HTTP客户端，只连接公网地址且不走代理
+func newCallbackClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		// 在解析完成、建立连接前校验IP，重定向和DNS重绑定同样会被拦截
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !callbackAddrAllowed(addr) {
+				return fmt.Errorf("%w: %s", ErrCallbackAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// deliver 将结束的任务POST到客户端的callbackUrl，失败时按退避重试
+func (m *Manager) deliver(id string) {
+	job, ok := m.Get(id)
+	if !ok || job.CallbackURL == "" || job.CallbackStatus != CallbackPending {
+		return
+	}
+	body, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("job %s: failed to marshal callback: %v\n", id, err)
+		return
+	}
+
+	delay := time.Second
+	for attempt := 1; attempt <= m.cfg.CallbackAttempts; attempt++ {
+		err = m.post(job.CallbackURL, body)
+		if err == nil {
+			m.update(id, func(j *Job) { j.CallbackStatus = CallbackDelivered })
+			return
+		}
+		log.Printf("job %s: callback attempt %d failed: %v\n", id, attempt, err)
+		if m.ctx.Err() != nil {
+			return
+		}
+		if attempt == m.cfg.CallbackAttempts {
+			break
+		}
+		select {
+		case <-m.ctx.Done():
+			// 保持pending，服务重启后补发
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	m.update(id, func(j *Job) { j.CallbackStatus = CallbackFailed })
+}
+
+func (m *Manager) post(url string, body []byte) error {
+	req, err := http.NewRequestWithContext(m.ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.cfg.CallbackSecret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+		req.Header.Set(HeaderSignature, Sign(m.cfg.CallbackSecret, ts, body))
+	}
+	res, err := m.callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateCallbackURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://203.0.113.10/cb", false},
+		{"http://[2001:4860:4860::8888]:8080/cb", false},
+		{"ftp://203.0.113.10/cb", true},
+		{"/cb", true},
+		{"http://127.0.0.1/cb", true},
+		{"http://[::1]/cb", true},
+		{"http://[::ffff:127.0.0.1]/cb", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://10.0.0.8/cb", true},
+		{"http://172.16.3.4/cb", true},
+		{"http://192.168.1.1/cb", true},
+		{"http://100.96.0.96/cb", true},
+		{"http://0.0.0.0/cb", true},
+		{"http://localhost/cb", true},
+	}
+	for _, tt := range tests {
+		err := ValidateCallbackURL(context.Background(), tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateCallbackURL(%q) = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCallbackClientRejectsPrivateAddress(t *testing.T) {
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	// 通过校验后域名被重新解析到本机时，连接前会再次拦截
+	_, err := newCallbackClient(time.Second).Post(srv.URL, "application/json", nil)
+	if !errors.Is(err, ErrCallbackAddress) {
+		t.Fatalf("got %v, want ErrCallbackAddress", err)
+	}
+	if called {
+		t.Error("callback reached a loopback server")
+	}
+}
@@ -0,0 +1,46 @@
+package job
+
+import (
+	"time"
+)
+
+// Status 任务状态，与volc.VideoTaskStatus取值一致
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Terminal 任务是否已结束，结束后结果不再变化
+func (s Status) Terminal() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+// 回调投递状态
+const (
+	CallbackPending   = "pending"
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed"
+)
+
+// Job 本地记录的视频生成任务
+type Job struct {
+	ID             string    `json:"id"`
+	TaskID         string    `json:"task_id"` // Ark视频任务ID
+	Model          string    `json:"model"`   // 模型别名
+	Status         Status    `json:"status"`
+	VideoURL       string    `json:"video_url,omitempty"`
+	LastFrameURL   string    `json:"last_frame_url,omitempty"`
+	Duration       int       `json:"duration,omitempty"` // 视频时长（秒）
+	Error          string    `json:"error,omitempty"`
+	CallbackURL    string    `json:"callback_url,omitempty"`
+	CallbackStatus string    `json:"callback_status,omitempty"`
+	PollCount      int       `json:"poll_count"` // 已轮询次数
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	FinishedAt     time.Time `json:"finished_at,omitzero"`
+}
@@ -0,0 +1,359 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/volc"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Manager 记录创建的视频任务，在后台轮询Ark直到任务结束，缓存结果并回调客户端
+// 任务记录以<dir>/<jobID>.json持久化，服务重启后继续轮询未结束的任务、补发未完成的回调
+// 结束超过jobs.retention的任务记录由RunPruning定期删除
+type Manager struct {
+	ctx            context.Context
+	cfg            config.JobsConfig
+	ark            *volc.ArkClient
+	callbackClient *http.Client
+
+	mu      sync.RWMutex
+	jobs    map[string]*Job
+	byTask  map[string]string             // Ark视频任务ID到任务ID的索引
+	cancels map[string]context.CancelFunc // 正在轮询的任务，用于取消任务时停止轮询
+}
+
+const cancelTaskTimeout = 10 * time.Second // 取消超时的Ark视频任务的超时时间
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// NewManager 创建任务管理器并恢复持久化的任务，ctx取消后停止所有后台轮询和回调
+func NewManager(ctx context.Context, cfg config.JobsConfig, ark *volc.ArkClient) (*Manager, error) {
+	if err := os.MkdirAll(cfg.StoreDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job store dir: %w", err)
+	}
+	m := &Manager{
+		ctx:            ctx,
+		cfg:            cfg,
+		ark:            ark,
+		callbackClient: newCallbackClient(cfg.CallbackTimeout),
+		jobs:           make(map[string]*Job),
+		byTask:         make(map[string]string),
+		cancels:        make(map[string]context.CancelFunc),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	m.prune(cfg.Retention)
+	for id, job := range m.jobs {
+		switch {
+		case !job.Status.Terminal():
+			m.startTracking(id)
+		case job.CallbackStatus == CallbackPending:
+			go m.deliver(id)
+		}
+	}
+	return m, nil
+}
+
+// Create 记录新创建的Ark视频任务并开始后台轮询
+func (m *Manager) Create(taskID, model, callbackURL string) *Job {
+	now := time.Now()
+	job := &Job{
+		ID:          uuid.NewString(),
+		TaskID:      taskID,
+		Model:       model,
+		Status:      StatusQueued,
+		CallbackURL: callbackURL,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if callbackURL != "" {
+		job.CallbackStatus = CallbackPending
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.byTask[taskID] = job.ID
+	m.save(job)
+	snapshot := *job
+	m.mu.Unlock()
+
+	m.startTracking(job.ID)
+	return &snapshot
+}
+
+// Cancel 取消未结束的任务：先取消Ark端任务，成功后停止轮询并标记为cancelled
+// Ark只允许取消排队中的任务，运行中的任务返回Ark的错误，任务记录保持不变
+func (m *Manager) Cancel(ctx context.Context, id string) (*Job, error) {
+	job, ok := m.Get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if job.Status.Terminal() {
+		return nil, ErrJobFinished
+	}
+	if err := m.ark.CancelVideoTask(ctx, job.TaskID); err != nil {
+		return nil, fmt.Errorf("cancel video task %s failed: %w", job.TaskID, err)
+	}
+	m.update(id, func(j *Job) {
+		if !j.Status.Terminal() {
+			j.Status = StatusCancelled
+			j.Error = "cancelled by client"
+		}
+	})
+
+	m.mu.Lock()
+	stop := m.cancels[id]
+	m.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	job, _ = m.Get(id)
+	return job, nil
+}
+
+// Get 按任务ID获取任务
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+// GetByTaskID 按Ark视频任务ID获取任务
+func (m *Manager) GetByTaskID(taskID string) (*Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, ok := m.jobs[m.byTask[taskID]]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+// List 按创建时间倒序返回任务，status为空时返回全部
+func (m *Manager) List(status Status) []*Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if status != "" && job.Status != status {
+			continue
+		}
+		snapshot := *job
+		list = append(list, &snapshot)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// RunPruning 定期删除结束超过retention的任务记录，直到ctx结束
+func (m *Manager) RunPruning(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.prune(retention)
+		}
+	}
+}
+
+// prune 删除结束超过retention的任务，包括内存中的记录和<dir>/<jobID>.json
+// 未结束的任务和回调仍待投递的任务保留
+func (m *Manager) prune(retention time.Duration) {
+	deadline := time.Now().Add(-retention)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, job := range m.jobs {
+		finishedAt := job.FinishedAt
+		if finishedAt.IsZero() {
+			finishedAt = job.UpdatedAt
+		}
+		if !job.Status.Terminal() || job.CallbackStatus == CallbackPending || finishedAt.After(deadline) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.cfg.StoreDir, id+".json")); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to remove job %s: %v\n", id, err)
+			continue
+		}
+		delete(m.jobs, id)
+		if m.byTask[job.TaskID] == id {
+			delete(m.byTask, job.TaskID)
+		}
+		log.Printf("pruned job %s, finished at %s\n", id, finishedAt.Format(time.RFC3339))
+	}
+}
+
+// startTracking 在后台轮询任务
+func (m *Manager) startTracking(id string) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.mu.Lock()
+	m.cancels[id] = cancel
+	m.mu.Unlock()
+
+	go func() {
+		defer func() {
+			cancel()
+			m.mu.Lock()
+			delete(m.cancels, id)
+			m.mu.Unlock()
+		}()
+		m.track(ctx, id)
+	}()
+}
+
+// track 按退避间隔轮询任务状态直到结束，结束后投递回调
+func (m *Manager) track(ctx context.Context, id string) {
+	job, ok := m.Get(id)
+	if !ok {
+		return
+	}
+	remaining := m.cfg.Timeout - time.Since(job.CreatedAt)
+	err := fmt.Errorf("%w: task %s not finished after %s", volc.ErrVideoTaskTimeout, job.TaskID, m.cfg.Timeout)
+	if remaining > 0 {
+		_, err = m.ark.WaitForVideoTask(ctx, job.TaskID, volc.WaitOptions{
+			PollInterval:    m.cfg.PollInterval,
+			MaxPollInterval: m.cfg.MaxPollInterval,
+			Timeout:         remaining,
+			OnUpdate: func(result *volc.VideoTaskResult) {
+				m.update(id, func(j *Job) {
+					// 任务已被取消等结束状态时不再被轮询结果覆盖
+					if j.Status.Terminal() {
+						return
+					}
+					j.PollCount++
+					j.Status = Status(result.Status)
+					j.VideoURL = result.VideoURL
+					j.LastFrameURL = result.LastFrameURL
+					j.Duration = result.Duration
+					j.Error = result.ErrorMessage
+				})
+			},
+		})
+	}
+	if m.ctx.Err() != nil {
+		// 服务关闭，重启后继续轮询
+		return
+	}
+	if err != nil {
+		log.Printf("job %s: video task %s failed: %v\n", id, job.TaskID, err)
+		if errors.Is(err, volc.ErrVideoTaskTimeout) {
+			m.cancelTask(ctx, id, job.TaskID)
+		}
+		// 服务关闭已在上面返回，ctx被取消只可能来自Cancel
+		cancelled := errors.Is(err, context.Canceled)
+		m.update(id, func(j *Job) {
+			switch {
+			case j.Status.Terminal():
+			case cancelled:
+				j.Status = StatusCancelled
+			default:
+				j.Status = StatusFailed
+			}
+			if j.Error == "" {
+				j.Error = err.Error()
+			}
+		})
+	}
+	m.deliver(id)
+}
+
+// cancelTask 取消超时未结束的Ark任务，避免任务在无人等待时继续运行计费
+// 轮询的ctx可能已被取消，因此使用独立的超时context发起取消请求
+func (m *Manager) cancelTask(ctx context.Context, id, taskID string) {
+	cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelTaskTimeout)
+	defer cancel()
+	if err := m.ark.CancelVideoTask(cctx, taskID); err != nil {
+		log.Printf("job %s: failed to cancel video task %s: %v\n", id, taskID, err)
+		return
+	}
+	log.Printf("job %s: video task %s cancelled after timeout\n", id, taskID)
+}
+
+// update 修改任务并持久化，任务进入结束状态时记录结束时间
+func (m *Manager) update(id string, fn func(j *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	fn(job)
+	job.UpdatedAt = time.Now()
+	if job.Status.Terminal() && job.FinishedAt.IsZero() {
+		job.FinishedAt = job.UpdatedAt
+	}
+	m.save(job)
+}
+
+// save 持久化任务记录，需持有m.mu
+func (m *Manager) save(job *Job) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("failed to marshal job %s: %v\n", job.ID, err)
+		return
+	}
+	path := filepath.Join(m.cfg.StoreDir, job.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("failed to save job %s: %v\n", job.ID, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("failed to save job %s: %v\n", job.ID, err)
+	}
+}
+
+// load 加载持久化的任务记录
+func (m *Manager) load() error {
+	entries, err := os.ReadDir(m.cfg.StoreDir)
+	if err != nil {
+		return fmt.Errorf("failed to read job store dir: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(m.cfg.StoreDir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read job %s: %w", entry.Name(), err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			log.Printf("skip corrupted job file %s: %v\n", entry.Name(), err)
+			continue
+		}
+		m.jobs[job.ID] = &job
+		m.byTask[job.TaskID] = job.ID
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package job
+
+import (
+	"context"
+	"illustration2/internal/config"
+	"illustration2/internal/volc"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeArk 模拟Ark视频任务接口，GET返回status，DELETE记录取消
+type fakeArk struct {
+	mu        sync.Mutex
+	status    string
+	polls     chan struct{}
+	cancelled bool
+}
+
+func newFakeArk(t *testing.T, status string) (*fakeArk, *volc.ArkClient) {
+	t.Helper()
+	f := &fakeArk{status: status, polls: make(chan struct{}, 100)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if r.Method == http.MethodDelete {
+			f.cancelled = true
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"id":"task-1","status":"` + f.status + `"}`))
+		select {
+		case f.polls <- struct{}{}:
+		default:
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return f, &volc.ArkClient{
+		BaseURL:    srv.URL,
+		APIKey:     "test",
+		HTTPClient: srv.Client(),
+		Retry:      volc.RetryPolicy{MaxAttempts: 1},
+	}
+}
+
+func newTestManager(t *testing.T, ark *volc.ArkClient) *Manager {
+	t.Helper()
+	return newTestManagerWithTimeout(t, ark, time.Minute)
+}
+
+func newTestManagerWithTimeout(t *testing.T, ark *volc.ArkClient, timeout time.Duration) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	m, err := NewManager(ctx, config.JobsConfig{
+		StoreDir:         dir,
+		PollInterval:     10 * time.Millisecond,
+		Timeout:          timeout,
+		CallbackTimeout:  time.Second,
+		CallbackAttempts: 1,
+		Retention:        time.Hour,
+	}, ark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 先于删除临时目录停止所有轮询
+	t.Cleanup(func() {
+		cancel()
+		m.mu.RLock()
+		ids := make([]string, 0, len(m.cancels))
+		for id := range m.cancels {
+			ids = append(ids, id)
+		}
+		m.mu.RUnlock()
+		for _, id := range ids {
+			m.waitStopped(t, id)
+		}
+	})
+	return m
+}
+
+// waitPolls 等待轮询n次
+func (f *fakeArk) waitPolls(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-f.polls:
+		case <-time.After(2 * time.Second):
+			t.Fatal("video task not polled")
+		}
+	}
+}
+
+// waitStopped 等待任务停止轮询
+func (m *Manager) waitStopped(t *testing.T, id string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.RLock()
+		_, tracking := m.cancels[id]
+		m.mu.RUnlock()
+		if !tracking {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("job still tracked")
+}
+
+func TestCancelMarksJobCancelled(t *testing.T) {
+	ark, client := newFakeArk(t, "queued")
+	m := newTestManager(t, client)
+	job := m.Create("task-1", "seedance1.0", "")
+	ark.waitPolls(t, 1)
+
+	got, err := m.Cancel(context.Background(), job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusCancelled {
+		t.Fatalf("Cancel returned status %s, want cancelled", got.Status)
+	}
+	m.waitStopped(t, job.ID)
+	got, _ = m.Get(job.ID)
+	if got.Status != StatusCancelled {
+		t.Errorf("status after tracking stopped = %s, want cancelled", got.Status)
+	}
+	ark.mu.Lock()
+	defer ark.mu.Unlock()
+	if !ark.cancelled {
+		t.Error("Ark task not cancelled")
+	}
+}
+
+func TestPollDoesNotOverwriteTerminalStatus(t *testing.T) {
+	ark, client := newFakeArk(t, "running")
+	m := newTestManager(t, client)
+	job := m.Create("task-1", "seedance1.0", "")
+	ark.waitPolls(t, 1)
+
+	// Cancel已标记cancelled、尚未停止轮询时，进行中的轮询结果不能覆盖结束状态
+	m.update(job.ID, func(j *Job) { j.Status = StatusCancelled })
+	ark.waitPolls(t, 2)
+	got, _ := m.Get(job.ID)
+	if got.Status != StatusCancelled {
+		t.Errorf("status = %s, want cancelled", got.Status)
+	}
+}
+
+func TestStoppedTrackingEndsCancelled(t *testing.T) {
+	ark, client := newFakeArk(t, "running")
+	m := newTestManager(t, client)
+	job := m.Create("task-1", "seedance1.0", "")
+	ark.waitPolls(t, 1)
+
+	// 轮询因Cancel停止时任务记录为cancelled而不是failed
+	m.mu.RLock()
+	stop := m.cancels[job.ID]
+	m.mu.RUnlock()
+	stop()
+	m.waitStopped(t, job.ID)
+	got, _ := m.Get(job.ID)
+	if got.Status != StatusCancelled {
+		t.Errorf("status = %s, want cancelled", got.Status)
+	}
+}
+
+func TestTimedOutJobCancelsArkTask(t *testing.T) {
+	ark, client := newFakeArk(t, "running")
+	m := newTestManagerWithTimeout(t, client, 50*time.Millisecond)
+	job := m.Create("task-1", "seedance1.0", "")
+	m.waitStopped(t, job.ID)
+
+	got, _ := m.Get(job.ID)
+	if got.Status != StatusFailed {
+		t.Errorf("status = %s, want failed", got.Status)
+	}
+	ark.mu.Lock()
+	defer ark.mu.Unlock()
+	if !ark.cancelled {
+		t.Error("Ark task of timed out job not cancelled")
+	}
+}
+
+func TestGetByTaskID(t *testing.T) {
+	_, client := newFakeArk(t, "running")
+	m := newTestManager(t, client)
+	job := m.Create("task-1", "seedance1.0", "")
+
+	got, ok := m.GetByTaskID("task-1")
+	if !ok || got.ID != job.ID {
+		t.Errorf("GetByTaskID(task-1) = %+v, %v", got, ok)
+	}
+	if got, ok := m.GetByTaskID("task-2"); ok {
+		t.Errorf("GetByTaskID(task-2) = %+v", got)
+	}
+	if got, ok := m.GetByTaskID(""); ok {
+		t.Errorf("GetByTaskID(\"\") = %+v", got)
+	}
+}
+
+// putJob 直接写入任务记录，不开始轮询
+func (m *Manager) putJob(job *Job) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = job
+	m.byTask[job.TaskID] = job.ID
+	m.save(job)
+}
+
+func TestPrune(t *testing.T) {
+	_, client := newFakeArk(t, "running")
+	m := newTestManager(t, client)
+	old := time.Now().Add(-2 * time.Hour)
+	jobs := map[string]*Job{
+		"expired":          {Status: StatusSucceeded, FinishedAt: old},
+		"expired failed":   {Status: StatusFailed, FinishedAt: old, CallbackStatus: CallbackFailed},
+		"no finished time": {Status: StatusCancelled},
+		"recent":           {Status: StatusSucceeded, FinishedAt: time.Now()},
+		"running":          {Status: StatusRunning},
+		"callback pending": {Status: StatusSucceeded, FinishedAt: old, CallbackStatus: CallbackPending},
+	}
+	for name, job := range jobs {
+		job.ID = name
+		job.TaskID = "task-" + name
+		job.CreatedAt = old
+		job.UpdatedAt = old
+		m.putJob(job)
+	}
+	// 没有结束时间的旧记录按更新时间判断
+	m.prune(time.Hour)
+
+	for name, wantKept := range map[string]bool{
+		"expired": false, "expired failed": false, "no finished time": false,
+		"recent": true, "running": true, "callback pending": true,
+	} {
+		_, inMemory := m.Get(name)
+		_, indexed := m.GetByTaskID("task-" + name)
+		_, err := os.Stat(filepath.Join(m.cfg.StoreDir, name+".json"))
+		onDisk := err == nil
+		if inMemory != wantKept || indexed != wantKept || onDisk != wantKept {
+			t.Errorf("%s: in memory %v, indexed %v, on disk %v, want kept %v", name, inMemory, indexed, onDisk, wantKept)
+		}
+	}
+	if got := len(m.List("")); got != 3 {
+		t.Errorf("List returned %d jobs, want 3", got)
+	}
+}
+
+// TestPruneOnStartup 重启时不加载已过期的任务记录
+func TestPruneOnStartup(t *testing.T) {
+	_, client := newFakeArk(t, "succeeded")
+	m := newTestManager(t, client)
+	old := time.Now().Add(-2 * time.Hour)
+	m.putJob(&Job{ID: "expired", TaskID: "task-1", Status: StatusSucceeded, CreatedAt: old, UpdatedAt: old, FinishedAt: old})
+	m.putJob(&Job{ID: "recent", TaskID: "task-2", Status: StatusSucceeded, CreatedAt: old, UpdatedAt: old, FinishedAt: time.Now()})
+
+	restarted, err := NewManager(context.Background(), m.cfg, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restarted.Get("expired"); ok {
+		t.Error("expired job loaded after restart")
+	}
+	if _, err := os.Stat(filepath.Join(m.cfg.StoreDir, "expired.json")); !os.IsNotExist(err) {
+		t.Errorf("expired job file not removed: %v", err)
+	}
+	if got, ok := restarted.GetByTaskID("task-2"); !ok || got.ID != "recent" {
+		t.Errorf("GetByTaskID(task-2) after restart = %+v, %v", got, ok)
+	}
+}
@@ -2,42 +2,120 @@ package service
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/job"
 	"illustration2/internal/volc"
-	"strings"
 )
 
 type GenerationService struct {
 	arkClient *volc.ArkClient
+	cfg       *config.Config
+	jobs      *job.Manager
 }
 
-func NewGenerationService(arkClient *volc.ArkClient) *GenerationService {
+func NewGenerationService(arkClient *volc.ArkClient, cfg *config.Config, jobs *job.Manager) *GenerationService {
 	return &GenerationService{
 		arkClient: arkClient,
+		cfg:       cfg,
+		jobs:      jobs,
 	}
 }
 
+// Models 返回所有可用模型及其能力
+func (s *GenerationService) Models() []*config.ModelSpec {
+	return s.cfg.Registry().List()
+}
+
+// resolveModel 按别名或推理接入点ID查找模型，并校验模型类型；未指定时使用配置中models.image或models.video的模型
+func (s *GenerationService) resolveModel(name string, kind config.ModelKind, v *ValidationError) *config.ModelSpec {
+	if name == "" {
+		switch kind {
+		case config.ModelKindImage:
+			name = s.cfg.Models.Image
+		case config.ModelKindVideo:
+			name = s.cfg.Models.Video
+		}
+		if name == "" {
+			v.add("modelName", "is required")
+			return nil
+		}
+	}
+	spec, ok := s.cfg.Registry().Resolve(name)
+	if !ok {
+		v.add("modelName", "unknown model %q", name)
+		return nil
+	}
+	if spec.Kind != kind {
+		v.add("modelName", "%s is a %s model, cannot generate %s", spec.Alias, spec.Kind, kind)
+		return nil
+	}
+	return spec
+}
+
 type GenerationRequest struct {
-	GenerateResourceType string   `json:"generateResourceType"` // image, video
-	ModelName            string   `json:"modelName"`            // seedream, seedance1.0, seedance2.0
-	Size                 string   `json:"size"`                 // e.g. 1024x1024
-	GenerateRelyType     string   `json:"generateRelyType"`     // 首帧, 首尾帧, 参考图
-	ImageList            []string `json:"imageList"`            // URLs or Base64
-	Prompt               string   `json:"prompt"`               // Prompt for generation
+	GenerateResourceType string   `json:"generateResourceType"`    // image, video
+	ModelName            string   `json:"modelName"`               // seedream, seedance1.0, seedance2.0, defaults to models.image/models.video
+	Size                 string   `json:"size"`                    // image only, e.g. 2K, 1024x1024
+	GenerateRelyType     string   `json:"generateRelyType"`        // 首帧, 首尾帧, 参考图
+	ImageList            []string `json:"imageList"`               // URLs or Base64
+	Prompt               string   `json:"prompt"`                  // Prompt for generation
+	Duration             int      `json:"duration,omitempty"`      // video only, seconds
+	Ratio                string   `json:"ratio,omitempty"`         // video only, e.g. 16:9, adaptive
+	Resolution           string   `json:"resolution,omitempty"`    // video only, e.g. 720p
+	GenerateAudio        *bool    `json:"generateAudio,omitempty"` // video only
+	MaxImages            int      `json:"maxImages,omitempty"`     // image only, number of images to generate
+	Seed                 *int64   `json:"seed,omitempty"`          // -1 or [0, 2^32-1]
+	Watermark            *bool    `json:"watermark,omitempty"`
+	CallbackURL          string   `json:"callbackUrl,omitempty"` // video only, POSTed with the job once it finishes
+
+	// video only, ordered images with explicit roles, replaces imageList and generateRelyType
+	Images []VideoImageInput `json:"images,omitempty"`
+}
+
+// VideoImageInput 视频生成的输入图片，按顺序写入Ark请求的content
+type VideoImageInput struct {
+	Src  string `json:"src"`  // URL or Base64
+	Role string `json:"role"` // first_frame, last_frame, reference_image
+}
+
+// videoImages 将请求中的图片转换为带角色的有序列表，imageList按generateRelyType依次分配角色
+func videoImages(req GenerationRequest) []volc.VideoImage {
+	images := make([]volc.VideoImage, 0, max(len(req.Images), len(req.ImageList)))
+	if len(req.Images) > 0 {
+		for _, img := range req.Images {
+			images = append(images, volc.VideoImage{Src: img.Src, Role: img.Role})
+		}
+		return images
+	}
+	for i, src := range req.ImageList {
+		role := volc.VideoImageRoleReference
+		switch {
+		case req.GenerateRelyType == config.RelyTypeFirstFrame && i == 0,
+			req.GenerateRelyType == config.RelyTypeFirstLastFrame && i == 0:
+			role = volc.VideoImageRoleFirstFrame
+		case req.GenerateRelyType == config.RelyTypeFirstLastFrame && i == 1:
+			role = volc.VideoImageRoleLastFrame
+		}
+		images = append(images, volc.VideoImage{Src: src, Role: role})
+	}
+	return images
 }
 
 type GenerationResponse struct {
 	Type    string   `json:"type"`              // image, video
 	Images  []string `json:"images,omitempty"`  // For image generation
 	TaskID  string   `json:"task_id,omitempty"` // For video generation
+	JobID   string   `json:"job_id,omitempty"`  // For video generation, see /api/jobs/:id
 	Message string   `json:"message,omitempty"`
 }
 
 type VideoResultResponse struct {
 	TaskID string `json:"task_id"`
-	Status string `json:"status"` // succeeded, processing, failed
+	JobID  string `json:"job_id,omitempty"`
+	Status string `json:"status"` // queued, running, succeeded, failed, cancelled
 	URL    string `json:"video_url,omitempty"`
+	Error  string `json:"error,omitempty"`
 }
 
 func (s *GenerationService) Generate(ctx context.Context, req GenerationRequest) (*GenerationResponse, error) {
@@ -47,22 +125,33 @@ func (s *GenerationService) Generate(ctx context.Context, req GenerationRequest)
 	case "video":
 		return s.generateVideo(ctx, req)
 	default:
-		return nil, errors.New("unsupported generateResourceType: " + req.GenerateResourceType)
+		v := &ValidationError{}
+		v.add("generateResourceType", "unsupported type %q, use image or video", req.GenerateResourceType)
+		return nil, v
 	}
 }
 
 func (s *GenerationService) generateImage(ctx context.Context, req GenerationRequest) (*GenerationResponse, error) {
-	model := req.ModelName
-	if model == "seedream" {
-		model = "ep-20251124201143-rwjnq" // Default mapping
+	spec, err := s.validateImageRequest(req)
+	if err != nil {
+		return nil, err
 	}
 
 	params := volc.ImageGenParams{
-		Model:                     model,
+		Model:                     spec.Endpoint,
 		Prompt:                    req.Prompt,
-		Size:                      "2K",
-		SequentialImageGeneration: "auto", // Default to auto if not specified
+		Size:                      req.Size,
+		SequentialImageGeneration: "disabled",
 		ImageInputs:               req.ImageList,
+		MaxImages:                 req.MaxImages,
+		Seed:                      req.Seed,
+		Watermark:                 req.Watermark,
+	}
+	if params.Size == "" {
+		params.Size = defaultImageSize
+	}
+	if params.MaxImages > 1 {
+		params.SequentialImageGeneration = "auto"
 	}
 
 	images, err := s.arkClient.GenerateImages(ctx, params)
@@ -76,94 +165,76 @@ func (s *GenerationService) generateImage(ctx context.Context, req GenerationReq
 	}, nil
 }
 
+// GetVideoResult 查询视频任务结果，本服务创建的任务直接返回后台轮询缓存的结果，其他任务查询Ark
 func (s *GenerationService) GetVideoResult(ctx context.Context, taskID string) (*VideoResultResponse, error) {
-	status, url, err := s.arkClient.GetVideoTask(ctx, taskID)
+	if j, ok := s.jobs.GetByTaskID(taskID); ok {
+		return &VideoResultResponse{
+			TaskID: taskID,
+			JobID:  j.ID,
+			Status: string(j.Status),
+			URL:    j.VideoURL,
+			Error:  j.Error,
+		}, nil
+	}
+	result, err := s.arkClient.GetVideoTask(ctx, taskID)
 	if err != nil {
 		return nil, fmt.Errorf("get video task failed: %w", err)
 	}
 	return &VideoResultResponse{
 		TaskID: taskID,
-		Status: status,
-		URL:    url,
+		Status: string(result.Status),
+		URL:    result.VideoURL,
+		Error:  result.ErrorMessage,
 	}, nil
 }
 
 func (s *GenerationService) generateVideo(ctx context.Context, req GenerationRequest) (*GenerationResponse, error) {
-	model := req.ModelName
-	if model == "seedance1.0" {
-		model = "ep-20260107003549-kcrmk"
-	} else if model == "seedance2.0" {
-		model = "ep-20260305130909-qnwqm" // Assuming this mapping, adjust if needed
+	spec, err := s.validateVideoRequest(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	params := volc.VideoTaskParams{
-		Model:  model,
-		Prompt: req.Prompt,
-	}
-
-	// Separate URLs and Base64s from ImageList
-	var urls []string
-	var base64s []string
-	for _, img := range req.ImageList {
-		if strings.HasPrefix(img, "http") {
-			urls = append(urls, img)
-		} else {
-			base64s = append(base64s, img)
-		}
+		Model:         spec.Endpoint,
+		Prompt:        req.Prompt,
+		Duration:      req.Duration,
+		Ratio:         req.Ratio,
+		Resolution:    req.Resolution,
+		GenerateAudio: req.GenerateAudio,
+		Seed:          req.Seed,
+		Watermark:     req.Watermark,
 	}
-
-	// Handle GenerateRelyType
-	switch req.GenerateRelyType {
-	case "首帧":
-		if len(urls) > 0 {
-			params.FirstFrameURL = urls[0]
-		} else if len(base64s) > 0 {
-			params.FirstFrameBase64 = base64s[0]
-		}
-	case "首尾帧":
-		if len(urls) >= 1 {
-			params.FirstFrameURL = urls[0]
-		} else if len(base64s) >= 1 {
-			params.FirstFrameBase64 = base64s[0]
-		}
-
-		if len(urls) >= 2 {
-			params.LastFrameURL = urls[1]
-		} else if len(base64s) >= 2 {
-			// If we have mixed usage (e.g. 1 url, 1 base64), logic gets complex.
-			// Assuming consistent input type or simplistic handling here.
-			// If urls has 1, and base64s has 1, maybe base64s[0] is the last frame?
-			// Let's stick to simple logic: prioritize URLs for both slots if available.
-			if len(urls) < 2 && len(base64s) >= 1 {
-				params.LastFrameBase64 = base64s[0]
-			} else if len(base64s) >= 2 {
-				params.LastFrameBase64 = base64s[1]
-			}
-		} else if len(base64s) >= 2 {
-			params.LastFrameBase64 = base64s[1]
-		}
-	case "参考图":
-		params.ReferenceImageURLs = urls
-		params.ReferenceImagesBase64 = base64s
-	default:
-		// If type is not specified but images are provided, default to reference images?
-		// Or maybe it's just text-to-video if no images.
-		if len(urls) > 0 {
-			params.ReferenceImageURLs = urls
-		}
-		if len(base64s) > 0 {
-			params.ReferenceImagesBase64 = base64s
-		}
+	if params.GenerateAudio == nil && !spec.Audio {
+		params.GenerateAudio = new(bool)
 	}
 
+	params.Images = videoImages(req)
+
 	taskID, err := s.arkClient.CreateVideoTask(ctx, params)
 	if err != nil {
 		return nil, fmt.Errorf("create video task failed: %w", err)
 	}
 
+	j := s.jobs.Create(taskID, spec.Alias, req.CallbackURL)
 	return &GenerationResponse{
 		Type:    "video",
 		TaskID:  taskID,
-		Message: "Video generation task created successfully. Use GetVideoTask to check status.",
+		JobID:   j.ID,
+		Message: "Video generation task created successfully. Use /api/jobs/" + j.ID + " to check status.",
 	}, nil
 }
+
+// ListJobs 返回本服务创建的视频任务，status为空时返回全部
+func (s *GenerationService) ListJobs(status string) []*job.Job {
+	return s.jobs.List(job.Status(status))
+}
+
+// CancelJob 取消视频任务
+func (s *GenerationService) CancelJob(ctx context.Context, id string) (*job.Job, error) {
+	return s.jobs.Cancel(ctx, id)
+}
+
+// GetJob 按ID获取视频任务
+func (s *GenerationService) GetJob(id string) (*job.Job, bool) {
+	return s.jobs.Get(id)
+}
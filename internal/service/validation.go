@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/job"
+	"illustration2/internal/volc"
+	"math"
+	"slices"
+	"strings"
+)
+
+const defaultImageSize = "2K" // 未指定size时的图片尺寸
+
+// FieldError 单个请求字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError 请求校验错误，包含所有不合法的字段
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err 没有不合法字段时返回nil
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// validateCommon 校验图片和视频请求共有的字段
+func validateCommon(req GenerationRequest, v *ValidationError) {
+	for i, img := range req.ImageList {
+		if strings.TrimSpace(img) == "" {
+			v.add(fmt.Sprintf("imageList[%d]", i), "is empty")
+		}
+	}
+	if req.Seed != nil && (*req.Seed < -1 || *req.Seed > math.MaxUint32) {
+		v.add("seed", "must be -1 or in [0, %d], got %d", uint32(math.MaxUint32), *req.Seed)
+	}
+}
+
+// validateVideoImages 校验带角色的图片列表，返回对应的图片依赖方式，列表不合法时返回空字符串
+func validateVideoImages(images []VideoImageInput, v *ValidationError) string {
+	counts := make(map[string]int, 3)
+	valid := true
+	for i, img := range images {
+		if strings.TrimSpace(img.Src) == "" {
+			v.add(fmt.Sprintf("images[%d].src", i), "is empty")
+			valid = false
+		}
+		switch img.Role {
+		case volc.VideoImageRoleFirstFrame, volc.VideoImageRoleLastFrame, volc.VideoImageRoleReference:
+			counts[img.Role]++
+		default:
+			v.add(fmt.Sprintf("images[%d].role", i), "unknown role %q, use %s, %s or %s", img.Role,
+				volc.VideoImageRoleFirstFrame, volc.VideoImageRoleLastFrame, volc.VideoImageRoleReference)
+			valid = false
+		}
+	}
+
+	first, last, refs := counts[volc.VideoImageRoleFirstFrame], counts[volc.VideoImageRoleLastFrame], counts[volc.VideoImageRoleReference]
+	if first > 1 {
+		v.add("images", "at most one %s is allowed, got %d", volc.VideoImageRoleFirstFrame, first)
+		valid = false
+	}
+	if last > 1 {
+		v.add("images", "at most one %s is allowed, got %d", volc.VideoImageRoleLastFrame, last)
+		valid = false
+	}
+	if last > 0 && first == 0 {
+		v.add("images", "%s requires a %s", volc.VideoImageRoleLastFrame, volc.VideoImageRoleFirstFrame)
+		valid = false
+	}
+	if refs > 0 && first+last > 0 {
+		v.add("images", "%s cannot be combined with %s or %s", volc.VideoImageRoleReference,
+			volc.VideoImageRoleFirstFrame, volc.VideoImageRoleLastFrame)
+		valid = false
+	}
+	if !valid {
+		return ""
+	}
+	switch {
+	case last > 0:
+		return config.RelyTypeFirstLastFrame
+	case first > 0:
+		return config.RelyTypeFirstFrame
+	default:
+		return config.RelyTypeReference
+	}
+}
+
+// validateImageRequest 按模型能力校验图片生成请求
+func (s *GenerationService) validateImageRequest(req GenerationRequest) (*config.ModelSpec, error) {
+	v := &ValidationError{}
+	if strings.TrimSpace(req.Prompt) == "" {
+		v.add("prompt", "is required")
+	}
+	validateCommon(req, v)
+	if req.GenerateRelyType != "" {
+		v.add("generateRelyType", "only applies to video generation")
+	}
+	if req.Duration != 0 {
+		v.add("duration", "only applies to video generation")
+	}
+	if req.Ratio != "" {
+		v.add("ratio", "only applies to video generation, use size instead")
+	}
+	if req.Resolution != "" {
+		v.add("resolution", "only applies to video generation, use size instead")
+	}
+	if req.GenerateAudio != nil {
+		v.add("generateAudio", "only applies to video generation")
+	}
+	if len(req.Images) > 0 {
+		v.add("images", "only applies to video generation, use imageList instead")
+	}
+	if req.CallbackURL != "" {
+		v.add("callbackUrl", "only applies to video generation")
+	}
+	if req.MaxImages < 0 {
+		v.add("maxImages", "must not be negative, got %d", req.MaxImages)
+	}
+
+	spec := s.resolveModel(req.ModelName, config.ModelKindImage, v)
+	if spec != nil {
+		if req.Size != "" && !spec.SupportsSize(req.Size) {
+			v.add("size", "%q is not supported by %s, use one of %v or WxH", req.Size, spec.Alias, spec.Sizes)
+		}
+		if len(req.ImageList) > spec.MaxReferenceImages {
+			v.add("imageList", "%s accepts at most %d reference images", spec.Alias, spec.MaxReferenceImages)
+		}
+		if req.MaxImages > spec.MaxImages {
+			v.add("maxImages", "%s generates at most %d images, got %d", spec.Alias, spec.MaxImages, req.MaxImages)
+		}
+	}
+	return spec, v.err()
+}
+
+// validateVideoRequest 按模型能力校验视频生成请求，callbackUrl需解析域名确认不指向内网
+func (s *GenerationService) validateVideoRequest(ctx context.Context, req GenerationRequest) (*config.ModelSpec, error) {
+	v := &ValidationError{}
+	if strings.TrimSpace(req.Prompt) == "" && len(req.ImageList) == 0 && len(req.Images) == 0 {
+		v.add("prompt", "is required when no image is given")
+	}
+	validateCommon(req, v)
+	if req.Size != "" {
+		v.add("size", "only applies to image generation, use ratio and resolution instead")
+	}
+	if req.MaxImages != 0 {
+		v.add("maxImages", "only applies to image generation")
+	}
+	if req.CallbackURL != "" {
+		if err := job.ValidateCallbackURL(ctx, req.CallbackURL); err != nil {
+			v.add("callbackUrl", "%v", err)
+		}
+	}
+
+	relyType := ""
+	if len(req.Images) > 0 {
+		if len(req.ImageList) > 0 {
+			v.add("imageList", "cannot be combined with images")
+		}
+		if req.GenerateRelyType != "" {
+			v.add("generateRelyType", "cannot be combined with images, give each image a role instead")
+		}
+		relyType = validateVideoImages(req.Images, v)
+	}
+
+	spec := s.resolveModel(req.ModelName, config.ModelKindVideo, v)
+	if spec == nil {
+		return nil, v.err()
+	}
+	if req.Duration != 0 && (req.Duration < spec.MinDuration || req.Duration > spec.MaxDuration) {
+		v.add("duration", "%s supports %d-%d seconds, got %d", spec.Alias, spec.MinDuration, spec.MaxDuration, req.Duration)
+	}
+	if req.Ratio != "" && !slices.Contains(spec.Ratios, req.Ratio) {
+		v.add("ratio", "%q is not supported by %s, use one of %v", req.Ratio, spec.Alias, spec.Ratios)
+	}
+	if req.Resolution != "" && !slices.Contains(spec.Resolutions, req.Resolution) {
+		v.add("resolution", "%q is not supported by %s, use one of %v", req.Resolution, spec.Alias, spec.Resolutions)
+	}
+	if req.GenerateAudio != nil && *req.GenerateAudio && !spec.Audio {
+		v.add("generateAudio", "%s does not support audio generation", spec.Alias)
+	}
+
+	if len(req.Images) > 0 {
+		if relyType != "" && !spec.SupportsRelyType(relyType) {
+			v.add("images", "%s is not supported by %s, use one of %v", relyType, spec.Alias, spec.RelyTypes)
+		}
+		if relyType == config.RelyTypeReference && len(req.Images) > spec.MaxReferenceImages {
+			v.add("images", "%s accepts at most %d reference images, got %d", spec.Alias, spec.MaxReferenceImages, len(req.Images))
+		}
+		return spec, v.err()
+	}
+
+	n := len(req.ImageList)
+	switch req.GenerateRelyType {
+	case "":
+		if n > spec.MaxReferenceImages {
+			v.add("imageList", "%s accepts at most %d reference images", spec.Alias, spec.MaxReferenceImages)
+		}
+	case config.RelyTypeFirstFrame, config.RelyTypeFirstLastFrame, config.RelyTypeReference:
+		if !spec.SupportsRelyType(req.GenerateRelyType) {
+			v.add("generateRelyType", "%s is not supported by %s, use one of %v", req.GenerateRelyType, spec.Alias, spec.RelyTypes)
+			break
+		}
+		switch {
+		case req.GenerateRelyType == config.RelyTypeFirstFrame && n != 1:
+			v.add("imageList", "%s requires exactly 1 image, got %d", req.GenerateRelyType, n)
+		case req.GenerateRelyType == config.RelyTypeFirstLastFrame && n != 2:
+			v.add("imageList", "%s requires exactly 2 images, got %d", req.GenerateRelyType, n)
+		case req.GenerateRelyType == config.RelyTypeReference && (n == 0 || n > spec.MaxReferenceImages):
+			v.add("imageList", "%s requires 1-%d images, got %d", req.GenerateRelyType, spec.MaxReferenceImages, n)
+		}
+	default:
+		v.add("generateRelyType", "unknown rely type %q", req.GenerateRelyType)
+	}
+	return spec, v.err()
+}
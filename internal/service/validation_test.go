@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"illustration2/internal/config"
+	"illustration2/internal/volc"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateVideoImages(t *testing.T) {
+	first := VideoImageInput{Src: "https://example.com/first.png", Role: volc.VideoImageRoleFirstFrame}
+	last := VideoImageInput{Src: "https://example.com/last.png", Role: volc.VideoImageRoleLastFrame}
+	ref := VideoImageInput{Src: "https://example.com/ref.png", Role: volc.VideoImageRoleReference}
+
+	tests := []struct {
+		name      string
+		images    []VideoImageInput
+		want      string // 期望的图片依赖方式，不合法时为空
+		wantField string // 不合法时期望出现的错误字段
+	}{
+		{"first frame", []VideoImageInput{first}, config.RelyTypeFirstFrame, ""},
+		{"first and last frame", []VideoImageInput{first, last}, config.RelyTypeFirstLastFrame, ""},
+		{"last before first", []VideoImageInput{last, first}, config.RelyTypeFirstLastFrame, ""},
+		{"references", []VideoImageInput{ref, ref, ref}, config.RelyTypeReference, ""},
+		{"reference with first frame", []VideoImageInput{first, ref}, "", "images"},
+		{"reference with first and last frame", []VideoImageInput{first, last, ref}, "", "images"},
+		{"reference with last frame", []VideoImageInput{ref, last}, "", "images"},
+		{"last without first", []VideoImageInput{last}, "", "images"},
+		{"two first frames", []VideoImageInput{first, first}, "", "images"},
+		{"two last frames", []VideoImageInput{first, last, last}, "", "images"},
+		{"unknown role", []VideoImageInput{{Src: "https://example.com/a.png", Role: "middle_frame"}}, "", "images[0].role"},
+		{"missing role", []VideoImageInput{first, {Src: "https://example.com/a.png"}}, "", "images[1].role"},
+		{"empty src", []VideoImageInput{{Src: " ", Role: volc.VideoImageRoleFirstFrame}}, "", "images[0].src"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &ValidationError{}
+			got := validateVideoImages(tt.images, v)
+			if got != tt.want {
+				t.Errorf("rely type = %q, want %q", got, tt.want)
+			}
+			if tt.wantField == "" {
+				if err := v.err(); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !hasField(v, tt.wantField) {
+				t.Errorf("errors %v, want one on %s", v.Fields, tt.wantField)
+			}
+		})
+	}
+}
+
+func newTestService(t *testing.T) *GenerationService {
+	t.Helper()
+	t.Setenv("ARK_API_KEY", "test")
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGenerationService(nil, cfg, nil)
+}
+
+func TestValidateVideoRequestImages(t *testing.T) {
+	s := newTestService(t)
+	img := "https://example.com/a.png"
+
+	tests := []struct {
+		name      string
+		req       GenerationRequest
+		wantField string // 为空表示请求合法
+	}{
+		{"legacy reference images", GenerationRequest{ImageList: []string{img, img}}, ""},
+		{"legacy first frame", GenerationRequest{GenerateRelyType: config.RelyTypeFirstFrame, ImageList: []string{img}}, ""},
+		{"legacy first and last frame", GenerationRequest{GenerateRelyType: config.RelyTypeFirstLastFrame, ImageList: []string{img, img}}, ""},
+		{"legacy first and last frame with one image", GenerationRequest{GenerateRelyType: config.RelyTypeFirstLastFrame, ImageList: []string{img}}, "imageList"},
+		{"legacy unknown rely type", GenerationRequest{GenerateRelyType: "尾帧", ImageList: []string{img}}, "generateRelyType"},
+		{"images with roles", GenerationRequest{Images: []VideoImageInput{
+			{Src: img, Role: volc.VideoImageRoleFirstFrame}, {Src: img, Role: volc.VideoImageRoleLastFrame}}}, ""},
+		{"images combined with imageList", GenerationRequest{ImageList: []string{img}, Images: []VideoImageInput{
+			{Src: img, Role: volc.VideoImageRoleFirstFrame}}}, "imageList"},
+		{"images combined with generateRelyType", GenerationRequest{GenerateRelyType: config.RelyTypeFirstFrame, Images: []VideoImageInput{
+			{Src: img, Role: volc.VideoImageRoleFirstFrame}}}, "generateRelyType"},
+		{"loopback callback", GenerationRequest{CallbackURL: "http://127.0.0.1:8080/cb"}, "callbackUrl"},
+		{"metadata callback", GenerationRequest{CallbackURL: "http://169.254.169.254/latest/meta-data"}, "callbackUrl"},
+		{"non http callback", GenerationRequest{CallbackURL: "file:///etc/passwd"}, "callbackUrl"},
+		{"public callback", GenerationRequest{CallbackURL: "https://203.0.113.10/cb"}, ""},
+		{"too many reference images", GenerationRequest{Images: []VideoImageInput{
+			{Src: img, Role: volc.VideoImageRoleReference}, {Src: img, Role: volc.VideoImageRoleReference},
+			{Src: img, Role: volc.VideoImageRoleReference}, {Src: img, Role: volc.VideoImageRoleReference},
+			{Src: img, Role: volc.VideoImageRoleReference}}}, "images"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.ModelName = "seedance1.0"
+			tt.req.Prompt = "a cat"
+			_, err := s.validateVideoRequest(context.Background(), tt.req)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			v, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("got %v, want a ValidationError", err)
+			}
+			if !hasField(v, tt.wantField) {
+				t.Errorf("errors %v, want one on %s", v.Fields, tt.wantField)
+			}
+		})
+	}
+}
+
+// fieldNames 返回校验错误中的字段，不是ValidationError时测试失败
+func fieldNames(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	v, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+	fields := make([]string, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		fields = append(fields, f.Field)
+	}
+	return fields
+}
+
+func TestValidateImageRequest(t *testing.T) {
+	s := newTestService(t)
+	seed := func(n int64) *int64 { return &n }
+	yes := true
+
+	tests := []struct {
+		name       string
+		req        GenerationRequest
+		wantFields []string // 期望出错的全部字段，为空表示请求合法
+	}{
+		{"valid", GenerationRequest{ModelName: "seedream", Prompt: "a cat", Size: "2K", MaxImages: 15}, nil},
+		{"endpoint id", GenerationRequest{ModelName: "ep-20251124201143-rwjnq", Prompt: "a cat"}, nil},
+		{"custom size", GenerationRequest{ModelName: "seedream", Prompt: "a cat", Size: "2304x1728"}, nil},
+		{"seed -1", GenerationRequest{ModelName: "seedream", Prompt: "a cat", Seed: seed(-1)}, nil},
+		{"seed max", GenerationRequest{ModelName: "seedream", Prompt: "a cat", Seed: seed(math.MaxUint32)}, nil},
+		{"seed below range", GenerationRequest{ModelName: "seedream", Prompt: "a cat", Seed: seed(-2)}, []string{"seed"}},
+		{"seed above range", GenerationRequest{ModelName: "seedream", Prompt: "a cat", Seed: seed(math.MaxUint32 + 1)}, []string{"seed"}},
+		{"size too small", GenerationRequest{ModelName: "seedream", Prompt: "a cat", Size: "640x480"}, []string{"size"}},
+		{"too many images", GenerationRequest{ModelName: "seedream", Prompt: "a cat", MaxImages: 16}, []string{"maxImages"}},
+		{"negative max images", GenerationRequest{ModelName: "seedream", Prompt: "a cat", MaxImages: -1}, []string{"maxImages"}},
+		{"video model", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat"}, []string{"modelName"}},
+		{"unknown model", GenerationRequest{ModelName: "dall-e", Prompt: "a cat"}, []string{"modelName"}},
+		// 视频专用字段逐一报错
+		{"video only fields", GenerationRequest{ModelName: "seedream", Prompt: "a cat", GenerateRelyType: config.RelyTypeFirstFrame,
+			Duration: 5, Ratio: "16:9", Resolution: "720p", GenerateAudio: &yes, CallbackURL: "https://203.0.113.10/cb",
+			Images: []VideoImageInput{{Src: "https://example.com/a.png", Role: volc.VideoImageRoleFirstFrame}}},
+			[]string{"generateRelyType", "duration", "ratio", "resolution", "generateAudio", "images", "callbackUrl"}},
+		// 多个字段不合法时一次全部返回
+		{"several bad fields", GenerationRequest{ModelName: "seedream", ImageList: []string{""}, Seed: seed(-5), Size: "8K", MaxImages: 20},
+			[]string{"prompt", "imageList[0]", "seed", "size", "maxImages"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.validateImageRequest(tt.req)
+			if got := fieldNames(t, err); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("error fields %v, want %v (%v)", got, tt.wantFields, err)
+			}
+		})
+	}
+}
+
+func TestValidateVideoRequest(t *testing.T) {
+	s := newTestService(t)
+	yes := true
+
+	tests := []struct {
+		name       string
+		req        GenerationRequest
+		wantFields []string // 期望出错的全部字段，为空表示请求合法
+	}{
+		{"valid", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat", Duration: 12, Ratio: "adaptive", Resolution: "1080p"}, nil},
+		{"min duration", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat", Duration: 2}, nil},
+		{"duration too short", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat", Duration: 1}, []string{"duration"}},
+		{"duration too long", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat", Duration: 13}, []string{"duration"}},
+		// 不同模型的时长范围不同
+		{"seedance2.0 duration", GenerationRequest{ModelName: "seedance2.0", Prompt: "a cat", Duration: 15}, nil},
+		{"seedance2.0 duration too short", GenerationRequest{ModelName: "seedance2.0", Prompt: "a cat", Duration: 3}, []string{"duration"}},
+		{"unknown ratio", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat", Ratio: "2:1"}, []string{"ratio"}},
+		{"unsupported resolution", GenerationRequest{ModelName: "seedance2.0", Prompt: "a cat", Resolution: "1080p"}, []string{"resolution"}},
+		{"audio unsupported", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat", GenerateAudio: &yes}, []string{"generateAudio"}},
+		{"audio supported", GenerationRequest{ModelName: "seedance2.0", Prompt: "a cat", GenerateAudio: &yes}, nil},
+		{"image only prompt", GenerationRequest{ModelName: "seedance1.0", ImageList: []string{"https://example.com/a.png"}}, nil},
+		{"no prompt or image", GenerationRequest{ModelName: "seedance1.0"}, []string{"prompt"}},
+		{"image model", GenerationRequest{ModelName: "seedream", Prompt: "a cat"}, []string{"modelName"}},
+		// 图片专用字段逐一报错
+		{"image only fields", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat", Size: "2K", MaxImages: 2},
+			[]string{"size", "maxImages"}},
+		// 多个字段不合法时一次全部返回
+		{"several bad fields", GenerationRequest{ModelName: "seedance1.0", Prompt: "a cat", Duration: 30, Ratio: "2:1", Resolution: "4k", Size: "2K"},
+			[]string{"size", "duration", "ratio", "resolution"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.validateVideoRequest(context.Background(), tt.req)
+			if got := fieldNames(t, err); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("error fields %v, want %v (%v)", got, tt.wantFields, err)
+			}
+		})
+	}
+}
+
+// TestDefaultModel 未指定modelName时使用配置中的默认模型
+func TestDefaultModel(t *testing.T) {
+	s := newTestService(t)
+	spec, err := s.validateImageRequest(GenerationRequest{Prompt: "a cat"})
+	if err != nil || spec.Alias != s.cfg.Models.Image {
+		t.Errorf("image: got %v, %v, want %s", spec, err, s.cfg.Models.Image)
+	}
+	spec, err = s.validateVideoRequest(context.Background(), GenerationRequest{Prompt: "a cat"})
+	if err != nil || spec.Alias != s.cfg.Models.Video {
+		t.Errorf("video: got %v, %v, want %s", spec, err, s.cfg.Models.Video)
+	}
+
+	s.cfg.Models.Video = ""
+	_, err = s.validateVideoRequest(context.Background(), GenerationRequest{Prompt: "a cat"})
+	if got := fieldNames(t, err); !reflect.DeepEqual(got, []string{"modelName"}) {
+		t.Errorf("without default model: error fields %v, want [modelName]", got)
+	}
+}
+
+func TestVideoImages(t *testing.T) {
+	a, b, c := "https://example.com/a.png", "https://example.com/b.png", "https://example.com/c.png"
+	tests := []struct {
+		name string
+		req  GenerationRequest
+		want []volc.VideoImage
+	}{
+		{"legacy without rely type", GenerationRequest{ImageList: []string{a, b}}, []volc.VideoImage{
+			{Src: a, Role: volc.VideoImageRoleReference}, {Src: b, Role: volc.VideoImageRoleReference}}},
+		{"legacy reference", GenerationRequest{GenerateRelyType: config.RelyTypeReference, ImageList: []string{a, b, c}}, []volc.VideoImage{
+			{Src: a, Role: volc.VideoImageRoleReference}, {Src: b, Role: volc.VideoImageRoleReference}, {Src: c, Role: volc.VideoImageRoleReference}}},
+		{"legacy first frame", GenerationRequest{GenerateRelyType: config.RelyTypeFirstFrame, ImageList: []string{a}}, []volc.VideoImage{
+			{Src: a, Role: volc.VideoImageRoleFirstFrame}}},
+		{"legacy first and last frame", GenerationRequest{GenerateRelyType: config.RelyTypeFirstLastFrame, ImageList: []string{a, b}}, []volc.VideoImage{
+			{Src: a, Role: volc.VideoImageRoleFirstFrame}, {Src: b, Role: volc.VideoImageRoleLastFrame}}},
+		{"images keep order and roles", GenerationRequest{Images: []VideoImageInput{
+			{Src: b, Role: volc.VideoImageRoleLastFrame}, {Src: a, Role: volc.VideoImageRoleFirstFrame}}}, []volc.VideoImage{
+			{Src: b, Role: volc.VideoImageRoleLastFrame}, {Src: a, Role: volc.VideoImageRoleFirstFrame}}},
+		{"images take precedence over imageList", GenerationRequest{ImageList: []string{c}, Images: []VideoImageInput{
+			{Src: a, Role: volc.VideoImageRoleReference}}}, []volc.VideoImage{
+			{Src: a, Role: volc.VideoImageRoleReference}}},
+		{"no images", GenerationRequest{}, []volc.VideoImage{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := videoImages(tt.req)
+			if len(got) != len(tt.want) {
+				t.Fatalf("videoImages = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("videoImages = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func hasField(v *ValidationError, field string) bool {
+	for _, f := range v.Fields {
+		if f.Field == field || strings.HasPrefix(f.Field, field+"[") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 资源类型，作为存储key的前缀
+const (
+	AssetKindImage = "images"
+	AssetKindVideo = "videos"
+)
+
+// contentTypeExts 常见资源类型对应的扩展名
+var contentTypeExts = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/webp":      ".webp",
+	"image/gif":       ".gif",
+	"video/mp4":       ".mp4",
+	"video/quicktime": ".mov",
+	"video/webm":      ".webm",
+}
+
+// AssetArchiver 将模型生成的资源（会过期的URL或data URI）转存到AssetStore，返回稳定地址
+// 资源按内容的SHA-256寻址，重复内容只保存一份；store为nil时不转存，Archive原样返回地址
+type AssetArchiver struct {
+	store      AssetStore
+	downloader *utils.Downloader
+}
+
+// NewAssetArchiver downloader为nil时使用不重试、不缓存的默认下载器
+func NewAssetArchiver(store AssetStore, downloader *utils.Downloader) *AssetArchiver {
+	if downloader == nil {
+		downloader = utils.NewDownloader(config.DownloadConfig{}, nil)
+	}
+	return &AssetArchiver{store: store, downloader: downloader}
+}
+
+// Archive 下载src并保存，src已是存储中的地址时原样返回
+func (a *AssetArchiver) Archive(ctx context.Context, kind, src string) (string, error) {
+	if _, ok := a.key(src); ok || a.store == nil {
+		return src, nil
+	}
+	tmpDir, err := os.MkdirTemp("", "asset-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// 模型返回的地址只下载一次，不缓存
+	req := a.request(src, filepath.Join(tmpDir, "asset"))
+	req.NoCache = true
+	result, err := a.downloader.Download(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(result.Path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return a.put(ctx, kind, f, result.ContentType, srcExt(src))
+}
+
+// ArchiveFile 保存本地文件，如拼接后的视频
+func (a *AssetArchiver) ArchiveFile(ctx context.Context, kind, filePath string) (string, error) {
+	if a.store == nil {
+		return "", fmt.Errorf("asset store not configured")
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return a.put(ctx, kind, f, "", path.Ext(filePath))
+}
+
+// Download 将资源下载到本地文件，src可以是存储中的地址、http(s)地址或data URI
+func (a *AssetArchiver) Download(ctx context.Context, src, dst string) (*utils.DownloadResult, error) {
+	return a.downloader.Download(ctx, a.request(src, dst))
+}
+
+// DownloadAll 并发下载多个资源，srcs[i]保存到dsts[i]，失败时返回*utils.DownloadError
+func (a *AssetArchiver) DownloadAll(ctx context.Context, srcs, dsts []string) ([]*utils.DownloadResult, error) {
+	if len(srcs) != len(dsts) {
+		return nil, fmt.Errorf("got %d sources for %d destinations", len(srcs), len(dsts))
+	}
+	reqs := make([]utils.DownloadRequest, 0, len(srcs))
+	for i, src := range srcs {
+		reqs = append(reqs, a.request(src, dsts[i]))
+	}
+	return a.downloader.DownloadAll(ctx, reqs)
+}
+
+// InputURL 返回可作为模型输入的图片地址：模型无法访问的存储地址（如本地存储的相对地址）转换为data URI
+func (a *AssetArchiver) InputURL(ctx context.Context, src string) (string, error) {
+	key, ok := a.key(src)
+	if !ok || strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return src, nil
+	}
+	body, err := a.store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// put 计算内容哈希后保存，相同内容已存在时跳过上传
+func (a *AssetArchiver) put(ctx context.Context, kind string, f *os.File, contentType, ext string) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	if size == 0 {
+		return "", fmt.Errorf("asset is empty")
+	}
+	if contentType == "" || contentType == "application/octet-stream" {
+		head := make([]byte, 512)
+		n, _ := f.ReadAt(head, 0)
+		contentType = http.DetectContentType(head[:n])
+	}
+	if e, ok := contentTypeExts[contentType]; ok {
+		ext = e
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	key := kind + "/" + sum[:2] + "/" + sum + ext
+
+	exists, err := a.store.Exists(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		if err := a.store.Put(ctx, key, f, size, contentType); err != nil {
+			return "", fmt.Errorf("failed to save asset %s: %w", key, err)
+		}
+	}
+	return a.store.URL(key), nil
+}
+
+// request 按src的类型构造下载请求：存储中的资源从存储读取，data URI直接解码，其余按http(s)下载
+// 本地存储和data URI本身就在本地，不缓存
+func (a *AssetArchiver) request(src, dst string) utils.DownloadRequest {
+	req := utils.DownloadRequest{URL: src, Path: dst}
+	if key, ok := a.key(src); ok {
+		req.Open = a.openAsset(key)
+		_, req.NoCache = a.store.(*LocalAssetStore)
+	} else if strings.HasPrefix(src, "data:") {
+		req.Open = openDataURI(src)
+		req.NoCache = true
+	}
+	return req
+}
+
+// openAsset 读取存储中的资源，本地存储支持从offset处继续读取
+func (a *AssetArchiver) openAsset(key string) utils.OpenFunc {
+	return func(ctx context.Context, offset int64) (*utils.DownloadBody, error) {
+		if local, ok := a.store.(*LocalAssetStore); ok {
+			f, err := local.Open(key)
+			if err != nil {
+				return nil, utils.Permanent(err)
+			}
+			stat, err := f.Stat()
+			if err == nil {
+				_, err = f.Seek(offset, io.SeekStart)
+			}
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			return &utils.DownloadBody{Body: f, Offset: offset, Total: stat.Size()}, nil
+		}
+		body, err := a.store.Get(ctx, key)
+		if errors.Is(err, ErrAssetNotFound) || errors.Is(err, ErrInvalidAssetKey) {
+			return nil, utils.Permanent(err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &utils.DownloadBody{Body: body, Total: -1}, nil
+	}
+}
+
+// key 判断src是否为存储中的地址，是则返回对应的key
+func (a *AssetArchiver) key(src string) (string, bool) {
+	if a.store == nil {
+		return "", false
+	}
+	prefix := a.store.URL("")
+	if !strings.HasPrefix(src, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(src, prefix)
+	return key, validateAssetKey(key) == nil
+}
+
+// openDataURI 解析data:<type>;base64,<data>形式的资源
+func openDataURI(src string) utils.OpenFunc {
+	return func(ctx context.Context, offset int64) (*utils.DownloadBody, error) {
+		meta, data, ok := strings.Cut(strings.TrimPrefix(src, "data:"), ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return nil, utils.Permanent(fmt.Errorf("unsupported data uri"))
+		}
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, utils.Permanent(fmt.Errorf("invalid data uri: %w", err))
+		}
+		offset = min(offset, int64(len(decoded)))
+		return &utils.DownloadBody{
+			Body:        io.NopCloser(bytes.NewReader(decoded[offset:])),
+			Offset:      offset,
+			Total:       int64(len(decoded)),
+			ContentType: strings.TrimSuffix(meta, ";base64"),
+		}, nil
+	}
+}
+
+// srcExt 从URL路径中取扩展名，无法识别Content-Type时使用
+func srcExt(src string) string {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme == "data" {
+		return ""
+	}
+	ext := path.Ext(u.Path)
+	if len(ext) > 5 || validateAssetKey("x"+ext) != nil {
+		return ""
+	}
+	return strings.ToLower(ext)
+}
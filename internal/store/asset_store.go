@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"illustration2/internal/config"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrAssetNotFound 资源不存在
+	ErrAssetNotFound = errors.New("asset not found")
+	// ErrInvalidAssetKey 资源key不合法
+	ErrInvalidAssetKey = errors.New("invalid asset key")
+)
+
+// AssetStore 生成的图片、视频的持久化存储接口
+// key为内容寻址的相对路径，如images/ab/<sha256>.png，同一内容只保存一份
+type AssetStore interface {
+	// Put 保存资源，key已存在时覆盖
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+	// Get 读取资源，不存在时返回ErrAssetNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists 判断资源是否已保存
+	Exists(ctx context.Context, key string) (bool, error)
+	// URL 返回资源的稳定访问地址
+	URL(key string) string
+}
+
+// NewAssetStore 根据配置创建资源存储
+func NewAssetStore(cfg config.AssetsConfig) (AssetStore, error) {
+	switch cfg.Driver {
+	case config.AssetDriverLocal:
+		return NewLocalAssetStore(cfg.Local.Dir, cfg.Local.BaseURL)
+	case config.AssetDriverS3:
+		return NewS3AssetStore(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unsupported asset driver %q", cfg.Driver)
+	}
+}
+
+// validateAssetKey key只允许字母、数字及._-/，且不能包含空段或..
+func validateAssetKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return ErrInvalidAssetKey
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return ErrInvalidAssetKey
+		}
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.' || r == '_' || r == '-' || r == '/':
+		default:
+			return ErrInvalidAssetKey
+		}
+	}
+	return nil
+}
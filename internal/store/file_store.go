@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	stateFileName      = "state.json"
+	checkPointFileName = "checkpoint.bin"
+)
+
+// FileStore 基于本地文件的会话存储，每个会话一个目录：
+//
+//	<dir>/<sessionID>/state.json     会话状态
+//	<dir>/<sessionID>/checkpoint.bin adk checkpoint
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("session store dir required")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session store dir: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, checkPointID string) ([]byte, bool, error) {
+	return s.read(checkPointID, checkPointFileName)
+}
+
+func (s *FileStore) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
+	return s.write(checkPointID, checkPointFileName, checkPoint)
+}
+
+func (s *FileStore) GetState(ctx context.Context, sessionID string) ([]byte, bool, error) {
+	return s.read(sessionID, stateFileName)
+}
+
+func (s *FileStore) SetState(ctx context.Context, sessionID string, state []byte) error {
+	return s.write(sessionID, stateFileName, state)
+}
+
+func (s *FileStore) List(ctx context.Context) ([]SessionInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SessionInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info := SessionInfo{ID: entry.Name()}
+		for _, name := range []string{stateFileName, checkPointFileName} {
+			fi, err := os.Stat(filepath.Join(s.dir, entry.Name(), name))
+			if err == nil && fi.ModTime().After(info.UpdatedAt) {
+				info.UpdatedAt = fi.ModTime()
+			}
+		}
+		if info.UpdatedAt.IsZero() {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].UpdatedAt.After(infos[j].UpdatedAt) })
+	return infos, nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, sessionID string) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return os.RemoveAll(filepath.Join(s.dir, sessionID))
+}
+
+func (s *FileStore) read(sessionID, name string) ([]byte, bool, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, sessionID, name))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// write 先写临时文件再rename，避免进程中途退出留下半截文件
+func (s *FileStore) write(sessionID, name string, data []byte) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessionDir := filepath.Join(s.dir, sessionID)
+	if err := os.MkdirAll(sessionDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(sessionDir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(sessionDir, name))
+}
+
+var _ SessionStore = (*FileStore)(nil)
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalAssetStore 基于本地文件的资源存储，资源保存为<dir>/<key>，通过<baseURL>/<key>访问
+type LocalAssetStore struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalAssetStore(dir, baseURL string) (*LocalAssetStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("asset store dir required")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create asset store dir: %w", err)
+	}
+	return &LocalAssetStore{dir: dir, baseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// Put 先写临时文件再rename，避免读到半截文件
+func (s *LocalAssetStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalAssetStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.Open(key)
+}
+
+// Open 打开资源文件，供接口按Range返回
+func (s *LocalAssetStore) Open(key string) (*os.File, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrAssetNotFound
+	}
+	return f, err
+}
+
+func (s *LocalAssetStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *LocalAssetStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+func (s *LocalAssetStore) path(key string) (string, error) {
+	if err := validateAssetKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+var _ AssetStore = (*LocalAssetStore)(nil)
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore 基于内存的会话存储，进程重启后数据丢失
+type MemoryStore struct {
+	mu          sync.RWMutex
+	states      map[string][]byte
+	checkPoints map[string][]byte
+	updatedAt   map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states:      make(map[string][]byte),
+		checkPoints: make(map[string][]byte),
+		updatedAt:   make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, checkPointID string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.checkPoints[checkPointID]
+	return v, ok, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkPoints[checkPointID] = checkPoint
+	s.updatedAt[checkPointID] = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) GetState(ctx context.Context, sessionID string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.states[sessionID]
+	return v, ok, nil
+}
+
+func (s *MemoryStore) SetState(ctx context.Context, sessionID string, state []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[sessionID] = state
+	s.updatedAt[sessionID] = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]SessionInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(s.updatedAt))
+	for id, t := range s.updatedAt {
+		infos = append(infos, SessionInfo{ID: id, UpdatedAt: t})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].UpdatedAt.After(infos[j].UpdatedAt) })
+	return infos, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.states, sessionID)
+	delete(s.checkPoints, sessionID)
+	delete(s.updatedAt, sessionID)
+	return nil
+}
+
+var _ SessionStore = (*MemoryStore)(nil)
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"illustration2/internal/config"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash 空请求体的SHA-256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3AssetStore S3兼容的资源存储（如MinIO、TOS），使用path-style地址和AWS Signature V4签名
+type S3AssetStore struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *http.Client
+}
+
+func NewS3AssetStore(cfg config.S3AssetsConfig) (*S3AssetStore, error) {
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket required")
+	}
+	publicURL := strings.TrimRight(cfg.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = endpoint.String() + "/" + cfg.Bucket
+	}
+	return &S3AssetStore{
+		endpoint:  endpoint,
+		region:    cfg.Region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		publicURL: publicURL,
+		client:    &http.Client{},
+	}, nil
+}
+
+// Put 上传对象，请求体的SHA-256参与签名
+func (s *S3AssetStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	res, err := s.do(ctx, http.MethodPut, key, body, size, hex.EncodeToString(h.Sum(nil)), contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s.checkStatus(res, http.MethodPut, key)
+}
+
+func (s *S3AssetStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, 0, emptyPayloadHash, "")
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrAssetNotFound
+	}
+	if err := s.checkStatus(res, http.MethodGet, key); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3AssetStore) Exists(ctx context.Context, key string) (bool, error) {
+	res, err := s.do(ctx, http.MethodHead, key, nil, 0, emptyPayloadHash, "")
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := s.checkStatus(res, http.MethodHead, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3AssetStore) URL(key string) string {
+	return s.publicURL + "/" + key
+}
+
+// do 发送签名后的对象请求，key已校验只含无需转义的字符
+func (s *S3AssetStore) do(ctx context.Context, method, key string, body io.Reader, size int64, payloadHash, contentType string) (*http.Response, error) {
+	if err := validateAssetKey(key); err != nil {
+		return nil, err
+	}
+	objectPath := "/" + s.bucket + "/" + key
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint.String()+objectPath, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, objectPath, payloadHash, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign 按AWS Signature V4为请求添加Authorization头
+func (s *S3AssetStore) sign(req *http.Request, canonicalPath, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := [][2]string{{"host", req.URL.Host}}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers = append(headers, [2]string{"content-type", ct})
+	}
+	headers = append(headers, [2]string{"x-amz-content-sha256", payloadHash}, [2]string{"x-amz-date", amzDate})
+	sort.Slice(headers, func(i, j int) bool { return headers[i][0] < headers[j][0] })
+	var canonicalHeaders strings.Builder
+	names := make([]string, 0, len(headers))
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h[0] + ":" + strings.TrimSpace(h[1]) + "\n")
+		names = append(names, h[0])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func (s *S3AssetStore) checkStatus(res *http.Response, method, key string) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("s3 %s %s returned status %d: %s", method, key, res.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+var _ AssetStore = (*S3AssetStore)(nil)
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"illustration2/internal/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "us-east-1"
+)
+
+// fakeS3 校验SigV4签名的内存S3服务，只支持path-style的PUT/GET/HEAD对象请求
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+	puts    int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	t.Helper()
+	f := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := verifySigV4(r, body); err != nil {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>"+err.Error()+"</Message></Error>", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+		f.puts++
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySigV4 按AWS Signature V4重新计算签名并与Authorization头比较，PUT时同时校验请求体哈希
+func verifySigV4(r *http.Request, body []byte) error {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return errors.New("missing AWS4-HMAC-SHA256 authorization")
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(auth, ", ") {
+		k, v, _ := strings.Cut(part, "=")
+		fields[k] = v
+	}
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[0] != testAccessKey || credential[2] != testRegion ||
+		credential[3] != "s3" || credential[4] != "aws4_request" {
+		return fmt.Errorf("bad credential %q", fields["Credential"])
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, credential[1]) {
+		return fmt.Errorf("x-amz-date %q does not match credential date %s", amzDate, credential[1])
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	sum := sha256.Sum256(body)
+	if payloadHash != hex.EncodeToString(sum[:]) {
+		return errors.New("x-amz-content-sha256 does not match body")
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	for _, required := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !strings.Contains(";"+fields["SignedHeaders"]+";", ";"+required+";") {
+			return fmt.Errorf("%s not signed", required)
+		}
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join(credential[1:], "/")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{credential[1], testRegion, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if want := hex.EncodeToString(key); fields["Signature"] != want {
+		return fmt.Errorf("signature %s, want %s", fields["Signature"], want)
+	}
+	return nil
+}
+
+func newTestS3Store(t *testing.T, endpoint, secretKey string) *S3AssetStore {
+	t.Helper()
+	s, err := NewS3AssetStore(config.S3AssetsConfig{
+		Endpoint:  endpoint,
+		Region:    testRegion,
+		Bucket:    "assets",
+		AccessKey: testAccessKey,
+		SecretKey: secretKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestS3AssetStorePutGet(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	s := newTestS3Store(t, srv.URL, testSecretKey)
+	ctx := context.Background()
+	key := "images/ab/abcdef.png"
+	data := []byte("\x89PNG\r\n\x1a\nfake image")
+
+	if exists, err := s.Exists(ctx, key); err != nil || exists {
+		t.Fatalf("Exists before Put = %v, %v", exists, err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrAssetNotFound) {
+		t.Fatalf("Get before Put: got %v, want ErrAssetNotFound", err)
+	}
+	if err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := fake.types["/assets/"+key]; got != "image/png" {
+		t.Errorf("stored content type %q, want image/png", got)
+	}
+	if exists, err := s.Exists(ctx, key); err != nil || !exists {
+		t.Fatalf("Exists after Put = %v, %v", exists, err)
+	}
+	body, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer body.Close()
+	got, _ := io.ReadAll(body)
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get = %q, want %q", got, data)
+	}
+	if u := s.URL(key); u != srv.URL+"/assets/"+key {
+		t.Errorf("URL = %s", u)
+	}
+}
+
+func TestS3AssetStoreWrongSecret(t *testing.T) {
+	_, srv := newFakeS3(t)
+	s := newTestS3Store(t, srv.URL, "wrong-secret")
+	data := []byte("data")
+	err := s.Put(context.Background(), "images/ab/abcdef.png", bytes.NewReader(data), int64(len(data)), "image/png")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("Put with wrong secret: got %v, want 403", err)
+	}
+}
+
+func TestAssetArchiverS3(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	archiver := NewAssetArchiver(newTestS3Store(t, srv.URL, testSecretKey), nil)
+	ctx := context.Background()
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+	src := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+
+	u, err := archiver.Archive(ctx, AssetKindImage, src)
+	if err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	sum := sha256.Sum256(png)
+	digest := hex.EncodeToString(sum[:])
+	if want := srv.URL + "/assets/images/" + digest[:2] + "/" + digest + ".png"; u != want {
+		t.Fatalf("Archive = %s, want %s", u, want)
+	}
+	// 已是存储中的地址原样返回，相同内容不重复上传
+	if again, err := archiver.Archive(ctx, AssetKindImage, u); err != nil || again != u {
+		t.Fatalf("Archive stored url = %s, %v", again, err)
+	}
+	if _, err := archiver.Archive(ctx, AssetKindImage, src); err != nil {
+		t.Fatal(err)
+	}
+	if fake.puts != 1 {
+		t.Errorf("got %d uploads, want 1", fake.puts)
+	}
+	input, err := archiver.InputURL(ctx, u)
+	if err != nil || input != u {
+		t.Errorf("InputURL of public s3 url = %s, %v", input, err)
+	}
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/compose"
+)
+
+// ErrInvalidSessionID 会话ID不合法（为空或包含路径分隔符）
+var ErrInvalidSessionID = errors.New("invalid session id")
+
+// SessionStore 会话持久化存储接口
+// 同时保存插画流程的会话状态和adk的checkpoint，
+// 其中Get/Set实现compose.CheckPointStore，可直接作为Runner的CheckPointStore使用
+type SessionStore interface {
+	compose.CheckPointStore
+
+	// GetState 读取会话状态（JSON序列化后的字节）
+	GetState(ctx context.Context, sessionID string) ([]byte, bool, error)
+	// SetState 保存会话状态
+	SetState(ctx context.Context, sessionID string, state []byte) error
+	// List 列出所有已保存的会话
+	List(ctx context.Context) ([]SessionInfo, error)
+	// Delete 删除会话状态及checkpoint，会话不存在时不报错
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// SessionInfo 已保存会话的概要信息
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"` // 状态或checkpoint最近一次写入时间
+}
+
+func validateSessionID(sessionID string) error {
+	if sessionID == "" || sessionID == "." || sessionID == ".." || strings.ContainsAny(sessionID, `/\`) {
+		return ErrInvalidSessionID
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) SessionStore{
+		"memory": func(t *testing.T) SessionStore { return NewMemoryStore() },
+		"file": func(t *testing.T) SessionStore {
+			s, err := NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			ctx := context.Background()
+
+			if _, exists, err := s.GetState(ctx, "a"); err != nil || exists {
+				t.Fatalf("GetState of missing session = %v, %v", exists, err)
+			}
+			if _, exists, err := s.Get(ctx, "a"); err != nil || exists {
+				t.Fatalf("Get of missing checkpoint = %v, %v", exists, err)
+			}
+
+			if err := s.SetState(ctx, "a", []byte(`{"state":"story_review"}`)); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			if err := s.Set(ctx, "b", []byte("checkpoint b")); err != nil {
+				t.Fatal(err)
+			}
+			// 覆盖写入
+			if err := s.Set(ctx, "b", []byte("checkpoint b2")); err != nil {
+				t.Fatal(err)
+			}
+
+			if data, exists, err := s.GetState(ctx, "a"); err != nil || !exists || string(data) != `{"state":"story_review"}` {
+				t.Errorf("GetState = %q, %v, %v", data, exists, err)
+			}
+			if data, exists, err := s.Get(ctx, "b"); err != nil || !exists || string(data) != "checkpoint b2" {
+				t.Errorf("Get = %q, %v, %v", data, exists, err)
+			}
+			// 状态和checkpoint分开保存
+			if _, exists, _ := s.Get(ctx, "a"); exists {
+				t.Error("state visible as checkpoint")
+			}
+
+			infos, err := s.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(infos) != 2 || infos[0].ID != "b" || infos[1].ID != "a" || infos[0].UpdatedAt.IsZero() {
+				t.Errorf("List = %+v, want b then a", infos)
+			}
+
+			if err := s.Delete(ctx, "a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete(ctx, "missing"); err != nil {
+				t.Errorf("Delete of missing session: %v", err)
+			}
+			if _, exists, _ := s.GetState(ctx, "a"); exists {
+				t.Error("state exists after Delete")
+			}
+			if infos, _ := s.List(ctx); len(infos) != 1 || infos[0].ID != "b" {
+				t.Errorf("List after Delete = %+v", infos)
+			}
+		})
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPoint := []byte{0, 1, 2, 0xff}
+	if err := s.SetState(ctx, "a", []byte(`{"state":"image_review"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(ctx, "a", checkPoint); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟进程重启后用同一目录重新创建
+	s, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, exists, err := s.GetState(ctx, "a"); err != nil || !exists || string(data) != `{"state":"image_review"}` {
+		t.Errorf("GetState after reopen = %q, %v, %v", data, exists, err)
+	}
+	if data, exists, err := s.Get(ctx, "a"); err != nil || !exists || string(data) != string(checkPoint) {
+		t.Errorf("Get after reopen = %x, %v, %v", data, exists, err)
+	}
+	if infos, err := s.List(ctx); err != nil || len(infos) != 1 || infos[0].ID != "a" {
+		t.Errorf("List after reopen = %+v, %v", infos, err)
+	}
+	// 写入不留下临时文件
+	entries, _ := os.ReadDir(filepath.Join(dir, "a"))
+	if len(entries) != 2 {
+		t.Errorf("session dir has %d entries, want 2", len(entries))
+	}
+}
+
+func TestFileStoreReadError(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// state.json是目录时读取失败，返回错误而不是不存在
+	if err := os.MkdirAll(filepath.Join(dir, "a", stateFileName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists, err := s.GetState(ctx, "a"); err == nil || exists {
+		t.Errorf("GetState of unreadable state = %v, %v, want error", exists, err)
+	}
+}
+
+func TestFileStoreInvalidSessionID(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, id := range []string{"", ".", "..", "../a", `a\b`} {
+		if err := s.SetState(ctx, id, []byte("{}")); !errors.Is(err, ErrInvalidSessionID) {
+			t.Errorf("SetState(%q) = %v, want ErrInvalidSessionID", id, err)
+		}
+		if _, _, err := s.Get(ctx, id); !errors.Is(err, ErrInvalidSessionID) {
+			t.Errorf("Get(%q) = %v, want ErrInvalidSessionID", id, err)
+		}
+	}
+}
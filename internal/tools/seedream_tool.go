@@ -30,8 +30,8 @@ type ImageToolResp struct {
 	Count  int      `json:"count"`
 }
 
-func NewImageTool(ark *volc.ArkClient) *ImageTool {
-	return &ImageTool{ark: ark, Model: "ep-20251124201143-rwjnq"}
+func NewImageTool(ark *volc.ArkClient, model string) *ImageTool {
+	return &ImageTool{ark: ark, Model: model}
 }
 
 func (t *ImageTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
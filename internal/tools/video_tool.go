@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"illustration2/internal/volc"
-	"time"
 
 	einotool "github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
@@ -15,6 +14,7 @@ import (
 type VideoTool struct {
 	ark   *volc.ArkClient
 	Model string
+	Wait  volc.WaitOptions // 等待视频任务结束的轮询参数
 }
 
 // 视频生成请求参数
@@ -28,14 +28,16 @@ type VideoToolArgs struct {
 
 // 视频生成响应
 type VideoToolResp struct {
-	TaskID   string `json:"task_id"`
-	Status   string `json:"status"`
-	VideoURL string `json:"video_url"`
+	TaskID       string `json:"task_id"`
+	Status       string `json:"status"`
+	VideoURL     string `json:"video_url"`
+	LastFrameURL string `json:"last_frame_url,omitempty"`
+	Duration     int    `json:"duration,omitempty"`
 }
 
-// NewVideoTool 创建视频生成工具实例
-func NewVideoTool(ark *volc.ArkClient) *VideoTool {
-	return &VideoTool{ark: ark, Model: "ep-20251124201423-clr5b"}
+// NewVideoTool 创建视频生成工具实例，model为默认使用的推理接入点
+func NewVideoTool(ark *volc.ArkClient, model string, wait volc.WaitOptions) *VideoTool {
+	return &VideoTool{ark: ark, Model: model, Wait: wait}
 }
 
 // Info 获取视频生成工具信息
@@ -76,22 +78,23 @@ func (t *VideoTool) InvokableRun(ctx context.Context, argumentsInJSON string, op
 		return "", err
 	}
 
-	// 轮训获取视频生成结果
-	for {
-		status, url, err := t.ark.GetVideoTask(ctx, taskID)
-		if err != nil {
-			return "", err
-		}
-		if status == "success" {
-			out := VideoToolResp{TaskID: taskID, Status: status, VideoURL: url}
-			b, err := json.Marshal(out)
-			if err != nil {
-				return "", err
-			}
-			return string(b), nil
-		}
-		time.Sleep(5 * time.Second)
+	// 轮询获取视频生成结果
+	result, err := t.ark.WaitForVideoTask(ctx, taskID, t.Wait)
+	if err != nil {
+		return "", err
+	}
+	out := VideoToolResp{
+		TaskID:       taskID,
+		Status:       string(result.Status),
+		VideoURL:     result.VideoURL,
+		LastFrameURL: result.LastFrameURL,
+		Duration:     result.Duration,
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", err
 	}
+	return string(b), nil
 }
 
 var _ einotool.InvokableTool = (*VideoTool)(nil)
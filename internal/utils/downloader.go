@@ -0,0 +1,469 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"illustration2/internal/config"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachePruneInterval 两次清理过期缓存的最小间隔
+const cachePruneInterval = time.Hour
+
+// ErrDownloadTooLarge 资源超过download.max_bytes
+var ErrDownloadTooLarge = errors.New("download exceeds size limit")
+
+// DownloadBody 一次读取得到的内容
+type DownloadBody struct {
+	Body        io.ReadCloser
+	Offset      int64  // Body在资源中的起始位置，来源不支持续传时为0
+	Total       int64  // 资源总大小，未知时为-1
+	ContentType string // 资源类型，未知时为空
+}
+
+// OpenFunc 从offset处开始读取资源；来源不支持续传时可忽略offset，返回Offset为0的内容
+type OpenFunc func(ctx context.Context, offset int64) (*DownloadBody, error)
+
+// DownloadRequest 下载请求
+type DownloadRequest struct {
+	URL     string   // 资源地址，同时作为缓存key
+	Path    string   // 保存路径
+	Open    OpenFunc // 读取方式，为空时按http(s)下载URL
+	NoCache bool     // 来源本身就在本地（如本地存储、data URI）或只下载一次时不缓存
+}
+
+// DownloadResult 下载结果，缓存时同时作为缓存的元数据
+type DownloadResult struct {
+	URL         string    `json:"url"`
+	Path        string    `json:"-"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	ContentType string    `json:"content_type,omitempty"`
+	SavedAt     time.Time `json:"saved_at"`
+	Cached      bool      `json:"-"` // 是否命中缓存
+}
+
+// DownloadError 批量下载中第Index个请求失败
+type DownloadError struct {
+	Index int
+	Err   error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("download #%d: %v", e.Index, e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// permanentError 不需要重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记不需要重试的错误，如资源不存在
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Downloader 下载生成的资源：失败时按退避间隔重试，并用Range从已下载的位置继续；
+// 限制资源大小，记录SHA-256；配置了cache_dir时按URL缓存，重复下载同一地址直接使用缓存
+type Downloader struct {
+	cfg    config.DownloadConfig
+	client *http.Client
+
+	pruneMu   sync.Mutex
+	lastPrune time.Time
+}
+
+// NewDownloader 创建下载器，client为nil时使用以cfg.Timeout为超时时间的client
+func NewDownloader(cfg config.DownloadConfig, client *http.Client) *Downloader {
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+	cfg.Attempts = max(cfg.Attempts, 1)
+	cfg.Concurrency = max(cfg.Concurrency, 1)
+	return &Downloader{cfg: cfg, client: client}
+}
+
+// Download 下载资源到req.Path
+func (d *Downloader) Download(ctx context.Context, req DownloadRequest) (*DownloadResult, error) {
+	cacheable := d.cfg.CacheDir != "" && !req.NoCache
+	if cacheable {
+		d.maybePruneCache()
+		if result, ok := d.fromCache(req.URL, req.Path); ok {
+			return result, nil
+		}
+	}
+	open := req.Open
+	if open == nil {
+		open = d.openHTTP(req.URL)
+	}
+	result, err := d.fetch(ctx, req.URL, req.Path, open)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		if err := d.saveCache(result); err != nil {
+			log.Printf("failed to cache %s: %v\n", redactURL(req.URL), err)
+		}
+	}
+	return result, nil
+}
+
+// DownloadAll 按download.concurrency并发下载，结果与reqs一一对应
+// 任一请求失败时取消其余下载，返回*DownloadError
+func (d *Downloader) DownloadAll(ctx context.Context, reqs []DownloadRequest) ([]*DownloadResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*DownloadResult, len(reqs))
+	errs := make([]error, len(reqs))
+	sem := make(chan struct{}, d.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			results[i], errs[i] = d.Download(ctx, req)
+			if errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 优先返回导致取消的错误，而不是被取消的其余下载
+	for _, canceled := range []bool{false, true} {
+		for i, err := range errs {
+			if err != nil && errors.Is(err, context.Canceled) == canceled {
+				return nil, &DownloadError{Index: i, Err: err}
+			}
+		}
+	}
+	return results, nil
+}
+
+// fetch 下载到<dst>.part，完成后计算SHA-256并改名为dst
+func (d *Downloader) fetch(ctx context.Context, src, dst string, open OpenFunc) (*DownloadResult, error) {
+	part := dst + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(part)
+	defer f.Close()
+
+	var written int64
+	var contentType string
+	delay := d.cfg.RetryDelay
+	for attempt := 1; ; attempt++ {
+		contentType, err = d.fetchOnce(ctx, open, f, &written)
+		if err == nil {
+			break
+		}
+		var permanent *permanentError
+		if ctx.Err() != nil || errors.As(err, &permanent) {
+			return nil, fmt.Errorf("failed to download %s: %w", redactURL(src), err)
+		}
+		if attempt >= d.cfg.Attempts {
+			return nil, fmt.Errorf("failed to download %s after %d attempts: %w", redactURL(src), attempt, err)
+		}
+		log.Printf("download %s failed at byte %d (attempt %d/%d): %v\n", redactURL(src), written, attempt, d.cfg.Attempts, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(part, dst); err != nil {
+		return nil, err
+	}
+	return &DownloadResult{
+		URL:         src,
+		Path:        dst,
+		Size:        written,
+		SHA256:      hex.EncodeToString(h.Sum(nil)),
+		ContentType: contentType,
+		SavedAt:     time.Now(),
+	}, nil
+}
+
+// fetchOnce 从written处继续读取一次，written随写入更新，用于下次重试
+func (d *Downloader) fetchOnce(ctx context.Context, open OpenFunc, f *os.File, written *int64) (string, error) {
+	body, err := open(ctx, *written)
+	if err != nil {
+		return "", err
+	}
+	defer body.Body.Close()
+
+	if body.Offset != *written {
+		// 来源不支持续传或只返回了更早的内容，丢弃之后的部分
+		if body.Offset > *written {
+			return "", fmt.Errorf("source resumed at byte %d, want %d", body.Offset, *written)
+		}
+		if err := f.Truncate(body.Offset); err != nil {
+			return "", err
+		}
+		*written = body.Offset
+	}
+	if _, err := f.Seek(*written, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	limit := d.cfg.MaxBytes
+	if limit > 0 && body.Total > limit {
+		return "", Permanent(fmt.Errorf("%w: %d bytes, limit %d", ErrDownloadTooLarge, body.Total, limit))
+	}
+	var reader io.Reader = body.Body
+	if limit > 0 {
+		reader = io.LimitReader(body.Body, limit-*written+1)
+	}
+	n, err := io.Copy(f, reader)
+	*written += n
+	if limit > 0 && *written > limit {
+		return "", Permanent(fmt.Errorf("%w: more than %d bytes", ErrDownloadTooLarge, limit))
+	}
+	if err != nil {
+		return "", err
+	}
+	if body.Total >= 0 && *written != body.Total {
+		return "", fmt.Errorf("%w: got %d of %d bytes", io.ErrUnexpectedEOF, *written, body.Total)
+	}
+	return body.ContentType, nil
+}
+
+// openHTTP 以GET下载src，offset大于0时带Range头请求剩余部分
+func (d *Downloader) openHTTP(src string) OpenFunc {
+	return func(ctx context.Context, offset int64) (*DownloadBody, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+		if err != nil {
+			return nil, Permanent(err)
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		res, err := d.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		contentType, _, _ := strings.Cut(res.Header.Get("Content-Type"), ";")
+		body := &DownloadBody{Body: res.Body, Total: -1, ContentType: strings.TrimSpace(contentType)}
+		switch res.StatusCode {
+		case http.StatusOK:
+			body.Total = res.ContentLength
+		case http.StatusPartialContent:
+			start, total, ok := parseContentRange(res.Header.Get("Content-Range"))
+			if !ok {
+				res.Body.Close()
+				return nil, fmt.Errorf("invalid Content-Range %q", res.Header.Get("Content-Range"))
+			}
+			body.Offset, body.Total = start, total
+		default:
+			res.Body.Close()
+			err := fmt.Errorf("status code %d", res.StatusCode)
+			if res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+				return nil, err
+			}
+			return nil, Permanent(err)
+		}
+		return body, nil
+	}
+}
+
+// parseContentRange 解析bytes <start>-<end>/<total>，total为*时返回-1
+func parseContentRange(v string) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(v), "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	rng, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	first, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if size == "*" {
+		return start, -1, true
+	}
+	total, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// cachePaths 缓存文件及元数据的路径：<cache_dir>/<sha256(url)[:2]>/<sha256(url)>
+func (d *Downloader) cachePaths(src string) (string, string) {
+	sum := sha256.Sum256([]byte(src))
+	key := hex.EncodeToString(sum[:])
+	data := filepath.Join(d.cfg.CacheDir, key[:2], key)
+	return data, data + ".json"
+}
+
+// fromCache 缓存未过期且内容与记录的SHA-256一致时复制到dst
+func (d *Downloader) fromCache(src, dst string) (*DownloadResult, bool) {
+	dataPath, metaPath := d.cachePaths(src)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, false
+	}
+	var result DownloadResult
+	if err := json.Unmarshal(data, &result); err != nil || result.URL != src || time.Since(result.SavedAt) > d.cfg.CacheTTL {
+		os.Remove(dataPath)
+		os.Remove(metaPath)
+		return nil, false
+	}
+	sum, size, err := copyFileHashed(dataPath, dst)
+	if err != nil || size != result.Size || sum != result.SHA256 {
+		log.Printf("discard corrupted cache of %s\n", redactURL(src))
+		os.Remove(dst)
+		os.Remove(dataPath)
+		os.Remove(metaPath)
+		return nil, false
+	}
+	result.Path = dst
+	result.Cached = true
+	return &result, true
+}
+
+// saveCache 将下载结果写入缓存，先写临时文件再rename
+func (d *Downloader) saveCache(result *DownloadResult) error {
+	dataPath, metaPath := d.cachePaths(result.URL)
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0755); err != nil {
+		return err
+	}
+	tmp := dataPath + ".tmp"
+	if err := os.Link(result.Path, tmp); err != nil {
+		if _, _, err := copyFileHashed(result.Path, tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, dataPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	meta, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(metaPath+".tmp", meta, 0644); err != nil {
+		return err
+	}
+	return os.Rename(metaPath+".tmp", metaPath)
+}
+
+// maybePruneCache 每隔cachePruneInterval在后台清理一次过期缓存
+func (d *Downloader) maybePruneCache() {
+	d.pruneMu.Lock()
+	defer d.pruneMu.Unlock()
+	if time.Since(d.lastPrune) < cachePruneInterval {
+		return
+	}
+	d.lastPrune = time.Now()
+	go d.pruneCache()
+}
+
+// pruneCache 删除超过cache_ttl的缓存文件
+func (d *Downloader) pruneCache() {
+	expired := time.Now().Add(-d.cfg.CacheTTL)
+	err := filepath.WalkDir(d.cfg.CacheDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err == nil && info.ModTime().Before(expired) {
+			os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to prune download cache: %v\n", err)
+	}
+}
+
+// copyFileHashed 复制文件，返回内容的SHA-256和大小
+func copyFileHashed(src, dst string) (string, int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", 0, err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), in)
+	if err != nil {
+		out.Close()
+		return "", 0, err
+	}
+	if err := out.Close(); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// redactURL 日志和错误中去掉URL的查询参数，避免输出签名
+func redactURL(src string) string {
+	if strings.HasPrefix(src, "data:") {
+		meta, _, _ := strings.Cut(src, ",")
+		return meta
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return "resource"
+	}
+	u.RawQuery = ""
+	return u.String()
+}
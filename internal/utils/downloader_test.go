@@ -0,0 +1,416 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"illustration2/internal/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testContent = bytes.Repeat([]byte("0123456789"), 100)
+
+// fakeSource 模拟资源服务：
+//
+//	/file           正常返回，支持Range
+//	/drop           第一次请求返回400字节后断开连接，之后支持Range
+//	/drop-norange   第一次请求返回400字节后断开连接，之后忽略Range返回完整内容
+//	/unknown/<n>    不带Content-Length返回n字节
+//	/status/<code>  返回code，第三次请求起正常返回
+//	/wait           直到请求被取消才返回
+type fakeSource struct {
+	mu       sync.Mutex
+	requests map[string]int
+	ranges   map[string][]string
+}
+
+func newFakeSource(t *testing.T) (*fakeSource, *httptest.Server) {
+	t.Helper()
+	f := &fakeSource{requests: make(map[string]int), ranges: make(map[string][]string)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeSource) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+func (f *fakeSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests[r.URL.Path]++
+	n := f.requests[r.URL.Path]
+	f.ranges[r.URL.Path] = append(f.ranges[r.URL.Path], r.Header.Get("Range"))
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "video/mp4")
+	switch path := r.URL.Path; {
+	case path == "/file":
+		serveRange(w, r, true)
+	case path == "/drop" || path == "/drop-norange":
+		if n == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(testContent)))
+			w.Write(testContent[:400])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		serveRange(w, r, path == "/drop")
+	case strings.HasPrefix(path, "/unknown/"):
+		size, _ := strconv.Atoi(strings.TrimPrefix(path, "/unknown/"))
+		data := bytes.Repeat([]byte{'x'}, size)
+		// 先flush使响应使用chunked编码，不带Content-Length
+		w.Write(data[:size/2])
+		w.(http.Flusher).Flush()
+		w.Write(data[size/2:])
+	case strings.HasPrefix(path, "/status/"):
+		code, _ := strconv.Atoi(strings.TrimPrefix(path, "/status/"))
+		if n < 3 {
+			w.WriteHeader(code)
+			return
+		}
+		serveRange(w, r, true)
+	case path == "/wait":
+		<-r.Context().Done()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveRange 返回testContent，honourRange时按Range头返回206
+func serveRange(w http.ResponseWriter, r *http.Request, honourRange bool) {
+	var start int
+	if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err == nil && honourRange {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(testContent)-1, len(testContent)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(testContent[start:])
+		return
+	}
+	w.Write(testContent)
+}
+
+func newTestDownloader(cfg config.DownloadConfig) *Downloader {
+	if cfg.Attempts == 0 {
+		cfg.Attempts = 3
+	}
+	cfg.RetryDelay = time.Millisecond
+	d := NewDownloader(cfg, nil)
+	// 测试中不在后台清理缓存
+	d.lastPrune = time.Now()
+	return d
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadResume(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantRanges []string
+	}{
+		{"/file", []string{""}},
+		{"/drop", []string{"", "bytes=400-"}},
+		// 来源忽略Range时丢弃已下载的部分，从头写入
+		{"/drop-norange", []string{"", "bytes=400-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			src, srv := newFakeSource(t)
+			d := newTestDownloader(config.DownloadConfig{})
+			dst := filepath.Join(t.TempDir(), "video.mp4")
+			result, err := d.Download(context.Background(), DownloadRequest{URL: srv.URL + tt.path + "?sig=secret", Path: dst})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(dst)
+			if !bytes.Equal(got, testContent) {
+				t.Errorf("downloaded %d bytes, content mismatch", len(got))
+			}
+			if result.Size != int64(len(testContent)) || result.SHA256 != sha256Hex(testContent) || result.ContentType != "video/mp4" {
+				t.Errorf("result = %+v", result)
+			}
+			if fmt.Sprint(src.ranges[tt.path]) != fmt.Sprint(tt.wantRanges) {
+				t.Errorf("Range headers = %q, want %q", src.ranges[tt.path], tt.wantRanges)
+			}
+			if _, err := os.Stat(dst + ".part"); !os.IsNotExist(err) {
+				t.Error("partial file left behind")
+			}
+		})
+	}
+}
+
+// TestFetchOnceOffset 来源返回的起始位置早于已下载的位置时截断，晚于时报错
+func TestFetchOnceOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []int64 // 每次打开返回的起始位置
+		wantErr bool
+	}{
+		{"earlier offset truncates", []int64{0, 100}, false},
+		{"later offset rejected", []int64{0, 600}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			open := func(ctx context.Context, offset int64) (*DownloadBody, error) {
+				start := tt.offsets[min(calls, len(tt.offsets)-1)]
+				calls++
+				if calls == 1 {
+					// 第一次只返回400字节
+					return &DownloadBody{Body: io.NopCloser(bytes.NewReader(testContent[:400])), Total: int64(len(testContent))}, nil
+				}
+				if offset != 400 {
+					t.Errorf("resumed at %d, want 400", offset)
+				}
+				return &DownloadBody{Body: io.NopCloser(bytes.NewReader(testContent[start:])), Offset: start, Total: int64(len(testContent))}, nil
+			}
+			d := newTestDownloader(config.DownloadConfig{Attempts: 2})
+			dst := filepath.Join(t.TempDir(), "video.mp4")
+			_, err := d.Download(context.Background(), DownloadRequest{URL: "test://video", Path: dst, Open: open, NoCache: true})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "resumed at byte 600") {
+					t.Fatalf("got %v, want resume offset error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(dst); !bytes.Equal(got, testContent) {
+				t.Errorf("content mismatch after truncation, got %d bytes", len(got))
+			}
+		})
+	}
+}
+
+func TestDownloadMaxBytes(t *testing.T) {
+	tests := []struct {
+		path     string
+		maxBytes int64
+		wantErr  bool
+	}{
+		{"/file", 999, true},   // 已知大小，读取前拒绝
+		{"/file", 1000, false}, // 恰好等于上限
+		{"/unknown/600", 500, true},
+		{"/unknown/500", 500, false},
+		{"/unknown/600", 0, false}, // 0为不限制
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s limit %d", tt.path, tt.maxBytes), func(t *testing.T) {
+			src, srv := newFakeSource(t)
+			d := newTestDownloader(config.DownloadConfig{MaxBytes: tt.maxBytes})
+			result, err := d.Download(context.Background(), DownloadRequest{URL: srv.URL + tt.path, Path: filepath.Join(t.TempDir(), "out")})
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.path == "/file" && result.Size != 1000 {
+					t.Errorf("size = %d", result.Size)
+				}
+				return
+			}
+			if !errors.Is(err, ErrDownloadTooLarge) {
+				t.Fatalf("got %v, want ErrDownloadTooLarge", err)
+			}
+			// 超过上限是永久错误，不重试
+			if n := src.count(tt.path); n != 1 {
+				t.Errorf("got %d requests, want 1", n)
+			}
+		})
+	}
+}
+
+func TestDownloadRetry(t *testing.T) {
+	tests := []struct {
+		path         string
+		wantErr      bool
+		wantRequests int
+	}{
+		{"/status/503", false, 3},
+		{"/status/500", false, 3},
+		{"/status/429", false, 3},
+		{"/status/408", false, 3},
+		{"/status/404", true, 1},
+		{"/status/403", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			src, srv := newFakeSource(t)
+			d := newTestDownloader(config.DownloadConfig{Attempts: 3})
+			_, err := d.Download(context.Background(), DownloadRequest{URL: srv.URL + tt.path, Path: filepath.Join(t.TempDir(), "out")})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n := src.count(tt.path); n != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+
+	// 重试次数用完时返回最后一次的错误
+	src, srv := newFakeSource(t)
+	d := newTestDownloader(config.DownloadConfig{Attempts: 2})
+	_, err := d.Download(context.Background(), DownloadRequest{URL: srv.URL + "/status/503?sig=secret", Path: filepath.Join(t.TempDir(), "out")})
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("got %v, want error after 2 attempts", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error contains query string: %v", err)
+	}
+	if n := src.count("/status/503"); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		in           string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 400-999/1000", 400, 1000, true},
+		{" bytes 0-0/1 ", 0, 1, true},
+		{"bytes 400-999/*", 400, -1, true},
+		{"bytes */1000", 0, 0, false},
+		{"bytes 400/1000", 0, 0, false},
+		{"bytes 400-999", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+		{"bytes x-999/1000", 0, 0, false},
+		{"bytes 400-999/x", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, total, ok := parseContentRange(tt.in)
+		if start != tt.start || total != tt.total || ok != tt.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v, want %d, %d, %v", tt.in, start, total, ok, tt.start, tt.total, tt.ok)
+		}
+	}
+}
+
+func TestDownloadCache(t *testing.T) {
+	src, srv := newFakeSource(t)
+	d := newTestDownloader(config.DownloadConfig{CacheDir: t.TempDir(), CacheTTL: time.Hour})
+	dir := t.TempDir()
+	url := srv.URL + "/file"
+	download := func(name string) *DownloadResult {
+		t.Helper()
+		result, err := d.Download(context.Background(), DownloadRequest{URL: url, Path: filepath.Join(dir, name)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(result.Path); !bytes.Equal(got, testContent) {
+			t.Errorf("%s: content mismatch", name)
+		}
+		return result
+	}
+
+	if result := download("first"); result.Cached {
+		t.Error("first download reported as cached")
+	}
+	if result := download("hit"); !result.Cached || result.SHA256 != sha256Hex(testContent) || result.Path != filepath.Join(dir, "hit") {
+		t.Errorf("second download = %+v, want cache hit", result)
+	}
+	if n := src.count("/file"); n != 1 {
+		t.Fatalf("got %d requests after cache hit, want 1", n)
+	}
+
+	// 缓存内容与记录的SHA-256不一致时丢弃并重新下载
+	dataPath, metaPath := d.cachePaths(url)
+	if err := os.WriteFile(dataPath, bytes.Repeat([]byte{'x'}, len(testContent)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := download("corrupted"); result.Cached {
+		t.Error("corrupted cache used")
+	}
+	if n := src.count("/file"); n != 2 {
+		t.Errorf("got %d requests after corrupted cache, want 2", n)
+	}
+
+	// 超过cache_ttl的缓存不再使用
+	meta, _ := os.ReadFile(metaPath)
+	var cached DownloadResult
+	if err := json.Unmarshal(meta, &cached); err != nil {
+		t.Fatal(err)
+	}
+	cached.SavedAt = time.Now().Add(-2 * time.Hour)
+	meta, _ = json.Marshal(cached)
+	if err := os.WriteFile(metaPath, meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := download("expired"); result.Cached {
+		t.Error("expired cache used")
+	}
+	if n := src.count("/file"); n != 3 {
+		t.Errorf("got %d requests after cache expired, want 3", n)
+	}
+
+	// NoCache的请求不读写缓存
+	if _, err := d.Download(context.Background(), DownloadRequest{URL: url, Path: filepath.Join(dir, "nocache"), NoCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n := src.count("/file"); n != 4 {
+		t.Errorf("got %d requests for NoCache download, want 4", n)
+	}
+}
+
+func TestDownloadAll(t *testing.T) {
+	src, srv := newFakeSource(t)
+	d := newTestDownloader(config.DownloadConfig{Concurrency: 2})
+	dir := t.TempDir()
+	reqs := func(paths ...string) []DownloadRequest {
+		out := make([]DownloadRequest, len(paths))
+		for i, p := range paths {
+			out[i] = DownloadRequest{URL: srv.URL + p, Path: filepath.Join(dir, fmt.Sprintf("%d", i))}
+		}
+		return out
+	}
+
+	results, err := d.DownloadAll(context.Background(), reqs("/file", "/unknown/10", "/file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int64{1000, 10, 1000} {
+		if results[i].Size != want || results[i].Path != filepath.Join(dir, fmt.Sprintf("%d", i)) {
+			t.Errorf("result %d = %+v", i, results[i])
+		}
+	}
+
+	// 失败的请求取消其余下载，返回的是失败请求的错误而不是被取消的请求
+	d = newTestDownloader(config.DownloadConfig{Concurrency: 3})
+	start := time.Now()
+	_, err = d.DownloadAll(context.Background(), reqs("/wait", "/wait", "/missing"))
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) || downloadErr.Index != 2 || errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want DownloadError for #2", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("other downloads not cancelled")
+	}
+	if n := src.count("/missing"); n != 1 {
+		t.Errorf("got %d requests for /missing, want 1", n)
+	}
+
+	// 调用方取消时返回context.Canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = d.DownloadAll(ctx, reqs("/wait", "/wait", "/wait"))
+	if !errors.As(err, &downloadErr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want cancelled DownloadError", err)
+	}
+}
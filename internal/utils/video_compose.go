@@ -0,0 +1,409 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"illustration2/internal/config"
+	"illustration2/internal/model"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	composeSampleRate  = 48000 // 合成视频的音频采样率
+	subtitleMaxRunes   = 20    // 单条字幕的最大字数
+	titleFadeDuration  = 0.5   // 标题卡淡入淡出时长（秒）
+	bgmFadeOutDuration = 2.0   // 背景音乐结尾淡出时长（秒）
+)
+
+// StoryClip 参与合成的章节视频
+type StoryClip struct {
+	Path    string             // 本地视频文件
+	Chapter model.StoryChapter // 对应章节，Content用于生成字幕
+	Info    *VideoInfo         // 视频信息，为空时合成前用ffprobe读取
+}
+
+// composeSegment 合成时间线上的一段：标题卡或章节视频
+type composeSegment struct {
+	input    int     // ffmpeg输入序号，标题卡为-1
+	duration float64 // 时长（秒）
+	hasAudio bool    // 是否有音轨，没有时补静音以便交叉淡化
+	subtitle string  // 字幕文本
+	start    float64 // 在成片中的开始时间（秒）
+}
+
+// ComposeStoryVideo 将章节视频合成为故事视频：统一转码到cfg指定的分辨率和帧率，章节间交叉淡化，
+// 按章节内容生成SRT字幕（烧录或作为字幕轨），可选混入背景音乐，theme不为空时在片头加标题卡
+// 不需要任何加工且所有片段已符合cfg时直接复制流拼接
+func ComposeStoryVideo(ctx context.Context, theme string, clips []StoryClip, outputPath string, cfg config.ComposeConfig) error {
+	if len(clips) == 0 {
+		return fmt.Errorf("at least 1 clip required")
+	}
+	if outputPath == "" {
+		return fmt.Errorf("output path required")
+	}
+	// 读取的视频信息只在本次合成中使用，不写回调用方的clips
+	clips = slices.Clone(clips)
+	for i := range clips {
+		if clips[i].Info != nil {
+			continue
+		}
+		info, err := ProbeVideo(ctx, clips[i].Path)
+		if err != nil {
+			return err
+		}
+		clips[i].Info = info
+	}
+	theme = strings.TrimSpace(theme)
+	if canCopy(theme, clips, cfg) {
+		paths := make([]string, 0, len(clips))
+		for _, clip := range clips {
+			paths = append(paths, clip.Path)
+		}
+		return concatCopy(ctx, paths, outputPath)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "video_compose_*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var segments []composeSegment
+	titleFile := ""
+	if theme != "" && cfg.TitleDuration > 0 {
+		titleFile = filepath.Join(tmpDir, "title.txt")
+		if err := os.WriteFile(titleFile, []byte(theme), 0644); err != nil {
+			return err
+		}
+		segments = append(segments, composeSegment{input: -1, duration: cfg.TitleDuration.Seconds()})
+	}
+	for i, clip := range clips {
+		segments = append(segments, composeSegment{
+			input:    i,
+			duration: clip.Info.Duration,
+			hasAudio: clip.Info.HasAudio,
+			subtitle: clip.Chapter.Content,
+		})
+	}
+
+	transition, total := layoutSegments(segments, cfg.Transition.Seconds())
+
+	args := []string{"-y", "-hide_banner"}
+	for _, clip := range clips {
+		args = append(args, "-i", clip.Path)
+	}
+	nextInput := len(clips)
+
+	var filters []string
+	for i, seg := range segments {
+		filters = append(filters, segmentFilters(i, seg, cfg, titleFile)...)
+	}
+	filters = append(filters, joinFilters(segments, transition)...)
+	videoOut, audioOut := "vjoin", "ajoin"
+
+	srtFile := ""
+	if cfg.Subtitles != config.SubtitlesNone {
+		srt := buildSRT(segments, transition)
+		if srt != "" {
+			srtFile = filepath.Join(tmpDir, "subtitles.srt")
+			if err := os.WriteFile(srtFile, []byte(srt), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	if srtFile != "" && cfg.Subtitles == config.SubtitlesBurn {
+		style := "FontSize=16,Outline=1,Shadow=0,MarginV=18"
+		opts := "filename=" + quoteFilterValue(srtFile) + ":charenc=UTF-8:force_style=" + quoteFilterValue(style)
+		if cfg.FontFile != "" {
+			opts += ":fontsdir=" + quoteFilterValue(filepath.Dir(cfg.FontFile))
+		}
+		filters = append(filters, fmt.Sprintf("[%s]subtitles=%s[vsub]", videoOut, opts))
+		videoOut = "vsub"
+	}
+
+	if cfg.BGM != "" {
+		args = append(args, "-stream_loop", "-1", "-i", cfg.BGM)
+		fadeStart := max(total-bgmFadeOutDuration, 0)
+		filters = append(filters, fmt.Sprintf(
+			"[%d:a]aresample=%d,aformat=sample_fmts=fltp:channel_layouts=stereo,volume=%s,atrim=duration=%s,afade=t=out:st=%s:d=%s[bgm]",
+			nextInput, composeSampleRate, formatSeconds(cfg.BGMVolume), formatSeconds(total),
+			formatSeconds(fadeStart), formatSeconds(total-fadeStart)))
+		nextInput++
+		// amix按输入数平均音量，乘回2保持原声音量
+		if cfg.Ducking {
+			filters = append(filters,
+				fmt.Sprintf("[%s]asplit=2[amain][akey]", audioOut),
+				"[bgm][akey]sidechaincompress=threshold=0.02:ratio=8:attack=20:release=400[bgmduck]",
+				"[amain][bgmduck]amix=inputs=2:duration=first:dropout_transition=0,volume=2[amix]")
+		} else {
+			filters = append(filters, fmt.Sprintf("[%s][bgm]amix=inputs=2:duration=first:dropout_transition=0,volume=2[amix]", audioOut))
+		}
+		audioOut = "amix"
+	}
+
+	var subtitleArgs []string
+	if srtFile != "" && cfg.Subtitles == config.SubtitlesMux {
+		args = append(args, "-i", srtFile)
+		subtitleArgs = []string{"-map", fmt.Sprintf("%d:s", nextInput),
+			"-c:s", "mov_text", "-metadata:s:s:0", "language=chi"}
+	}
+
+	args = append(args, "-filter_complex", strings.Join(filters, ";"),
+		"-map", "["+videoOut+"]", "-map", "["+audioOut+"]")
+	args = append(args, subtitleArgs...)
+	args = append(args,
+		"-c:v", "libx264",
+		"-preset", cfg.Preset,
+		"-crf", strconv.Itoa(cfg.CRF),
+		"-pix_fmt", "yuv420p",
+		"-r", strconv.Itoa(cfg.FPS),
+		"-c:a", "aac",
+		"-b:a", "192k",
+		"-ar", strconv.Itoa(composeSampleRate),
+		"-movflags", "+faststart",
+		outputPath,
+	)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed: %w, output: %s", err, tailOutput(output))
+	}
+	return nil
+}
+
+// layoutSegments 计算各段在成片中的开始时间，相邻段重叠transition秒
+// transition不超过任一段时长的一半，返回实际使用的转场时长和成片总时长
+func layoutSegments(segments []composeSegment, transition float64) (float64, float64) {
+	for _, seg := range segments {
+		transition = min(transition, seg.duration/2)
+	}
+	total := 0.0
+	for i := range segments {
+		if i > 0 {
+			total -= transition
+		}
+		segments[i].start = total
+		total += segments[i].duration
+	}
+	return transition, total
+}
+
+// segmentFilters 将一段统一为相同的分辨率、帧率和音频格式，输出[v<i>]和[a<i>]
+func segmentFilters(i int, seg composeSegment, cfg config.ComposeConfig, titleFile string) []string {
+	duration := formatSeconds(seg.duration)
+	var video, audio string
+	if seg.input < 0 {
+		drawtext := "textfile=" + quoteFilterValue(titleFile) + ":expansion=none:fontcolor=white:fontsize=h/12:x=(w-text_w)/2:y=(h-text_h)/2"
+		if cfg.FontFile != "" {
+			drawtext += ":fontfile=" + quoteFilterValue(cfg.FontFile)
+		}
+		fade := min(titleFadeDuration, seg.duration/2)
+		video = fmt.Sprintf("color=c=black:s=%dx%d:r=%d:d=%s,drawtext=%s,fade=t=in:d=%s,fade=t=out:st=%s:d=%s,setsar=1,format=yuv420p[v%d]",
+			cfg.Width, cfg.Height, cfg.FPS, duration, drawtext,
+			formatSeconds(fade), formatSeconds(seg.duration-fade), formatSeconds(fade), i)
+	} else {
+		video = fmt.Sprintf("[%d:v]trim=duration=%s,setpts=PTS-STARTPTS,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%d,format=yuv420p[v%d]",
+			seg.input, duration, cfg.Width, cfg.Height, cfg.Width, cfg.Height, cfg.FPS, i)
+	}
+	if seg.hasAudio {
+		// 补齐或截断到视频时长，保证交叉淡化时音画对齐
+		audio = fmt.Sprintf("[%d:a]aresample=%d,aformat=sample_fmts=fltp:channel_layouts=stereo,apad,atrim=duration=%s,asetpts=PTS-STARTPTS[a%d]",
+			seg.input, composeSampleRate, duration, i)
+	} else {
+		audio = fmt.Sprintf("anullsrc=r=%d:cl=stereo,atrim=duration=%s,aformat=sample_fmts=fltp:channel_layouts=stereo[a%d]",
+			composeSampleRate, duration, i)
+	}
+	return []string{video, audio}
+}
+
+// joinFilters 按时间线连接各段，transition大于0时交叉淡化，否则直接拼接，输出[vjoin]和[ajoin]
+func joinFilters(segments []composeSegment, transition float64) []string {
+	if len(segments) == 1 {
+		return []string{"[v0]null[vjoin]", "[a0]anull[ajoin]"}
+	}
+	if transition <= 0 {
+		var inputs strings.Builder
+		for i := range segments {
+			fmt.Fprintf(&inputs, "[v%d][a%d]", i, i)
+		}
+		return []string{fmt.Sprintf("%sconcat=n=%d:v=1:a=1[vjoin][ajoin]", inputs.String(), len(segments))}
+	}
+
+	var filters []string
+	prevV, prevA := "v0", "a0"
+	for i := 1; i < len(segments); i++ {
+		outV, outA := fmt.Sprintf("vx%d", i), fmt.Sprintf("ax%d", i)
+		if i == len(segments)-1 {
+			outV, outA = "vjoin", "ajoin"
+		}
+		filters = append(filters,
+			fmt.Sprintf("[%s][v%d]xfade=transition=fade:duration=%s:offset=%s[%s]",
+				prevV, i, formatSeconds(transition), formatSeconds(segments[i].start), outV),
+			fmt.Sprintf("[%s][a%d]acrossfade=d=%s[%s]", prevA, i, formatSeconds(transition), outA))
+		prevV, prevA = outV, outA
+	}
+	return filters
+}
+
+// buildSRT 按章节在成片中的时间生成字幕，章节内容按句切分，时长按字数分配
+func buildSRT(segments []composeSegment, transition float64) string {
+	var b strings.Builder
+	n := 0
+	for i, seg := range segments {
+		cues := splitSubtitle(seg.subtitle, subtitleMaxRunes)
+		if len(cues) == 0 {
+			continue
+		}
+		// 避开前后的转场
+		start, end := seg.start, seg.start+seg.duration
+		if i > 0 {
+			start += transition / 2
+		}
+		if i < len(segments)-1 {
+			end -= transition / 2
+		}
+		runes := 0
+		for _, cue := range cues {
+			runes += utf8.RuneCountInString(cue)
+		}
+		t := start
+		for _, cue := range cues {
+			next := t + (end-start)*float64(utf8.RuneCountInString(cue))/float64(runes)
+			n++
+			fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", n, formatSRTTime(t), formatSRTTime(next), cue)
+			t = next
+		}
+	}
+	return b.String()
+}
+
+// splitSubtitle 将文本切分为字幕：句末标点处断开，逗号等处在超过maxRunes前断开，过长的分句按字数截断
+func splitSubtitle(text string, maxRunes int) []string {
+	var clauses []string
+	var clause []rune
+	flush := func(sentenceEnd bool) {
+		s := strings.TrimSpace(string(clause))
+		clause = clause[:0]
+		if s == "" {
+			return
+		}
+		if sentenceEnd {
+			s += "\n"
+		}
+		clauses = append(clauses, s)
+	}
+	for _, r := range text {
+		switch r {
+		case '\n', '\r':
+			flush(true)
+			continue
+		case '”', '’', '」', '』', '）', ')', '"':
+			// 右引号、右括号跟随前一分句
+			if len(clause) == 0 && len(clauses) > 0 {
+				last := clauses[len(clauses)-1]
+				trimmed := strings.TrimSuffix(last, "\n")
+				clauses[len(clauses)-1] = trimmed + string(r) + last[len(trimmed):]
+				continue
+			}
+		}
+		clause = append(clause, r)
+		switch r {
+		case '。', '！', '？', '!', '?', '…':
+			flush(true)
+		case '，', ',', '、', '；', ';', '：', ':':
+			flush(false)
+		}
+	}
+	flush(true)
+
+	var cues []string
+	var cue []rune
+	emit := func() {
+		s := strings.TrimRight(strings.TrimSpace(string(cue)), "，,、；;：:")
+		cue = cue[:0]
+		if s != "" {
+			cues = append(cues, s)
+		}
+	}
+	for _, c := range clauses {
+		sentenceEnd := strings.HasSuffix(c, "\n")
+		r := []rune(strings.TrimSuffix(c, "\n"))
+		if len(cue) > 0 && len(cue)+len(r) > maxRunes {
+			emit()
+		}
+		for len(r) > maxRunes {
+			// 优先在空格处断开，避免截断英文单词
+			cut := maxRunes
+			for j := maxRunes; j > 0; j-- {
+				if r[j] == ' ' {
+					cut = j
+					break
+				}
+			}
+			cue = append(cue, r[:cut]...)
+			emit()
+			r = []rune(strings.TrimLeft(string(r[cut:]), " "))
+		}
+		cue = append(cue, r...)
+		if sentenceEnd {
+			emit()
+		}
+	}
+	emit()
+	return cues
+}
+
+// canCopy 不加标题卡、转场、字幕和背景音乐，且所有片段编码参数一致并符合cfg时可直接复制流
+func canCopy(theme string, clips []StoryClip, cfg config.ComposeConfig) bool {
+	if (theme != "" && cfg.TitleDuration > 0) || cfg.BGM != "" {
+		return false
+	}
+	if len(clips) > 1 && cfg.Transition > 0 {
+		return false
+	}
+	if cfg.Subtitles != config.SubtitlesNone {
+		for _, clip := range clips {
+			if len(splitSubtitle(clip.Chapter.Content, subtitleMaxRunes)) > 0 {
+				return false
+			}
+		}
+	}
+	info := clips[0].Info
+	if info.Codec != "h264" || info.PixFmt != "yuv420p" || info.Width != cfg.Width || info.Height != cfg.Height ||
+		math.Abs(info.FPS-float64(cfg.FPS)) >= 0.01 {
+		return false
+	}
+	return sameFormat(clips)
+}
+
+// quoteFilterValue 用单引号包裹filtergraph参数值，并转义值中的单引号
+func quoteFilterValue(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+func formatSeconds(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+// formatSRTTime 格式化为SRT时间戳，如00:01:02,500
+func formatSRTTime(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// tailOutput 只保留ffmpeg输出的末尾部分，错误信息在最后
+func tailOutput(output []byte) string {
+	const limit = 2048
+	if len(output) > limit {
+		output = output[len(output)-limit:]
+	}
+	return string(output)
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"illustration2/internal/config"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLayoutSegments(t *testing.T) {
+	tests := []struct {
+		name           string
+		durations      []float64
+		transition     float64
+		wantStarts     []float64
+		wantTransition float64
+		wantTotal      float64
+	}{
+		{"no transition", []float64{2, 5, 5}, 0, []float64{0, 2, 7}, 0, 12},
+		{"transition", []float64{2, 5, 5}, 1, []float64{0, 1, 5}, 1, 10},
+		// 转场不超过最短一段的一半
+		{"clamped", []float64{2, 5, 5}, 3, []float64{0, 1, 5}, 1, 10},
+		{"single", []float64{5}, 1, []float64{0}, 1, 5},
+	}
+	for _, tt := range tests {
+		segments := make([]composeSegment, len(tt.durations))
+		for i, d := range tt.durations {
+			segments[i].duration = d
+		}
+		transition, total := layoutSegments(segments, tt.transition)
+		starts := make([]float64, len(segments))
+		for i, seg := range segments {
+			starts[i] = seg.start
+		}
+		if transition != tt.wantTransition || total != tt.wantTotal || !reflect.DeepEqual(starts, tt.wantStarts) {
+			t.Errorf("%s: got transition %v, total %v, starts %v, want %v, %v, %v",
+				tt.name, transition, total, starts, tt.wantTransition, tt.wantTotal, tt.wantStarts)
+		}
+	}
+}
+
+func TestJoinFilters(t *testing.T) {
+	three := []composeSegment{{duration: 2}, {duration: 5}, {duration: 5}}
+	transition, _ := layoutSegments(three, 1)
+
+	tests := []struct {
+		name       string
+		segments   []composeSegment
+		transition float64
+		want       []string
+	}{
+		{"single", three[:1], transition, []string{"[v0]null[vjoin]", "[a0]anull[ajoin]"}},
+		{"concat", three, 0, []string{"[v0][a0][v1][a1][v2][a2]concat=n=3:v=1:a=1[vjoin][ajoin]"}},
+		// xfade的offset是前一段在已拼接部分中结束前transition秒，即下一段的开始时间
+		{"xfade", three, transition, []string{
+			"[v0][v1]xfade=transition=fade:duration=1.000:offset=1.000[vx1]",
+			"[a0][a1]acrossfade=d=1.000[ax1]",
+			"[vx1][v2]xfade=transition=fade:duration=1.000:offset=5.000[vjoin]",
+			"[ax1][a2]acrossfade=d=1.000[ajoin]",
+		}},
+	}
+	for _, tt := range tests {
+		if got := joinFilters(tt.segments, tt.transition); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSegmentFilters(t *testing.T) {
+	cfg := config.ComposeConfig{Width: 1280, Height: 720, FPS: 24, FontFile: "/fonts/it's.ttf"}
+	tests := []struct {
+		name string
+		i    int
+		seg  composeSegment
+		want []string
+	}{
+		{"title card", 0, composeSegment{input: -1, duration: 2}, []string{
+			`color=c=black:s=1280x720:r=24:d=2.000,drawtext=textfile='/tmp/title.txt':expansion=none:fontcolor=white:fontsize=h/12:x=(w-text_w)/2:y=(h-text_h)/2:fontfile='/fonts/it'\''s.ttf',fade=t=in:d=0.500,fade=t=out:st=1.500:d=0.500,setsar=1,format=yuv420p[v0]`,
+			"anullsrc=r=48000:cl=stereo,atrim=duration=2.000,aformat=sample_fmts=fltp:channel_layouts=stereo[a0]",
+		}},
+		// 标题卡很短时淡入淡出各占一半
+		{"short title card", 0, composeSegment{input: -1, duration: 0.6}, []string{
+			`color=c=black:s=1280x720:r=24:d=0.600,drawtext=textfile='/tmp/title.txt':expansion=none:fontcolor=white:fontsize=h/12:x=(w-text_w)/2:y=(h-text_h)/2:fontfile='/fonts/it'\''s.ttf',fade=t=in:d=0.300,fade=t=out:st=0.300:d=0.300,setsar=1,format=yuv420p[v0]`,
+			"anullsrc=r=48000:cl=stereo,atrim=duration=0.600,aformat=sample_fmts=fltp:channel_layouts=stereo[a0]",
+		}},
+		{"clip with audio", 1, composeSegment{input: 0, duration: 5, hasAudio: true}, []string{
+			"[0:v]trim=duration=5.000,setpts=PTS-STARTPTS,scale=1280:720:force_original_aspect_ratio=decrease,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=24,format=yuv420p[v1]",
+			"[0:a]aresample=48000,aformat=sample_fmts=fltp:channel_layouts=stereo,apad,atrim=duration=5.000,asetpts=PTS-STARTPTS[a1]",
+		}},
+		// 没有音轨的片段补静音，交叉淡化需要每段都有音频
+		{"silent clip", 2, composeSegment{input: 1, duration: 4.5}, []string{
+			"[1:v]trim=duration=4.500,setpts=PTS-STARTPTS,scale=1280:720:force_original_aspect_ratio=decrease,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=24,format=yuv420p[v2]",
+			"anullsrc=r=48000:cl=stereo,atrim=duration=4.500,aformat=sample_fmts=fltp:channel_layouts=stereo[a2]",
+		}},
+	}
+	for _, tt := range tests {
+		if got := segmentFilters(tt.i, tt.seg, cfg, "/tmp/title.txt"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildSRT(t *testing.T) {
+	segments := []composeSegment{
+		{input: -1, duration: 2},
+		{input: 0, duration: 5, subtitle: "第一句。第二句话，大家都说完了。"},
+		{input: 1, duration: 5, subtitle: "结尾。"},
+	}
+	transition, _ := layoutSegments(segments, 1)
+	// 标题卡没有字幕；字幕避开转场，章节内按字数分配时长
+	want := strings.Join([]string{
+		"1\n00:00:01,500 --> 00:00:02,500\n第一句。\n",
+		"2\n00:00:02,500 --> 00:00:05,500\n第二句话，大家都说完了。\n",
+		"3\n00:00:05,500 --> 00:00:10,000\n结尾。\n",
+	}, "\n") + "\n"
+	if got := buildSRT(segments, transition); got != want {
+		t.Errorf("buildSRT:\ngot  %q\nwant %q", got, want)
+	}
+	if got := buildSRT([]composeSegment{{duration: 5}}, 0); got != "" {
+		t.Errorf("buildSRT without subtitles = %q", got)
+	}
+}
+
+func TestSplitSubtitle(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  \n ", nil},
+		{"小兔子抬头看月亮。月亮圆圆的，像一个大月饼！", []string{"小兔子抬头看月亮。", "月亮圆圆的，像一个大月饼！"}},
+		// 逗号处合并分句，超过上限前断开，末尾的逗号去掉
+		{"小兔子跳呀跳，跳过了小河，跳过了山坡，终于来到了月亮下面。", []string{"小兔子跳呀跳，跳过了小河，跳过了山坡", "终于来到了月亮下面。"}},
+		// 右引号跟随前一句
+		{"妈妈说：“早点睡。”然后关灯。", []string{"妈妈说：“早点睡。”", "然后关灯。"}},
+		{"第一行\n第二行", []string{"第一行", "第二行"}},
+		// 没有标点的长句按字数截断
+		{"从前有一只非常非常非常可爱的小兔子住在森林最深最深的地方它每天都去看月亮", []string{"从前有一只非常非常非常可爱的小兔子住在森", "林最深最深的地方它每天都去看月亮"}},
+		// 英文在空格处断开
+		{"The little rabbit looked up at the big round moon tonight.", []string{"The little rabbit", "looked up at the big", "round moon tonight."}},
+	}
+	for _, tt := range tests {
+		got := splitSubtitle(tt.in, 20)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitSubtitle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSRTTime(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0, "00:00:00,000"},
+		{0.0004, "00:00:00,000"},
+		{1.9996, "00:00:02,000"},
+		{62.5, "00:01:02,500"},
+		{3725.25, "01:02:05,250"},
+	}
+	for _, tt := range tests {
+		if got := formatSRTTime(tt.in); got != tt.want {
+			t.Errorf("formatSRTTime(%v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestComposeStoryVideoKeepsClips 合成读取的视频信息不写回调用方的clips
+func TestComposeStoryVideoKeepsClips(t *testing.T) {
+	path := t.TempDir() + "/video.mp4"
+	makeTestVideo(t, path)
+	clips := []StoryClip{{Path: path}}
+	cfg := config.ComposeConfig{Width: 64, Height: 48, FPS: 10, CRF: 30, Preset: "ultrafast", Subtitles: config.SubtitlesNone}
+	if err := ComposeStoryVideo(t.Context(), "", clips, t.TempDir()+"/out.mp4", cfg); err != nil {
+		t.Fatal(err)
+	}
+	if clips[0].Info != nil {
+		t.Error("ComposeStoryVideo modified clips[0].Info")
+	}
+}
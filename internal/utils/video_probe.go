@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidVideo 文件不是可用的视频：非视频内容、下载不完整或已损坏
+var ErrInvalidVideo = errors.New("invalid video")
+
+// VideoInfo ffprobe读取的视频信息
+type VideoInfo struct {
+	Codec      string  `json:"codec"`                 // 视频编码，如h264
+	PixFmt     string  `json:"pix_fmt"`               // 像素格式，如yuv420p
+	Width      int     `json:"width"`                 // 宽度
+	Height     int     `json:"height"`                // 高度
+	FPS        float64 `json:"fps"`                   // 帧率
+	Duration   float64 `json:"duration"`              // 时长（秒）
+	HasAudio   bool    `json:"has_audio"`             // 是否有音轨
+	AudioCodec string  `json:"audio_codec,omitempty"` // 音频编码，如aac
+	SampleRate int     `json:"sample_rate,omitempty"` // 音频采样率
+	Channels   int     `json:"channels,omitempty"`    // 音频声道数
+}
+
+// imageCodecs 单帧图片的编码，ffprobe会将其识别为视频流
+var imageCodecs = map[string]bool{"png": true, "mjpeg": true, "webp": true, "bmp": true, "tiff": true}
+
+// ProbeVideo 用ffprobe读取视频信息，空文件、非视频内容或不完整的文件返回ErrInvalidVideo
+func ProbeVideo(ctx context.Context, path string) (*VideoInfo, error) {
+	name := filepath.Base(path)
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		return nil, fmt.Errorf("%w: %s is empty", ErrInvalidVideo, name)
+	}
+
+	// -count_packets读取全部数据包（不解码），mdat被截断时读到的包少于moov中记录的帧数
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-count_packets",
+		"-show_entries", "stream=codec_type,codec_name,width,height,pix_fmt,avg_frame_rate,r_frame_rate,sample_rate,channels,nb_frames,nb_read_packets:format=duration",
+		"-of", "json", path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%w: %s cannot be parsed: %s", ErrInvalidVideo, name, firstLine(stderr.String()))
+		}
+		return nil, fmt.Errorf("ffprobe %s failed: %w", name, err)
+	}
+	// moov在文件头时截断的文件仍能解析，读取数据包时ffprobe会报告partial file
+	if msg := stderr.String(); strings.Contains(msg, "partial file") || strings.Contains(msg, "moov atom not found") {
+		return nil, fmt.Errorf("%w: %s is truncated: %s", ErrInvalidVideo, name, firstLine(msg))
+	}
+
+	var result struct {
+		Streams []struct {
+			CodecType    string `json:"codec_type"`
+			CodecName    string `json:"codec_name"`
+			Width        int    `json:"width"`
+			Height       int    `json:"height"`
+			PixFmt       string `json:"pix_fmt"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+			RFrameRate   string `json:"r_frame_rate"`
+			SampleRate   string `json:"sample_rate"`
+			Channels     int    `json:"channels"`
+			NbFrames     string `json:"nb_frames"`
+			NbReadPkts   string `json:"nb_read_packets"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("ffprobe %s: invalid output: %w", name, err)
+	}
+
+	info := &VideoInfo{}
+	hasVideo := false
+	for _, s := range result.Streams {
+		// 部分容器不记录帧数，无法比较
+		frames, _ := strconv.Atoi(s.NbFrames)
+		if read, err := strconv.Atoi(s.NbReadPkts); err == nil && frames > 0 && read < frames {
+			return nil, fmt.Errorf("%w: %s is truncated: %s stream has %d of %d packets", ErrInvalidVideo, name, s.CodecType, read, frames)
+		}
+		switch s.CodecType {
+		case "video":
+			if hasVideo || imageCodecs[s.CodecName] {
+				continue
+			}
+			hasVideo = true
+			info.Codec = s.CodecName
+			info.PixFmt = s.PixFmt
+			info.Width = s.Width
+			info.Height = s.Height
+			info.FPS = parseFrameRate(s.AvgFrameRate)
+			if info.FPS == 0 {
+				info.FPS = parseFrameRate(s.RFrameRate)
+			}
+		case "audio":
+			if info.HasAudio {
+				continue
+			}
+			info.HasAudio = true
+			info.AudioCodec = s.CodecName
+			info.SampleRate, _ = strconv.Atoi(s.SampleRate)
+			info.Channels = s.Channels
+		}
+	}
+	if !hasVideo {
+		return nil, fmt.Errorf("%w: %s has no video stream", ErrInvalidVideo, name)
+	}
+	if info.Width <= 0 || info.Height <= 0 {
+		return nil, fmt.Errorf("%w: %s has invalid resolution %dx%d", ErrInvalidVideo, name, info.Width, info.Height)
+	}
+	info.Duration, _ = strconv.ParseFloat(result.Format.Duration, 64)
+	if info.Duration <= 0 {
+		return nil, fmt.Errorf("%w: %s has no duration", ErrInvalidVideo, name)
+	}
+	return info, nil
+}
+
+// SameFormat 判断两个视频的编码参数是否一致，一致时可以直接拼接而无需转码
+func (v *VideoInfo) SameFormat(o *VideoInfo) bool {
+	return v.Codec == o.Codec &&
+		v.PixFmt == o.PixFmt &&
+		v.Width == o.Width &&
+		v.Height == o.Height &&
+		math.Abs(v.FPS-o.FPS) < 0.01 &&
+		v.HasAudio == o.HasAudio &&
+		v.AudioCodec == o.AudioCodec &&
+		v.SampleRate == o.SampleRate &&
+		v.Channels == o.Channels
+}
+
+// parseFrameRate 解析ffprobe的帧率，如30000/1001
+func parseFrameRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if line, _, ok := strings.Cut(s, "\n"); ok {
+		return line
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"illustration2/internal/config"
+	"illustration2/internal/model"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// makeTestVideo 用ffmpeg生成1秒的测试视频，moov在文件头
+func makeTestVideo(t *testing.T, path string) {
+	t.Helper()
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	out, err := exec.Command("ffmpeg", "-y", "-v", "error",
+		"-f", "lavfi", "-i", "testsrc=duration=1:size=64x48:rate=10",
+		"-f", "lavfi", "-i", "sine=duration=1:sample_rate=44100",
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-shortest",
+		"-movflags", "+faststart", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ffmpeg: %v: %s", err, out)
+	}
+}
+
+func TestProbeVideo(t *testing.T) {
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not installed")
+	}
+	dir := t.TempDir()
+	video := filepath.Join(dir, "video.mp4")
+	makeTestVideo(t, video)
+	data, err := os.ReadFile(video)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := filepath.Join(dir, "truncated.mp4")
+	if err := os.WriteFile(truncated, data[:len(data)*2/3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.mp4")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	text := filepath.Join(dir, "text.mp4")
+	if err := os.WriteFile(text, []byte("<Error><Code>AccessDenied</Code></Error>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatal(err)
+	}
+	pngFile := filepath.Join(dir, "image.mp4")
+	if err := os.WriteFile(pngFile, img.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := ProbeVideo(context.Background(), video)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Codec != "h264" || info.PixFmt != "yuv420p" || info.Width != 64 || info.Height != 48 ||
+		info.FPS != 10 || info.Duration <= 0 || !info.HasAudio || info.AudioCodec != "aac" || info.SampleRate != 44100 {
+		t.Errorf("ProbeVideo = %+v", info)
+	}
+
+	for name, path := range map[string]string{"empty": empty, "text": text, "png": pngFile, "truncated": truncated} {
+		if info, err := ProbeVideo(context.Background(), path); !errors.Is(err, ErrInvalidVideo) {
+			t.Errorf("%s: got %+v, %v, want ErrInvalidVideo", name, info, err)
+		}
+	}
+}
+
+func TestVideoInfoSameFormat(t *testing.T) {
+	base := VideoInfo{Codec: "h264", PixFmt: "yuv420p", Width: 1280, Height: 720, FPS: 24, Duration: 5,
+		HasAudio: true, AudioCodec: "aac", SampleRate: 48000, Channels: 2}
+	tests := []struct {
+		name   string
+		modify func(v *VideoInfo)
+		want   bool
+	}{
+		{"identical", func(v *VideoInfo) {}, true},
+		{"duration ignored", func(v *VideoInfo) { v.Duration = 8 }, true},
+		{"fps rounding", func(v *VideoInfo) { v.FPS = 24.001 }, true},
+		{"codec", func(v *VideoInfo) { v.Codec = "hevc" }, false},
+		{"pix fmt", func(v *VideoInfo) { v.PixFmt = "yuv444p" }, false},
+		{"width", func(v *VideoInfo) { v.Width = 1920 }, false},
+		{"height", func(v *VideoInfo) { v.Height = 1080 }, false},
+		{"fps", func(v *VideoInfo) { v.FPS = 30000.0 / 1001 }, false},
+		{"no audio", func(v *VideoInfo) { v.HasAudio, v.AudioCodec, v.SampleRate, v.Channels = false, "", 0, 0 }, false},
+		{"audio codec", func(v *VideoInfo) { v.AudioCodec = "mp3" }, false},
+		{"sample rate", func(v *VideoInfo) { v.SampleRate = 44100 }, false},
+		{"channels", func(v *VideoInfo) { v.Channels = 1 }, false},
+	}
+	for _, tt := range tests {
+		o := base
+		tt.modify(&o)
+		if got := base.SameFormat(&o); got != tt.want {
+			t.Errorf("%s: SameFormat = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := o.SameFormat(&base); got != tt.want {
+			t.Errorf("%s: reversed SameFormat = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanCopy(t *testing.T) {
+	info := &VideoInfo{Codec: "h264", PixFmt: "yuv420p", Width: 1280, Height: 720, FPS: 24, Duration: 5,
+		HasAudio: true, AudioCodec: "aac", SampleRate: 48000, Channels: 2}
+	other := *info
+	other.Width = 1920
+	cfg := config.ComposeConfig{Width: 1280, Height: 720, FPS: 24, Subtitles: config.SubtitlesNone}
+	clips := func(infos ...*VideoInfo) []StoryClip {
+		out := make([]StoryClip, len(infos))
+		for i, v := range infos {
+			out[i] = StoryClip{Path: "clip.mp4", Info: v}
+		}
+		return out
+	}
+	withSubtitle := clips(info, info)
+	withSubtitle[0].Chapter = model.StoryChapter{Content: "小兔子抬头看月亮。"}
+
+	tests := []struct {
+		name   string
+		theme  string
+		clips  []StoryClip
+		modify func(c *config.ComposeConfig)
+		want   bool
+	}{
+		{"plain concat", "", clips(info, info), func(c *config.ComposeConfig) {}, true},
+		{"different formats", "", clips(info, &other), func(c *config.ComposeConfig) {}, false},
+		{"output size differs", "", clips(info, info), func(c *config.ComposeConfig) { c.Width = 1920 }, false},
+		{"output fps differs", "", clips(info, info), func(c *config.ComposeConfig) { c.FPS = 30 }, false},
+		{"title card", "小兔子找月亮", clips(info, info), func(c *config.ComposeConfig) { c.TitleDuration = 2 * time.Second }, false},
+		{"theme without title card", "小兔子找月亮", clips(info, info), func(c *config.ComposeConfig) {}, true},
+		{"bgm", "", clips(info, info), func(c *config.ComposeConfig) { c.BGM = "bgm.mp3" }, false},
+		{"transition", "", clips(info, info), func(c *config.ComposeConfig) { c.Transition = time.Second }, false},
+		{"transition single clip", "", clips(info), func(c *config.ComposeConfig) { c.Transition = time.Second }, true},
+		{"subtitles", "", withSubtitle, func(c *config.ComposeConfig) { c.Subtitles = config.SubtitlesBurn }, false},
+		{"subtitles without text", "", clips(info, info), func(c *config.ComposeConfig) { c.Subtitles = config.SubtitlesMux }, true},
+		{"subtitles disabled", "", withSubtitle, func(c *config.ComposeConfig) {}, true},
+		{"not h264", "", clips(&VideoInfo{Codec: "hevc", PixFmt: "yuv420p", Width: 1280, Height: 720, FPS: 24}), func(c *config.ComposeConfig) {}, false},
+	}
+	for _, tt := range tests {
+		c := cfg
+		tt.modify(&c)
+		if got := canCopy(tt.theme, tt.clips, c); got != tt.want {
+			t.Errorf("%s: canCopy = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,15 +3,19 @@ package utils
 import (
 	"context"
 	"fmt"
-	"io"
+	"illustration2/internal/config"
+	"log"
+	"math"
 	"math/rand"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+// ConcatVideos 按顺序拼接视频，拼接前用ffprobe校验每个文件
+// 编码参数一致时直接复制流，否则以第一个视频的分辨率和帧率转码拼接
 func ConcatVideos(ctx context.Context, inputVideos []string, outputPath string) error {
 	if len(inputVideos) < 2 {
 		return fmt.Errorf("at least 2 input videos required")
@@ -21,12 +25,32 @@ func ConcatVideos(ctx context.Context, inputVideos []string, outputPath string)
 		return fmt.Errorf("output path required")
 	}
 
+	clips := make([]StoryClip, 0, len(inputVideos))
 	for _, video := range inputVideos {
-		if _, err := os.Stat(video); os.IsNotExist(err) {
-			return fmt.Errorf("video file not found: %s", video)
+		info, err := ProbeVideo(ctx, video)
+		if err != nil {
+			return err
 		}
+		clips = append(clips, StoryClip{Path: video, Info: info})
 	}
+	return concatClips(ctx, clips, outputPath)
+}
 
+// concatClips 拼接已读取视频信息的片段，编码参数不一致时转码
+func concatClips(ctx context.Context, clips []StoryClip, outputPath string) error {
+	if sameFormat(clips) {
+		paths := make([]string, 0, len(clips))
+		for _, clip := range clips {
+			paths = append(paths, clip.Path)
+		}
+		return concatCopy(ctx, paths, outputPath)
+	}
+	log.Printf("video formats differ, re-encoding %d clips\n", len(clips))
+	return ComposeStoryVideo(ctx, "", clips, outputPath, reencodeConfig(clips[0].Info))
+}
+
+// concatCopy 使用concat demuxer直接复制流拼接，要求所有视频编码参数一致
+func concatCopy(ctx context.Context, inputVideos []string, outputPath string) error {
 	listFile, err := createConcatListFile(inputVideos)
 	if err != nil {
 		return err
@@ -43,12 +67,34 @@ func ConcatVideos(ctx context.Context, inputVideos []string, outputPath string)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("ffmpeg failed: %w, output: %s", err, string(output))
+		return fmt.Errorf("ffmpeg failed: %w, output: %s", err, tailOutput(output))
 	}
 
 	return nil
 }
 
+// sameFormat 判断所有片段的编码参数是否一致
+func sameFormat(clips []StoryClip) bool {
+	for _, clip := range clips[1:] {
+		if !clip.Info.SameFormat(clips[0].Info) {
+			return false
+		}
+	}
+	return true
+}
+
+// reencodeConfig 转码拼接的参数：沿用info的分辨率和帧率，不加转场、字幕等
+func reencodeConfig(info *VideoInfo) config.ComposeConfig {
+	return config.ComposeConfig{
+		Width:     info.Width &^ 1,
+		Height:    info.Height &^ 1,
+		FPS:       max(int(math.Round(info.FPS)), 1),
+		CRF:       20,
+		Preset:    "medium",
+		Subtitles: config.SubtitlesNone,
+	}
+}
+
 func createConcatListFile(videos []string) (string, error) {
 	timestamp := time.Now().Format("20060102_150405")
 	randomNum := rand.Intn(10000)
@@ -79,7 +125,8 @@ func createConcatListFile(videos []string) (string, error) {
 	return listFile, nil
 }
 
-func ConcatVideosFromURLs(ctx context.Context, videoURLs []string, outputPath string) error {
+// ConcatVideosFromURLs 并发下载视频后按顺序拼接
+func ConcatVideosFromURLs(ctx context.Context, downloader *Downloader, videoURLs []string, outputPath string) error {
 	if len(videoURLs) < 2 {
 		return fmt.Errorf("at least 2 video URLs required")
 	}
@@ -97,44 +144,35 @@ func ConcatVideosFromURLs(ctx context.Context, videoURLs []string, outputPath st
 	}
 	defer os.RemoveAll(tmpDir)
 
-	var localVideos []string
+	reqs := make([]DownloadRequest, 0, len(videoURLs))
 	for i, url := range videoURLs {
-		localPath := filepath.Join(tmpDir, fmt.Sprintf("video_%d.mp4", i))
-		if err := downloadVideo(ctx, url, localPath); err != nil {
-			return err
-		}
-		localVideos = append(localVideos, localPath)
+		reqs = append(reqs, DownloadRequest{URL: url, Path: filepath.Join(tmpDir, fmt.Sprintf("video_%d.mp4", i))})
 	}
-
-	return ConcatVideos(ctx, localVideos, outputPath)
-}
-
-func downloadVideo(ctx context.Context, url, localPath string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := http.DefaultClient.Do(req)
+	results, err := downloader.DownloadAll(ctx, reqs)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed, status code: %d", resp.StatusCode)
+	clips := make([]StoryClip, 0, len(results))
+	for i, result := range results {
+		if !isVideoContentType(result.ContentType) {
+			return fmt.Errorf("video %d: %w: download returned content type %q", i+1, ErrInvalidVideo, result.ContentType)
+		}
+		info, err := ProbeVideo(ctx, result.Path)
+		if err != nil {
+			return fmt.Errorf("video %d: %w", i+1, err)
+		}
+		clips = append(clips, StoryClip{Path: result.Path, Info: info})
 	}
 
-	f, err := os.Create(localPath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+	return concatClips(ctx, clips, outputPath)
+}
 
-	_, err = io.Copy(f, resp.Body)
-	if err != nil {
-		return err
+// isVideoContentType 对象存储常返回通用的二进制类型，也视为视频，交由ffprobe校验
+func isVideoContentType(contentType string) bool {
+	switch strings.ToLower(contentType) {
+	case "", "application/octet-stream", "binary/octet-stream":
+		return true
 	}
-
-	return nil
+	return strings.HasPrefix(strings.ToLower(contentType), "video/")
 }
@@ -1,45 +1,41 @@
 package volc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"illustration2/internal/config"
 	"io"
+	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"strings"
 	"time"
 )
 
-const (
-	defaultBase = "https://ark.cn-beijing.volces.com"
-)
-
 type ArkClient struct {
 	BaseURL    string
 	APIKey     string
 	HTTPClient *http.Client
 	Mock       bool
+	Retry      RetryPolicy  // 失败重试策略
+	Limiter    *RateLimiter // 客户端限流，nil表示不限流
 }
 
-func NewArkClientDefault() *ArkClient {
-	apiKey := os.Getenv("ARK_API_KEY")
+// NewArkClient 根据配置创建Ark客户端，timeout为单次HTTP请求的超时时间
+func NewArkClient(cfg config.ArkConfig, timeout time.Duration) *ArkClient {
 	return &ArkClient{
-		BaseURL:    defaultBase,
-		APIKey:     apiKey,
-		HTTPClient: &http.Client{Timeout: 30 * time.Second},
-		Mock:       strings.ToLower(os.Getenv("ARK_MOCK")) == "1" || strings.ToLower(os.Getenv("ARK_MOCK")) == "true",
-	}
-}
-
-func NewArkClientWithTimeout(timeout time.Duration) *ArkClient {
-	apiKey := os.Getenv("ARK_API_KEY")
-	return &ArkClient{
-		BaseURL:    defaultBase,
-		APIKey:     apiKey,
+		BaseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		APIKey:     cfg.APIKey,
 		HTTPClient: &http.Client{Timeout: timeout},
-		Mock:       strings.ToLower(os.Getenv("ARK_MOCK")) == "1" || strings.ToLower(os.Getenv("ARK_MOCK")) == "true",
+		Mock:       cfg.Mock,
+		Retry: RetryPolicy{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			BaseDelay:   cfg.Retry.BaseDelay,
+			MaxDelay:    cfg.Retry.MaxDelay,
+		},
+		Limiter: defaultRateLimiter,
 	}
 }
 
@@ -50,6 +46,8 @@ type ImageGenParams struct {
 	SequentialImageGeneration string
 	ImageInputs               []string
 	MaxImages                 int
+	Seed                      *int64 // 随机种子，nil表示由服务端随机
+	Watermark                 *bool  // 是否添加水印，nil表示使用服务端默认值
 }
 
 func (c *ArkClient) GenerateImages(ctx context.Context, p ImageGenParams) ([]string, error) {
@@ -81,6 +79,12 @@ func (c *ArkClient) GenerateImages(ctx context.Context, p ImageGenParams) ([]str
 	if len(p.ImageInputs) > 0 {
 		body["image"] = p.ImageInputs
 	}
+	if p.Seed != nil {
+		body["seed"] = *p.Seed
+	}
+	if p.Watermark != nil {
+		body["watermark"] = *p.Watermark
+	}
 
 	var resp struct {
 		Data []struct {
@@ -89,11 +93,10 @@ func (c *ArkClient) GenerateImages(ctx context.Context, p ImageGenParams) ([]str
 			Format string `json:"format"`
 		} `json:"data"`
 	}
-	if err := c.postJSON(ctx, "/api/v3/images/generations", body, &resp); err != nil {
-		fmt.Printf("err: %+v\n", err)
+	// 生成图片按次计费，只在确定服务端未处理请求时重试
+	if err := c.postJSON(ctx, EndpointImageGenerate, "/api/v3/images/generations", false, body, &resp); err != nil {
 		return nil, err
 	}
-	fmt.Printf("resp: %+v\n", resp)
 	urls := make([]string, 0, len(resp.Data))
 	for _, d := range resp.Data {
 		if d.URL != "" {
@@ -114,9 +117,23 @@ func (c *ArkClient) GenerateImages(ctx context.Context, p ImageGenParams) ([]str
 	return urls, nil
 }
 
+// 视频生成输入图片的角色
+const (
+	VideoImageRoleFirstFrame = "first_frame"
+	VideoImageRoleLastFrame  = "last_frame"
+	VideoImageRoleReference  = "reference_image"
+)
+
+// VideoImage 视频生成的输入图片，Src为URL或Base64
+type VideoImage struct {
+	Src  string
+	Role string
+}
+
 type VideoTaskParams struct {
 	Model                 string
 	Prompt                string
+	Images                []VideoImage // 按顺序写入content，设置后忽略下面的首尾帧和参考图字段
 	ReferenceImageURLs    []string
 	ReferenceImagesBase64 []string
 	FirstFrameURL         string
@@ -125,6 +142,40 @@ type VideoTaskParams struct {
 	LastFrameBase64       string
 	GenerateAudio         *bool
 	Duration              int
+	Ratio                 string // 宽高比，如16:9、adaptive
+	Resolution            string // 分辨率，如720p
+	Seed                  *int64 // 随机种子，nil表示由服务端随机
+	Watermark             *bool  // 是否添加水印，nil表示使用服务端默认值
+}
+
+// videoImages 返回按顺序写入content的图片，未设置Images时依次取首帧、尾帧、参考图URL、参考图Base64
+func (p VideoTaskParams) videoImages() []VideoImage {
+	if len(p.Images) > 0 {
+		return p.Images
+	}
+	var images []VideoImage
+	if src := firstNonEmpty(p.FirstFrameURL, p.FirstFrameBase64); src != "" {
+		images = append(images, VideoImage{Src: src, Role: VideoImageRoleFirstFrame})
+	}
+	if src := firstNonEmpty(p.LastFrameURL, p.LastFrameBase64); src != "" {
+		images = append(images, VideoImage{Src: src, Role: VideoImageRoleLastFrame})
+	}
+	for _, src := range p.ReferenceImageURLs {
+		images = append(images, VideoImage{Src: src, Role: VideoImageRoleReference})
+	}
+	for _, src := range p.ReferenceImagesBase64 {
+		images = append(images, VideoImage{Src: src, Role: VideoImageRoleReference})
+	}
+	return images
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
 
 func (c *ArkClient) CreateVideoTask(ctx context.Context, p VideoTaskParams) (string, error) {
@@ -138,56 +189,14 @@ func (c *ArkClient) CreateVideoTask(ctx context.Context, p VideoTaskParams) (str
 	if p.GenerateAudio != nil {
 		genAudio = *p.GenerateAudio
 	}
-	content := make([]map[string]any, 0, 3) // 1 text + up to 2 images
+	content := make([]map[string]any, 0, 1+len(p.Images))
 	content = append(content, map[string]any{"type": "text", "text": p.Prompt})
-
-	// Helper to get image URL or Base64
-	getImageSrc := func(url, base64 string) string {
-		if url != "" {
-			return url
-		}
-		return base64
-	}
-
-	firstFrameSrc := getImageSrc(p.FirstFrameURL, p.FirstFrameBase64)
-	lastFrameSrc := getImageSrc(p.LastFrameURL, p.LastFrameBase64)
-
-	// 处理首帧+尾帧模式
-	if firstFrameSrc != "" && lastFrameSrc != "" {
+	for _, img := range p.videoImages() {
 		content = append(content, map[string]any{
 			"type":      "image_url",
-			"image_url": map[string]any{"url": firstFrameSrc},
-			"role":      "first_frame",
+			"image_url": map[string]any{"url": img.Src},
+			"role":      img.Role,
 		})
-		content = append(content, map[string]any{
-			"type":      "image_url",
-			"image_url": map[string]any{"url": lastFrameSrc},
-			"role":      "last_frame",
-		})
-		// 处理首帧模式
-	} else if firstFrameSrc != "" {
-		content = append(content, map[string]any{
-			"type":      "image_url",
-			"image_url": map[string]any{"url": firstFrameSrc},
-			"role":      "first_frame",
-		})
-		// 处理参考图片模式
-	} else if len(p.ReferenceImageURLs) > 0 {
-		for _, u := range p.ReferenceImageURLs {
-			content = append(content, map[string]any{
-				"type":      "image_url",
-				"image_url": map[string]any{"url": u},
-				"role":      "reference_image",
-			})
-		}
-	} else if len(p.ReferenceImagesBase64) > 0 {
-		for _, b := range p.ReferenceImagesBase64 {
-			content = append(content, map[string]any{
-				"type":      "image_url",
-				"image_url": map[string]any{"url": b},
-				"role":      "reference_image",
-			})
-		}
 	}
 
 	body := map[string]any{
@@ -198,12 +207,22 @@ func (c *ArkClient) CreateVideoTask(ctx context.Context, p VideoTaskParams) (str
 	if p.Duration > 0 {
 		body["duration"] = p.Duration
 	}
+	if p.Ratio != "" {
+		body["ratio"] = p.Ratio
+	}
+	if p.Resolution != "" {
+		body["resolution"] = p.Resolution
+	}
+	if p.Seed != nil {
+		body["seed"] = *p.Seed
+	}
+	if p.Watermark != nil {
+		body["watermark"] = *p.Watermark
+	}
 	var resp map[string]any
-	if err := c.postJSON(ctx, "/api/v3/contents/generations/tasks", body, &resp); err != nil {
-		fmt.Printf("err: %+v\n", err)
+	if err := c.postJSON(ctx, EndpointVideoCreate, "/api/v3/contents/generations/tasks", false, body, &resp); err != nil {
 		return "", err
 	}
-	fmt.Printf("resp: %+v\n", resp)
 	if id, ok := resp["task_id"].(string); ok && id != "" {
 		return id, nil
 	}
@@ -213,75 +232,82 @@ func (c *ArkClient) CreateVideoTask(ctx context.Context, p VideoTaskParams) (str
 	return "", errors.New("no task id in response")
 }
 
-func (c *ArkClient) GetVideoTask(ctx context.Context, taskID string) (string, string, error) {
-	if c.Mock {
-		return "succeeded", "https://example.com/mock_video.mp4", nil
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/v3/contents/generations/tasks/"+taskID, nil)
+// postJSON 发送POST请求，idempotent表示请求可安全重试（不会在服务端产生重复资源）
+func (c *ArkClient) postJSON(ctx context.Context, endpoint, path string, idempotent bool, body any, out any) error {
+	b, err := json.Marshal(body)
 	if err != nil {
-		return "", "", err
+		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+c.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	res, err := c.HTTPClient.Do(req)
+	bodyBytes, err := c.send(ctx, http.MethodPost, endpoint, path, b, idempotent)
 	if err != nil {
-		return "", "", err
-	}
-	defer res.Body.Close()
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return "", "", fmt.Errorf("http %d", res.StatusCode)
+		return err
 	}
-	var resp map[string]any
-	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
-		fmt.Printf("err: %+v\n", err)
-		return "", "", err
+	// 使用保存的bodyBytes进行解码
+	return json.Unmarshal(bodyBytes, out)
+}
+
+// ChatHTTPClient 供eino的chat model使用的HTTP客户端，请求不经过send，在此按EndpointChat限流
+func (c *ArkClient) ChatHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout:   c.HTTPClient.Timeout,
+		Transport: c.Limiter.Transport(EndpointChat, c.HTTPClient.Transport),
 	}
-	fmt.Printf("resp: %+v\n", resp)
-	status := getString(resp, "status")
-	var url string
-	if content, ok := resp["content"].(map[string]any); ok {
-		url = getString(content, "video_url")
+}
+
+// send 按限流等待令牌后发送请求，失败时按重试策略重试，返回响应体
+func (c *ArkClient) send(ctx context.Context, method, endpoint, path string, body []byte, idempotent bool) ([]byte, error) {
+	attempts := c.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			delay := c.Retry.delay(attempt-1, retryAfterOf(lastErr))
+			log.Printf("retry %s %s after %s (attempt %d/%d): %v\n", method, redactURL(c.BaseURL+path), delay, attempt, attempts, lastErr)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, lastErr
+			}
+		}
+		if err := c.Limiter.Wait(ctx, endpoint); err != nil {
+			return nil, err
+		}
+		respBody, err := c.sendOnce(ctx, method, path, body)
+		if err == nil {
+			return respBody, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !shouldRetry(err, idempotent) {
+			break
+		}
 	}
-	return status, url, nil
+	return nil, lastErr
 }
 
-func (c *ArkClient) postJSON(ctx context.Context, path string, body any, out any) error {
-	b, err := json.Marshal(body)
-	if err != nil {
-		return err
+func (c *ArkClient) sendOnce(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, strings.NewReader(string(b)))
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reqBody)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+c.APIKey)
 	req.Header.Set("Content-Type", "application/json")
-	// 打印req信息和header
-	fmt.Printf("POST %s\n%s\n%s\n", req.URL.String(), req.Header, string(b))
 	res, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
-	// 打印响应体
 	bodyBytes, err := io.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return fmt.Errorf("http %d: %s", res.StatusCode, string(bodyBytes))
+		return nil, newArkError(res, bodyBytes)
 	}
-	// 使用保存的bodyBytes进行解码
-	return json.Unmarshal(bodyBytes, out)
-}
-
-func getString(m map[string]any, k string) string {
-	if v, ok := m[k]; ok {
-		if s, ok := v.(string); ok {
-			return s
-		}
-	}
-	return ""
+	return bodyBytes, nil
 }
 
 func (c *ArkClient) ChatJSON(ctx context.Context, model string, prompt string) (string, error) {
@@ -302,7 +328,8 @@ func (c *ArkClient) ChatJSON(ctx context.Context, model string, prompt string) (
 			} `json:"delta"`
 		} `json:"choices"`
 	}
-	if err := c.postJSON(ctx, "/api/v3/chat/completions", reqBody, &resp); err != nil {
+	// 对话按token计费，与生成图片一样只在确定服务端未处理请求时重试
+	if err := c.postJSON(ctx, EndpointChat, "/api/v3/chat/completions", false, reqBody, &resp); err != nil {
 		return "", err
 	}
 	var content string
@@ -317,3 +344,13 @@ func (c *ArkClient) ChatJSON(ctx context.Context, model string, prompt string) (
 	}
 	return content, nil
 }
+
+// redactURL 日志中的请求地址，去掉可能带有签名等敏感信息的查询参数
+func redactURL(src string) string {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "request"
+	}
+	u.RawQuery = ""
+	return u.String()
+}
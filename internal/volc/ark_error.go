@@ -0,0 +1,139 @@
+package volc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ArkError Ark接口返回的错误，解析自响应体中的error信封：
+//
+//	{"error": {"code": "...", "message": "...", "param": "...", "type": "..."}}
+type ArkError struct {
+	StatusCode int           // HTTP状态码
+	Code       string        // Ark错误码，如RateLimitExceeded.EndpointRPMExceeded
+	Message    string        // Ark错误信息
+	Param      string        // 出错的参数
+	Type       string        // 错误类型
+	RequestID  string        // 请求ID，用于向Ark排查问题
+	RetryAfter time.Duration // Retry-After头指定的等待时间
+	Body       string        // 无法解析error信封时保留原始响应体
+}
+
+func (e *ArkError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ark http %d", e.StatusCode)
+	if e.Code != "" {
+		fmt.Fprintf(&sb, " %s", e.Code)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&sb, ": %s", e.Message)
+	} else if e.Body != "" {
+		fmt.Fprintf(&sb, ": %s", e.Body)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&sb, " (request_id: %s)", e.RequestID)
+	}
+	return sb.String()
+}
+
+// newArkError 根据非2xx响应构造ArkError
+func newArkError(res *http.Response, body []byte) *ArkError {
+	e := &ArkError{
+		StatusCode: res.StatusCode,
+		RequestID:  firstHeader(res.Header, "X-Request-Id", "X-Client-Request-Id", "X-Tt-Logid"),
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+	}
+	var envelope struct {
+		Error *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Param   string `json:"param"`
+			Type    string `json:"type"`
+		} `json:"error"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error != nil {
+		e.Code = envelope.Error.Code
+		e.Message = envelope.Error.Message
+		e.Param = envelope.Error.Param
+		e.Type = envelope.Error.Type
+		if e.RequestID == "" {
+			e.RequestID = envelope.RequestID
+		}
+	} else {
+		e.Body = string(body)
+	}
+	return e
+}
+
+func firstHeader(h http.Header, keys ...string) string {
+	for _, k := range keys {
+		if v := h.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (e *ArkError) codeHasPrefix(prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(e.Code, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// AsArkError 从错误链中取出ArkError
+func AsArkError(err error) (*ArkError, bool) {
+	var arkErr *ArkError
+	if errors.As(err, &arkErr) {
+		return arkErr, true
+	}
+	return nil, false
+}
+
+// IsRateLimited 请求被限流（RPM/TPM超限或服务过载）
+func IsRateLimited(err error) bool {
+	e, ok := AsArkError(err)
+	return ok && (e.StatusCode == http.StatusTooManyRequests || e.codeHasPrefix("RateLimitExceeded", "ServerOverloaded"))
+}
+
+// IsQuotaExceeded 额度耗尽或账户欠费
+func IsQuotaExceeded(err error) bool {
+	e, ok := AsArkError(err)
+	return ok && e.codeHasPrefix("QuotaExceeded", "AccountOverdue", "SetLimitExceeded")
+}
+
+// IsContentRejected 输入或输出内容未通过安全审核
+func IsContentRejected(err error) bool {
+	if e, ok := AsArkError(err); ok {
+		return strings.Contains(e.Code, "SensitiveContentDetected") || strings.Contains(e.Code, "RiskDetection")
+	}
+	var taskErr *VideoTaskError
+	return errors.As(err, &taskErr) && strings.Contains(taskErr.Code, "SensitiveContentDetected")
+}
+
+// IsInvalidParam 请求参数错误
+func IsInvalidParam(err error) bool {
+	e, ok := AsArkError(err)
+	return ok && (e.codeHasPrefix("InvalidParameter", "MissingParameter", "InvalidArgument") ||
+		(e.StatusCode == http.StatusBadRequest && e.Code == ""))
+}
+
+// IsModelNotFound 模型或推理接入点不存在、未开通
+func IsModelNotFound(err error) bool {
+	e, ok := AsArkError(err)
+	return ok && e.codeHasPrefix("InvalidEndpointOrModel", "ModelNotOpen", "InvalidEndpoint")
+}
+
+// IsAuthError API Key无效或无权限
+func IsAuthError(err error) bool {
+	e, ok := AsArkError(err)
+	return ok && (e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden ||
+		e.codeHasPrefix("AuthenticationError", "AccessDenied"))
+}
@@ -0,0 +1,129 @@
+package volc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func arkResponse(status int, header map[string]string) *http.Response {
+	res := &http.Response{StatusCode: status, Header: make(http.Header)}
+	for k, v := range header {
+		res.Header.Set(k, v)
+	}
+	return res
+}
+
+func TestNewArkError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		body    string
+		want    ArkError
+		wantMsg string
+	}{
+		{"envelope", http.StatusBadRequest, map[string]string{"X-Request-Id": "021741234567890abcdef"},
+			`{"error":{"code":"InvalidParameter","message":"The parameter ` + "`size`" + ` specified in the request is not valid","param":"size","type":"BadRequest"}}`,
+			ArkError{StatusCode: 400, Code: "InvalidParameter", Message: "The parameter `size` specified in the request is not valid",
+				Param: "size", Type: "BadRequest", RequestID: "021741234567890abcdef"},
+			"ark http 400 InvalidParameter: The parameter `size` specified in the request is not valid (request_id: 021741234567890abcdef)"},
+		{"retry after", http.StatusTooManyRequests, map[string]string{"Retry-After": "3", "X-Client-Request-Id": "client-1"},
+			`{"error":{"code":"RateLimitExceeded.EndpointRPMExceeded","message":"The request has exceeded the RPM limit of the endpoint.","param":"","type":"TooManyRequests"}}`,
+			ArkError{StatusCode: 429, Code: "RateLimitExceeded.EndpointRPMExceeded", Message: "The request has exceeded the RPM limit of the endpoint.",
+				Type: "TooManyRequests", RequestID: "client-1", RetryAfter: 3 * time.Second},
+			"ark http 429 RateLimitExceeded.EndpointRPMExceeded: The request has exceeded the RPM limit of the endpoint. (request_id: client-1)"},
+		// 响应头没有请求ID时使用响应体中的request_id
+		{"request id in body", http.StatusNotFound, nil,
+			`{"error":{"code":"InvalidEndpointOrModel.NotFound","message":"The model or endpoint ep-x does not exist or you do not have access to it.","type":"NotFound"},"request_id":"body-1"}`,
+			ArkError{StatusCode: 404, Code: "InvalidEndpointOrModel.NotFound", Message: "The model or endpoint ep-x does not exist or you do not have access to it.",
+				Type: "NotFound", RequestID: "body-1"},
+			"ark http 404 InvalidEndpointOrModel.NotFound: The model or endpoint ep-x does not exist or you do not have access to it. (request_id: body-1)"},
+		{"logid header", http.StatusUnauthorized, map[string]string{"X-Tt-Logid": "logid-1"},
+			`{"error":{"code":"AuthenticationError","message":"The API key in the request is missing or invalid.","type":"Unauthorized"}}`,
+			ArkError{StatusCode: 401, Code: "AuthenticationError", Message: "The API key in the request is missing or invalid.",
+				Type: "Unauthorized", RequestID: "logid-1"},
+			"ark http 401 AuthenticationError: The API key in the request is missing or invalid. (request_id: logid-1)"},
+		// 网关返回的非JSON响应保留原始内容
+		{"gateway html", http.StatusBadGateway, nil, "<html><body>502 Bad Gateway</body></html>",
+			ArkError{StatusCode: 502, Body: "<html><body>502 Bad Gateway</body></html>"},
+			"ark http 502: <html><body>502 Bad Gateway</body></html>"},
+		{"json without envelope", http.StatusInternalServerError, nil, `{"message":"internal error"}`,
+			ArkError{StatusCode: 500, Body: `{"message":"internal error"}`},
+			`ark http 500: {"message":"internal error"}`},
+		{"empty body", http.StatusServiceUnavailable, nil, "", ArkError{StatusCode: 503}, "ark http 503"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newArkError(arkResponse(tt.status, tt.header), []byte(tt.body))
+			if *got != tt.want {
+				t.Errorf("newArkError = %+v, want %+v", *got, tt.want)
+			}
+			if got.Error() != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", got.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestArkErrorPredicates(t *testing.T) {
+	ark := func(status int, code string) error {
+		body := fmt.Sprintf(`{"error":{"code":%q,"message":"test","type":"test"}}`, code)
+		return newArkError(arkResponse(status, nil), []byte(body))
+	}
+	type kinds struct{ rateLimited, quota, rejected, invalidParam, modelNotFound, auth bool }
+	tests := []struct {
+		name string
+		err  error
+		want kinds
+	}{
+		{"endpoint rpm", ark(429, "RateLimitExceeded.EndpointRPMExceeded"), kinds{rateLimited: true}},
+		{"endpoint tpm", ark(429, "RateLimitExceeded.EndpointTPMExceeded"), kinds{rateLimited: true}},
+		{"server overloaded", ark(429, "ServerOverloaded"), kinds{rateLimited: true}},
+		{"429 without code", newArkError(arkResponse(429, nil), []byte("Too Many Requests")), kinds{rateLimited: true}},
+		// 额度耗尽同样返回429
+		{"quota exceeded", ark(429, "QuotaExceeded"), kinds{rateLimited: true, quota: true}},
+		{"set limit exceeded", ark(429, "SetLimitExceeded"), kinds{rateLimited: true, quota: true}},
+		{"account overdue", ark(403, "AccountOverdueError"), kinds{quota: true, auth: true}},
+		{"input text sensitive", ark(400, "InputTextSensitiveContentDetected"), kinds{rejected: true}},
+		{"output image sensitive", ark(400, "OutputImageSensitiveContentDetected"), kinds{rejected: true}},
+		{"video task sensitive", &VideoTaskError{TaskID: "cgt-1", Status: VideoTaskFailed, Code: "OutputVideoSensitiveContentDetected"}, kinds{rejected: true}},
+		{"video task other failure", &VideoTaskError{TaskID: "cgt-1", Status: VideoTaskFailed, Code: "InternalServiceError"}, kinds{}},
+		{"invalid parameter", ark(400, "InvalidParameter"), kinds{invalidParam: true}},
+		{"missing parameter", ark(400, "MissingParameter"), kinds{invalidParam: true}},
+		{"400 without code", newArkError(arkResponse(400, nil), []byte("bad request")), kinds{invalidParam: true}},
+		{"model not found", ark(404, "InvalidEndpointOrModel.NotFound"), kinds{modelNotFound: true}},
+		{"model not open", ark(404, "ModelNotOpen"), kinds{modelNotFound: true}},
+		{"invalid api key", ark(401, "AuthenticationError"), kinds{auth: true}},
+		{"access denied", ark(403, "AccessDenied"), kinds{auth: true}},
+		{"internal error", ark(500, "InternalServiceError"), kinds{}},
+		{"wrapped", fmt.Errorf("generate images: %w", ark(429, "RateLimitExceeded.EndpointRPMExceeded")), kinds{rateLimited: true}},
+		{"not an ark error", errors.New("connection reset"), kinds{}},
+		{"nil", nil, kinds{}},
+	}
+	for _, tt := range tests {
+		got := kinds{
+			rateLimited:   IsRateLimited(tt.err),
+			quota:         IsQuotaExceeded(tt.err),
+			rejected:      IsContentRejected(tt.err),
+			invalidParam:  IsInvalidParam(tt.err),
+			modelNotFound: IsModelNotFound(tt.err),
+			auth:          IsAuthError(tt.err),
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAsArkError(t *testing.T) {
+	want := &ArkError{StatusCode: http.StatusTooManyRequests}
+	if got, ok := AsArkError(fmt.Errorf("a: %w", fmt.Errorf("b: %w", want))); !ok || got != want {
+		t.Errorf("AsArkError = %v, %v", got, ok)
+	}
+	if got, ok := AsArkError(errors.New("x")); ok || got != nil {
+		t.Errorf("AsArkError(non ark) = %v, %v", got, ok)
+	}
+}
@@ -0,0 +1,131 @@
+package volc
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Ark接口分类，用于按接口限流
+const (
+	EndpointImageGenerate = "images.generations"
+	EndpointVideoCreate   = "tasks.create"
+	EndpointVideoGet      = "tasks.get"
+	EndpointVideoDelete   = "tasks.delete"
+	EndpointChat          = "chat.completions"
+)
+
+// RateLimit 单个接口的令牌桶参数
+type RateLimit struct {
+	Rate  float64 // 每秒补充的令牌数
+	Burst int     // 桶容量
+}
+
+// RateLimiter 按接口划分的客户端令牌桶限流器，可在多个ArkClient之间共享
+type RateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[string]*tokenBucket
+}
+
+func NewRateLimiter(limits map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func DefaultRateLimits() map[string]RateLimit {
+	return map[string]RateLimit{
+		EndpointImageGenerate: {Rate: 2, Burst: 4},
+		EndpointVideoCreate:   {Rate: 1, Burst: 3},
+		EndpointVideoGet:      {Rate: 10, Burst: 10},
+		EndpointVideoDelete:   {Rate: 2, Burst: 5},
+		EndpointChat:          {Rate: 5, Burst: 10},
+	}
+}
+
+// defaultRateLimiter 所有默认构造的ArkClient共享，使限流对整个进程生效
+var defaultRateLimiter = NewRateLimiter(DefaultRateLimits())
+
+// Wait 等待endpoint的一个令牌，未配置限流的接口直接返回
+func (l *RateLimiter) Wait(ctx context.Context, endpoint string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	b, ok := l.buckets[endpoint]
+	if !ok {
+		limit, configured := l.limits[endpoint]
+		if !configured || limit.Rate <= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		b = newTokenBucket(limit)
+		l.buckets[endpoint] = b
+	}
+	l.mu.Unlock()
+
+	return b.wait(ctx)
+}
+
+// Transport 返回发送前等待endpoint令牌的RoundTripper，用于不经过ArkClient.send的请求，base为nil时使用http.DefaultTransport
+func (l *RateLimiter) Transport(endpoint string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &limitedTransport{limiter: l, endpoint: endpoint, base: base}
+}
+
+type limitedTransport struct {
+	limiter  *RateLimiter
+	endpoint string
+	base     http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context(), t.endpoint); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: limit.Rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package volc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterPerEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"task-1","status":"running","data":[{"url":"https://example.com/a.png"}]}`))
+	}))
+	defer srv.Close()
+	c := newTestClient(srv, 1)
+	c.Limiter = NewRateLimiter(map[string]RateLimit{
+		EndpointImageGenerate: {Rate: 10, Burst: 1},
+	})
+	ctx := context.Background()
+
+	// 桶容量为1、每秒10个令牌：第1次立即发送，之后每次约等待100ms
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := c.GenerateImages(ctx, ImageGenParams{Prompt: "a cat"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("3 image requests took %s, want >= 200ms", elapsed)
+	}
+
+	// 未配置限流的接口不受影响
+	start = time.Now()
+	for i := 0; i < 20; i++ {
+		if _, err := c.GetVideoTask(ctx, "task-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("unlimited endpoint took %s", elapsed)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	l := NewRateLimiter(map[string]RateLimit{EndpointVideoCreate: {Rate: 0.1, Burst: 1}})
+	if err := l.Wait(context.Background(), EndpointVideoCreate); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, EndpointVideoCreate); err == nil {
+		t.Fatal("Wait returned without a token")
+	}
+}
+
+func TestChatHTTPClientIsRateLimited(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+	c := newTestClient(srv, 1)
+	c.Limiter = NewRateLimiter(map[string]RateLimit{EndpointChat: {Rate: 10, Burst: 1}})
+	client := c.ChatHTTPClient()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		res, err := client.Post(srv.URL+"/api/v3/chat/completions", "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("3 chat requests took %s, want >= 200ms", elapsed)
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3", requests)
+	}
+}
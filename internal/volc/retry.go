@@ -0,0 +1,123 @@
+package volc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy Ark请求的重试策略，采用带抖动的指数退避
+type RetryPolicy struct {
+	MaxAttempts int           // 最大尝试次数（含首次），<=1表示不重试
+	BaseDelay   time.Duration // 首次重试前的等待时间
+	MaxDelay    time.Duration // 单次等待的上限，同样限制Retry-After
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    20 * time.Second,
+	}
+}
+
+// backoff 第attempt次重试（从1开始）前的等待时间，取[d/2, d)之间的随机值
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// delay 计算重试等待时间，服务端返回Retry-After时优先使用
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return retryAfter
+	}
+	return p.backoff(attempt)
+}
+
+// shouldRetry 判断请求失败后是否可以重试
+// idempotent为false的请求（如生成图片、创建视频任务）只在服务端确定未处理该请求时重试：
+// 429，或请求发出之前的连接错误（DNS解析、建立连接失败）
+func shouldRetry(err error, idempotent bool) bool {
+	if err == nil {
+		return false
+	}
+	if arkErr, ok := AsArkError(err); ok {
+		if IsRateLimited(arkErr) {
+			return true
+		}
+		return idempotent && arkErr.StatusCode >= 500
+	}
+	if notSent(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return idempotent
+	}
+	return false
+}
+
+// notSent 判断错误是否发生在请求发出之前
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter 解析Retry-After头，支持秒数和HTTP日期两种格式
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func retryAfterOf(err error) time.Duration {
+	if arkErr, ok := AsArkError(err); ok {
+		return arkErr.RetryAfter
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
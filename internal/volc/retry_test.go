@@ -0,0 +1,160 @@
+package volc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient 指向httptest.Server的客户端，不限流，重试间隔很短
+func newTestClient(srv *httptest.Server, attempts int) *ArkClient {
+	return &ArkClient{
+		BaseURL:    srv.URL,
+		APIKey:     "test",
+		HTTPClient: srv.Client(),
+		Retry:      RetryPolicy{MaxAttempts: attempts, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Second},
+	}
+}
+
+// failingServer 前failures次请求返回status，之后返回200
+func failingServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"code":"InternalServiceError","message":"try again"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"task-1","status":"running","data":[{"url":"https://example.com/a.png"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 150 * time.Millisecond, 300 * time.Millisecond}, // 400ms被MaxDelay限制为300ms
+		{6, 150 * time.Millisecond, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			if d := p.backoff(tt.attempt); d < tt.min || d > tt.max {
+				t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+	if d := p.delay(1, time.Second); d != p.MaxDelay {
+		t.Errorf("delay with long Retry-After = %s, want MaxDelay %s", d, p.MaxDelay)
+	}
+	if d := p.delay(1, 200*time.Millisecond); d != 200*time.Millisecond {
+		t.Errorf("delay with Retry-After = %s, want 200ms", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("seconds: got %s", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)); d < 8*time.Second || d > 10*time.Second {
+		t.Errorf("http date: got %s", d)
+	}
+	for _, v := range []string{"", "-1", "soon"} {
+		if d := parseRetryAfter(v); d != 0 {
+			t.Errorf("parseRetryAfter(%q) = %s, want 0", v, d)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	dialErr := &url.Error{Op: "Post", URL: "http://ark", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	readErr := &url.Error{Op: "Post", URL: "http://ark", Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}}
+	tests := []struct {
+		name       string
+		err        error
+		idempotent bool
+		want       bool
+	}{
+		{"429", &ArkError{StatusCode: http.StatusTooManyRequests}, false, true},
+		{"500 idempotent", &ArkError{StatusCode: http.StatusInternalServerError}, true, true},
+		{"500 not idempotent", &ArkError{StatusCode: http.StatusInternalServerError}, false, false},
+		{"400", &ArkError{StatusCode: http.StatusBadRequest}, true, false},
+		{"dial error not idempotent", dialErr, false, true},
+		{"dns error not idempotent", &net.DNSError{Err: "no such host", Name: "ark"}, false, true},
+		{"read error idempotent", readErr, true, true},
+		{"read error not idempotent", readErr, false, false},
+		{"other", errors.New("boom"), true, false},
+	}
+	for _, tt := range tests {
+		if got := shouldRetry(tt.err, tt.idempotent); got != tt.want {
+			t.Errorf("%s: shouldRetry = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetVideoTaskRetriesServerErrors(t *testing.T) {
+	srv, calls := failingServer(t, 2, http.StatusServiceUnavailable, nil)
+	c := newTestClient(srv, 3)
+	if _, err := c.GetVideoTask(context.Background(), "task-1"); err != nil {
+		t.Fatalf("GetVideoTask: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestGenerateImagesNotRetriedOnServerError(t *testing.T) {
+	srv, calls := failingServer(t, 1, http.StatusInternalServerError, nil)
+	c := newTestClient(srv, 3)
+	_, err := c.GenerateImages(context.Background(), ImageGenParams{Prompt: "a cat"})
+	if arkErr, ok := AsArkError(err); !ok || arkErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got %v, want 500 ArkError", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1: a billed generation must not be retried after a 5xx", got)
+	}
+}
+
+func TestGenerateImagesHonorsRetryAfter(t *testing.T) {
+	srv, calls := failingServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+	c := newTestClient(srv, 3)
+	start := time.Now()
+	if _, err := c.GenerateImages(context.Background(), ImageGenParams{Prompt: "a cat"}); err != nil {
+		t.Fatalf("GenerateImages: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %s, want Retry-After of 1s", elapsed)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	srv, calls := failingServer(t, 10, http.StatusTooManyRequests, http.Header{"Retry-After": {"5"}})
+	c := newTestClient(srv, 5)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := c.GetVideoTask(ctx, "task-1")
+	if !IsRateLimited(err) {
+		t.Fatalf("got %v, want the last rate limit error", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
@@ -0,0 +1,242 @@
+package volc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"illustration2/internal/config"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VideoTaskStatus 视频任务状态
+type VideoTaskStatus string
+
+const (
+	VideoTaskQueued    VideoTaskStatus = "queued"
+	VideoTaskRunning   VideoTaskStatus = "running"
+	VideoTaskSucceeded VideoTaskStatus = "succeeded"
+	VideoTaskFailed    VideoTaskStatus = "failed"
+	VideoTaskCancelled VideoTaskStatus = "cancelled"
+)
+
+// Terminal 任务是否已结束
+func (s VideoTaskStatus) Terminal() bool {
+	return s == VideoTaskSucceeded || s == VideoTaskFailed || s == VideoTaskCancelled
+}
+
+// normalizeVideoTaskStatus 将Ark返回的状态统一为VideoTaskStatus，兼容不同版本接口的写法
+// expired及无法识别的状态视为失败，ok为false表示无法识别
+func normalizeVideoTaskStatus(s string) (status VideoTaskStatus, ok bool) {
+	switch strings.ToLower(s) {
+	case "queued", "pending":
+		return VideoTaskQueued, true
+	case "running", "processing":
+		return VideoTaskRunning, true
+	case "succeeded", "success", "succeed":
+		return VideoTaskSucceeded, true
+	case "failed", "failure", "error", "expired":
+		return VideoTaskFailed, true
+	case "cancelled", "canceled":
+		return VideoTaskCancelled, true
+	default:
+		return VideoTaskFailed, false
+	}
+}
+
+// VideoTaskUsage 视频任务用量
+type VideoTaskUsage struct {
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// VideoTaskResult 视频任务查询结果
+type VideoTaskResult struct {
+	TaskID       string          `json:"task_id"`
+	Model        string          `json:"model,omitempty"`
+	Status       VideoTaskStatus `json:"status"`
+	VideoURL     string          `json:"video_url,omitempty"`
+	LastFrameURL string          `json:"last_frame_url,omitempty"`
+	Duration     int             `json:"duration,omitempty"` // 视频时长（秒）
+	ErrorCode    string          `json:"error_code,omitempty"`
+	ErrorMessage string          `json:"error_message,omitempty"` // 任务失败原因
+	Usage        VideoTaskUsage  `json:"usage"`
+}
+
+// VideoTaskError 视频任务以失败或取消结束
+type VideoTaskError struct {
+	TaskID  string
+	Status  VideoTaskStatus
+	Code    string
+	Message string
+}
+
+func (e *VideoTaskError) Error() string {
+	msg := fmt.Sprintf("video task %s %s", e.TaskID, e.Status)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// ErrVideoTaskTimeout 等待视频任务超时
+var ErrVideoTaskTimeout = errors.New("video task timed out")
+
+// GetVideoTask 查询视频任务
+func (c *ArkClient) GetVideoTask(ctx context.Context, taskID string) (*VideoTaskResult, error) {
+	if c.Mock {
+		return &VideoTaskResult{
+			TaskID:       taskID,
+			Status:       VideoTaskSucceeded,
+			VideoURL:     "https://example.com/mock_video.mp4",
+			LastFrameURL: "https://example.com/mock_last_frame.png",
+			Duration:     5,
+		}, nil
+	}
+	bodyBytes, err := c.send(ctx, http.MethodGet, EndpointVideoGet, "/api/v3/contents/generations/tasks/"+taskID, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Status  string `json:"status"`
+		Content struct {
+			VideoURL     string `json:"video_url"`
+			LastFrameURL string `json:"last_frame_url"`
+		} `json:"content"`
+		Duration int `json:"duration"`
+		Error    *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Usage VideoTaskUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(bodyBytes, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode video task %s: %w", taskID, err)
+	}
+	status, known := normalizeVideoTaskStatus(resp.Status)
+	result := &VideoTaskResult{
+		TaskID:       taskID,
+		Model:        resp.Model,
+		Status:       status,
+		VideoURL:     resp.Content.VideoURL,
+		LastFrameURL: resp.Content.LastFrameURL,
+		Duration:     resp.Duration,
+		Usage:        resp.Usage,
+	}
+	if resp.Error != nil {
+		result.ErrorCode = resp.Error.Code
+		result.ErrorMessage = resp.Error.Message
+	}
+	if !known {
+		msg := fmt.Sprintf("unknown task status %q", resp.Status)
+		if result.ErrorMessage != "" {
+			msg = result.ErrorMessage + "; " + msg
+		}
+		result.ErrorMessage = msg
+	} else if strings.EqualFold(resp.Status, "expired") && result.ErrorMessage == "" {
+		result.ErrorMessage = "task expired"
+	}
+	return result, nil
+}
+
+// CancelVideoTask 取消未结束的视频任务，已结束的任务直接返回nil
+// Ark只允许取消排队中的任务，运行中的任务会返回错误
+func (c *ArkClient) CancelVideoTask(ctx context.Context, taskID string) error {
+	if c.Mock {
+		return nil
+	}
+	result, err := c.GetVideoTask(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if result.Status.Terminal() {
+		return nil
+	}
+	return c.deleteVideoTask(ctx, taskID)
+}
+
+// DeleteVideoTask 删除视频任务记录，排队中的任务会被取消
+func (c *ArkClient) DeleteVideoTask(ctx context.Context, taskID string) error {
+	if c.Mock {
+		return nil
+	}
+	return c.deleteVideoTask(ctx, taskID)
+}
+
+func (c *ArkClient) deleteVideoTask(ctx context.Context, taskID string) error {
+	_, err := c.send(ctx, http.MethodDelete, EndpointVideoDelete, "/api/v3/contents/generations/tasks/"+taskID, nil, true)
+	return err
+}
+
+// WaitOptions 等待视频任务的轮询参数
+type WaitOptions struct {
+	PollInterval    time.Duration                 // 首次轮询间隔，默认5秒
+	MaxPollInterval time.Duration                 // 轮询间隔上限，不大于PollInterval时固定间隔轮询
+	Timeout         time.Duration                 // 等待超时时间，0表示只受ctx控制
+	OnUpdate        func(result *VideoTaskResult) // 每次查询到任务结果后调用
+}
+
+// NewWaitOptions 根据视频配置创建轮询参数
+func NewWaitOptions(cfg config.VideoConfig) WaitOptions {
+	return WaitOptions{PollInterval: cfg.PollInterval, Timeout: cfg.TaskTimeout}
+}
+
+// WaitForVideoTask 轮询视频任务直到结束
+// 成功时返回结果；失败或取消时返回*VideoTaskError；超时返回ErrVideoTaskTimeout；
+// 限流、服务端错误等可恢复的查询错误会继续轮询，其余查询错误直接返回
+func (c *ArkClient) WaitForVideoTask(ctx context.Context, taskID string, opts WaitOptions) (*VideoTaskResult, error) {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	parent := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	for {
+		result, err := c.GetVideoTask(ctx, taskID)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// 由下面的ctx.Done()分支处理
+		case err != nil:
+			if !shouldRetry(err, true) {
+				return nil, err
+			}
+		default:
+			if opts.OnUpdate != nil {
+				opts.OnUpdate(result)
+			}
+			switch {
+			case result.Status == VideoTaskSucceeded && result.VideoURL != "":
+				return result, nil
+			case result.Status == VideoTaskSucceeded:
+				return result, &VideoTaskError{TaskID: taskID, Status: result.Status, Message: "no video url in result"}
+			case result.Status.Terminal():
+				return result, &VideoTaskError{TaskID: taskID, Status: result.Status, Code: result.ErrorCode, Message: result.ErrorMessage}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// 调用方的ctx取消或到期时返回其错误，只有本地的Timeout到期才算任务超时
+			if err := parent.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: task %s not finished after %s", ErrVideoTaskTimeout, taskID, opts.Timeout)
+		case <-time.After(interval):
+		}
+		if opts.MaxPollInterval > interval {
+			interval = min(interval*3/2, opts.MaxPollInterval)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package volc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeVideoTaskStatus(t *testing.T) {
+	tests := []struct {
+		raw   string
+		want  VideoTaskStatus
+		known bool
+	}{
+		{"queued", VideoTaskQueued, true},
+		{"running", VideoTaskRunning, true},
+		{"Succeeded", VideoTaskSucceeded, true},
+		{"failed", VideoTaskFailed, true},
+		{"expired", VideoTaskFailed, true},
+		{"canceled", VideoTaskCancelled, true},
+		{"paused", VideoTaskFailed, false},
+		{"", VideoTaskFailed, false},
+	}
+	for _, tt := range tests {
+		got, known := normalizeVideoTaskStatus(tt.raw)
+		if got != tt.want || known != tt.known {
+			t.Errorf("normalizeVideoTaskStatus(%q) = %s, %v, want %s, %v", tt.raw, got, known, tt.want, tt.known)
+		}
+	}
+}
+
+func statusServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWaitForVideoTaskUnknownStatus(t *testing.T) {
+	c := newTestClient(statusServer(t, `{"id":"task-1","status":"paused"}`), 1)
+	_, err := c.WaitForVideoTask(context.Background(), "task-1", WaitOptions{PollInterval: time.Millisecond, Timeout: time.Second})
+	var taskErr *VideoTaskError
+	if !errors.As(err, &taskErr) || taskErr.Status != VideoTaskFailed {
+		t.Fatalf("got %v, want a failed VideoTaskError", err)
+	}
+	if !strings.Contains(err.Error(), `"paused"`) {
+		t.Errorf("error %q does not include the raw status", err)
+	}
+}
+
+func TestWaitForVideoTaskTimeout(t *testing.T) {
+	c := newTestClient(statusServer(t, `{"id":"task-1","status":"running"}`), 1)
+	opts := WaitOptions{PollInterval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond}
+
+	_, err := c.WaitForVideoTask(context.Background(), "task-1", opts)
+	if !errors.Is(err, ErrVideoTaskTimeout) {
+		t.Errorf("local timeout: got %v, want ErrVideoTaskTimeout", err)
+	}
+
+	// 调用方的ctx先到期时不是任务超时
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	opts.Timeout = time.Minute
+	_, err = c.WaitForVideoTask(ctx, "task-1", opts)
+	if errors.Is(err, ErrVideoTaskTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("parent deadline: got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"illustration2/internal/config"
 	"illustration2/internal/handler"
 	"illustration2/internal/ill_agent"
+	"illustration2/internal/job"
 	"illustration2/internal/service"
+	"illustration2/internal/store"
+	"illustration2/internal/utils"
 	"illustration2/internal/volc"
 	"log"
 	"net/http"
@@ -17,18 +20,20 @@ import (
 	"os"
 
 	"github.com/cloudwego/eino-examples/adk/common/prints"
-	"github.com/cloudwego/eino-examples/adk/common/store"
 	"github.com/cloudwego/eino/adk"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	config.InitConfig()
+	cfg, err := config.InitConfig()
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
 
 	// ctx := context.Background()
-	// ill_agent.TestImageAgent(ctx)
-	// debugAgent(ctx)
+	// ill_agent.TestImageAgent(ctx, cfg)
+	// debugAgent(ctx, cfg)
 	// feedback_loop_example.Main_exec()
 	// 初始化日志
 	logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
@@ -37,26 +42,70 @@ func main() {
 	// 初始化Gin路由
 	router := gin.Default()
 
+	// 初始化会话存储，会话状态和checkpoint落盘，服务重启后仍可resume
+	sessionStore, err := store.NewFileStore(cfg.Session.StoreDir)
+	if err != nil {
+		log.Fatalf("初始化会话存储失败: %v", err)
+	}
+	ill_agent.SetSessionStore(sessionStore)
+
+	// 初始化资源存储，生成的图片、视频转存后使用稳定地址
+	assetStore, err := store.NewAssetStore(cfg.Assets)
+	if err != nil {
+		log.Fatalf("初始化资源存储失败: %v", err)
+	}
+	ill_agent.SetAssetArchiver(store.NewAssetArchiver(assetStore, utils.NewDownloader(cfg.Download, nil)))
+
+	// 后台任务（会话清理、视频任务轮询）随服务关闭停止
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
 	// 初始化服务
-	arkClient := volc.NewArkClientDefault()
-	genService := service.NewGenerationService(arkClient)
+	arkClient := volc.NewArkClient(cfg.Ark, cfg.Ark.Timeout)
+	jobManager, err := job.NewManager(bgCtx, cfg.Jobs, arkClient)
+	if err != nil {
+		log.Fatalf("初始化任务管理失败: %v", err)
+	}
+	if cfg.Jobs.CallbackSecret == "" {
+		log.Printf("JOB_CALLBACK_SECRET未设置，任务回调请求不签名")
+	}
+	genService := service.NewGenerationService(arkClient, cfg, jobManager)
 	genHandler := handler.NewGenerationHandler(genService)
-	agentStreamHandler := handler.NewAgentStreamHandler(genService)
+	agentStreamHandler := handler.NewAgentStreamHandler(cfg, genService, sessionStore)
 
 	router.POST("/api/generate", genHandler.HandleGeneration)
 	router.GET("/api/video/:task_id", genHandler.HandleGetVideo)
+	router.GET("/api/models", genHandler.HandleListModels)
+	router.GET("/api/jobs", genHandler.HandleListJobs)
+	router.GET("/api/jobs/:id", genHandler.HandleGetJob)
+	router.POST("/api/jobs/:id/cancel", genHandler.HandleCancelJob)
 	router.POST("/api/agent/stream", agentStreamHandler.HandleAgentStream)
 	router.POST("/api/agent/resume", agentStreamHandler.HandleAgentResume)
+	router.GET("/api/agent/sessions", agentStreamHandler.HandleListSessions)
+	router.GET("/api/agent/sessions/:id", agentStreamHandler.HandleGetSession)
+	router.GET("/api/agent/sessions/:id/events", agentStreamHandler.HandleAgentEvents)
+	router.GET("/api/agent/sessions/:id/video", agentStreamHandler.HandleGetSessionVideo)
+	router.GET("/api/agent/sessions/:id/export", agentStreamHandler.HandleExportSession)
+	router.POST("/api/agent/sessions/:id/cancel", agentStreamHandler.HandleCancelSession)
+	router.DELETE("/api/agent/sessions/:id", agentStreamHandler.HandleDeleteSession)
+	if localStore, ok := assetStore.(*store.LocalAssetStore); ok {
+		router.GET(cfg.Assets.Local.RoutePath()+"/*key", handler.NewAssetHandler(localStore).HandleGetAsset)
+	}
+
+	// 定期清理空闲会话
+	go agentStreamHandler.RunEviction(bgCtx, cfg.Session.TTL, cfg.Session.EvictInterval)
+	// 定期清理过期的视频任务记录
+	go jobManager.RunPruning(bgCtx, cfg.Jobs.Retention, cfg.Jobs.PruneInterval)
 
 	// 启动服务器
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.Server.Addr,
 		Handler: router,
 	}
 
 	// 在goroutine中启动服务器
 	go func() {
-		log.Printf("服务器启动在 :8080")
+		log.Printf("服务器启动在 %s", cfg.Server.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("启动服务器失败: %v", err)
 		}
@@ -76,12 +125,13 @@ func main() {
 	log.Println("服务器已关闭")
 }
 
-func debugAgent(ctx context.Context) {
-	a := ill_agent.NewMKAgent(ctx)
+func debugAgent(ctx context.Context, cfg *config.Config) {
+	ctx = ill_agent.WithSessionID(ctx, "1")
+	a := ill_agent.NewMKAgent(ctx, cfg)
 	runner := adk.NewRunner(ctx, adk.RunnerConfig{
 		EnableStreaming: true, // you can disable streaming here
 		Agent:           a,
-		CheckPointStore: store.NewInMemoryStore(),
+		CheckPointStore: store.NewMemoryStore(),
 	})
 	iter := runner.Query(ctx, "恐龙为什么灭绝了？", adk.WithCheckPointID("1"))
 